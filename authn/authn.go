@@ -0,0 +1,69 @@
+// Package authn checks login credentials. Each backend implements
+// Authenticator; the configured backends are tried in order.
+package authn
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"todo-app/config"
+	"todo-app/models"
+	"todo-app/passwords"
+)
+
+var (
+	// ErrInvalidCredentials means the backend does not accept the identifier
+	// and password, whether or not it knows the user.
+	ErrInvalidCredentials = errors.New("authn: invalid credentials")
+	// ErrAccountConflict means the credentials are valid but belong to
+	// someone other than the local account with the same username or email.
+	ErrAccountConflict = errors.New("authn: account conflict")
+)
+
+type Authenticator interface {
+	// Authenticate checks the credentials and returns the local account they
+	// belong to, creating it if the backend provisions accounts. The
+	// identifier is a username or an email address.
+	Authenticate(ctx context.Context, identifier, password string) (models.User, error)
+}
+
+// New returns the authenticator for the configured backends.
+func New(cfg *config.Config) Authenticator {
+	var chain Chain
+	for _, backend := range cfg.Auth.Backends {
+		switch backend {
+		case config.AuthBackendLocal:
+			chain = append(chain, Local{Hasher: passwords.NewHasher(cfg.Password.Hash)})
+		case config.AuthBackendLDAP:
+			chain = append(chain, NewLDAP(cfg.LDAP))
+		}
+	}
+	if len(chain) == 1 {
+		return chain[0]
+	}
+	return chain
+}
+
+// Chain tries each authenticator in turn and returns the first success.
+type Chain []Authenticator
+
+func (ch Chain) Authenticate(ctx context.Context, identifier, password string) (models.User, error) {
+	var failure error
+	for _, a := range ch {
+		user, err := a.Authenticate(ctx, identifier, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			// A backend that is down must not hide a later one that works,
+			// but its error wins over a plain rejection
+			log.Printf("Authenticate: Backend %T failed: %v", a, err)
+			failure = err
+		}
+	}
+	if failure != nil {
+		return models.User{}, failure
+	}
+	return models.User{}, ErrInvalidCredentials
+}
@@ -0,0 +1,184 @@
+package authn
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/ldap"
+	"todo-app/models"
+	"todo-app/normalize"
+	"todo-app/tokens"
+)
+
+// identityProviderLDAP names directory accounts in user_identities, where
+// the subject is the entry's DN.
+const identityProviderLDAP = "ldap"
+
+// LDAP checks passwords by binding to a directory as the user. Accounts are
+// created on first login from the entry's attributes.
+type LDAP struct {
+	cfg       config.LDAPConfig
+	tlsConfig *tls.Config
+}
+
+func NewLDAP(cfg config.LDAPConfig) *LDAP {
+	return &LDAP{
+		cfg:       cfg,
+		tlsConfig: &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+	}
+}
+
+// IsDirectoryUser reports whether the account is linked to a directory
+// entry, so that its password is managed in the directory.
+func IsDirectoryUser(userID int64) (bool, error) {
+	return database.HasUserIdentity(userID, identityProviderLDAP)
+}
+
+func (l *LDAP) Authenticate(ctx context.Context, identifier, password string) (models.User, error) {
+	if identifier == "" || password == "" {
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	entry, err := l.bindUser(ctx, identifier, password)
+	if err != nil {
+		return models.User{}, err
+	}
+	return l.localUser(entry)
+}
+
+// bindUser finds the user's entry and verifies the password by binding as
+// it.
+func (l *LDAP) bindUser(ctx context.Context, identifier, password string) (ldap.Entry, error) {
+	conn, err := ldap.Dial(ctx, l.cfg.URL, l.tlsConfig, l.cfg.Timeout.Std())
+	if err != nil {
+		return ldap.Entry{}, fmt.Errorf("authn: connecting to %s: %w", l.cfg.URL, err)
+	}
+	defer conn.Close()
+
+	if l.cfg.StartTLS {
+		if err := conn.StartTLS(l.tlsConfig); err != nil {
+			return ldap.Entry{}, fmt.Errorf("authn: StartTLS: %w", err)
+		}
+	}
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return ldap.Entry{}, fmt.Errorf("authn: service account bind: %w", err)
+		}
+	}
+
+	// Directory attributes like uid and mail match without regard to case
+	filter := ldap.Equal(l.cfg.UserAttribute, identifier)
+	if normalize.IsEmail(identifier) {
+		filter = ldap.Or(filter, ldap.Equal(l.cfg.EmailAttribute, identifier))
+	}
+	if l.cfg.ObjectClass != "" {
+		filter = ldap.And(ldap.Equal("objectClass", l.cfg.ObjectClass), filter)
+	}
+	// Two results are enough to tell a unique match from an ambiguous one
+	entries, err := conn.Search(l.cfg.BaseDN, filter, []string{l.cfg.UserAttribute, l.cfg.EmailAttribute}, 2)
+	if err != nil {
+		return ldap.Entry{}, fmt.Errorf("authn: searching for %q: %w", identifier, err)
+	}
+	if len(entries) != 1 {
+		if len(entries) > 1 {
+			log.Printf("LDAP: %d entries match %q, refusing to guess", len(entries), identifier)
+		}
+		return ldap.Entry{}, ErrInvalidCredentials
+	}
+
+	entry := entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsInvalidCredentials(err) {
+			return ldap.Entry{}, ErrInvalidCredentials
+		}
+		return ldap.Entry{}, fmt.Errorf("authn: user bind: %w", err)
+	}
+	return entry, nil
+}
+
+// localUser returns the account linked to the directory entry. On first
+// login the entry is linked to the account with the same email address, or
+// a new account is created.
+func (l *LDAP) localUser(entry ldap.Entry) (models.User, error) {
+	user, err := database.GetUserByIdentity(identityProviderLDAP, entry.DN)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	username := entry.Get(l.cfg.UserAttribute)
+	email := entry.Get(l.cfg.EmailAttribute)
+	if email == "" {
+		return models.User{}, fmt.Errorf("authn: directory entry %s has no %s attribute", entry.DN, l.cfg.EmailAttribute)
+	}
+
+	user, err = database.GetUserByEmail(email)
+	switch {
+	case err == nil:
+		// Only link accounts that proved they own the address
+		if user.EmailVerifiedAt == nil {
+			log.Printf("LDAP: Not linking %s to unverified user ID %d", entry.DN, user.ID)
+			return models.User{}, ErrAccountConflict
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err := database.GetUserByUsername(username); err == nil {
+			log.Printf("LDAP: Username %q of %s is taken by a local account", username, entry.DN)
+			return models.User{}, ErrAccountConflict
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, err
+		}
+		user, err = createDirectoryUser(username, email)
+		if err != nil {
+			return models.User{}, err
+		}
+		log.Printf("LDAP: Created user ID %d for %s", user.ID, entry.DN)
+	default:
+		return models.User{}, err
+	}
+
+	err = database.CreateUserIdentity(models.UserIdentity{
+		UserID:    user.ID,
+		Provider:  identityProviderLDAP,
+		Subject:   entry.DN,
+		Email:     email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// createDirectoryUser provisions an account for a directory user. Its local
+// password is random and never shown, and password changes and resets are
+// refused for directory users, so only the directory password works.
+func createDirectoryUser(username, email string) (models.User, error) {
+	password, err := tokens.Generate(32)
+	if err != nil {
+		return models.User{}, err
+	}
+	user, err := database.CreateUser(models.RegisterInput{
+		Username: username,
+		Email:    email,
+		Password: password,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	// The directory is trusted to hold the right address
+	if err := database.MarkEmailVerified(user.ID); err != nil {
+		return models.User{}, err
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	return user, nil
+}
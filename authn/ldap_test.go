@@ -0,0 +1,169 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/ldap/ldaptest"
+	"todo-app/models"
+	"todo-app/passwords"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+const (
+	testBindDN       = "cn=admin,dc=example,dc=com"
+	testBindPassword = "admin"
+)
+
+// setupLDAP opens a fresh database and serves the users from an in-memory
+// directory, returning an LDAP backend configured for it.
+func setupLDAP(t *testing.T, users ...ldaptest.User) *LDAP {
+	t.Helper()
+	if err := database.InitDB(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "todo.db")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go ldaptest.NewDirectory(testBindDN, testBindPassword, users...).Serve(ln)
+
+	cfg := config.Default().LDAP
+	cfg.URL = "ldap://" + ln.Addr().String()
+	cfg.BindDN = testBindDN
+	cfg.BindPassword = testBindPassword
+	cfg.BaseDN = "dc=example,dc=com"
+	cfg.Timeout = config.Duration(5 * time.Second)
+	return NewLDAP(cfg)
+}
+
+var jdoe = ldaptest.User{UID: "jdoe", Password: "secret", Email: "jdoe@example.com"}
+
+func TestLDAPProvisionsOnFirstLogin(t *testing.T) {
+	l := setupLDAP(t, jdoe)
+	ctx := context.Background()
+
+	user, err := l.Authenticate(ctx, "jdoe", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "jdoe" || user.Email != "jdoe@example.com" {
+		t.Errorf("provisioned %q <%s>, want jdoe <jdoe@example.com>", user.Username, user.Email)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("provisioned account is not verified")
+	}
+	stored, err := database.GetUserByIdentity(identityProviderLDAP, "uid=jdoe,"+ldaptest.PeopleDN)
+	if err != nil || stored.ID != user.ID {
+		t.Fatalf("identity links to %d, %v; want %d", stored.ID, err, user.ID)
+	}
+	if directory, err := IsDirectoryUser(user.ID); err != nil || !directory {
+		t.Errorf("IsDirectoryUser = %v, %v; want true", directory, err)
+	}
+
+	// The random local password is not the directory one
+	if ok, _ := passwords.Verify("secret", stored.Password); ok {
+		t.Error("directory password stored as the local password")
+	}
+
+	// Later logins, by username or email, find the same account
+	for _, identifier := range []string{"jdoe", "JDOE", "jdoe@example.com"} {
+		again, err := l.Authenticate(ctx, identifier, "secret")
+		if err != nil {
+			t.Fatalf("login as %q: %v", identifier, err)
+		}
+		if again.ID != user.ID {
+			t.Errorf("login as %q returned user %d, want %d", identifier, again.ID, user.ID)
+		}
+	}
+}
+
+func TestLDAPRejectsBadCredentials(t *testing.T) {
+	l := setupLDAP(t, jdoe)
+	ctx := context.Background()
+
+	for _, tc := range []struct{ identifier, password string }{
+		{"jdoe", "wrong"},
+		{"jdoe", ""},
+		{"", "secret"},
+		{"nobody", "secret"},
+		// Values are not filter syntax, so wildcards match nothing
+		{"*", "secret"},
+	} {
+		if _, err := l.Authenticate(ctx, tc.identifier, tc.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) = %v, want ErrInvalidCredentials", tc.identifier, tc.password, err)
+		}
+	}
+	if _, err := database.GetUserByUsername("jdoe"); err == nil {
+		t.Error("failed logins provisioned an account")
+	}
+}
+
+func TestLDAPRefusesAmbiguousEntries(t *testing.T) {
+	l := setupLDAP(t,
+		ldaptest.User{UID: "ann", Password: "secret", Email: "shared@example.com"},
+		ldaptest.User{UID: "bea", Password: "secret", Email: "shared@example.com"},
+	)
+	if _, err := l.Authenticate(context.Background(), "shared@example.com", "secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPLinksVerifiedAccount(t *testing.T) {
+	l := setupLDAP(t, jdoe)
+	local, err := database.CreateUser(models.RegisterInput{Username: "john", Email: "jdoe@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unverified address could belong to anyone
+	if _, err := l.Authenticate(context.Background(), "jdoe", "secret"); !errors.Is(err, ErrAccountConflict) {
+		t.Fatalf("unverified: Authenticate = %v, want ErrAccountConflict", err)
+	}
+
+	if err := database.MarkEmailVerified(local.ID); err != nil {
+		t.Fatal(err)
+	}
+	user, err := l.Authenticate(context.Background(), "jdoe", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != local.ID {
+		t.Errorf("linked user %d, want %d", user.ID, local.ID)
+	}
+}
+
+func TestLDAPDoesNotTakeOverUsername(t *testing.T) {
+	l := setupLDAP(t, jdoe)
+	if _, err := database.CreateUser(models.RegisterInput{Username: "jdoe", Email: "someone@example.com", Password: "correct horse battery"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Authenticate(context.Background(), "jdoe", "secret"); !errors.Is(err, ErrAccountConflict) {
+		t.Errorf("Authenticate = %v, want ErrAccountConflict", err)
+	}
+}
+
+func TestLDAPServiceAccountFailure(t *testing.T) {
+	l := setupLDAP(t, jdoe)
+	l.cfg.BindPassword = "wrong"
+	_, err := l.Authenticate(context.Background(), "jdoe", "secret")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %v, want a service account error", err)
+	}
+}
@@ -0,0 +1,59 @@
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"todo-app/database"
+	"todo-app/models"
+	"todo-app/passwords"
+)
+
+// Local checks passwords against the hashes in the users table. With a
+// Hasher, hashes weaker than it would make are replaced after a successful
+// login, while the password is at hand.
+type Local struct {
+	Hasher *passwords.Hasher
+}
+
+func (l Local) Authenticate(ctx context.Context, identifier, password string) (models.User, error) {
+	user, err := database.GetUserByIdentifier(identifier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	ok, err := passwords.Verify(password, user.Password)
+	if err != nil {
+		log.Printf("Authenticate: Cannot check the password hash of user %d: %v", user.ID, err)
+		return models.User{}, ErrInvalidCredentials
+	}
+	if !ok {
+		return models.User{}, ErrInvalidCredentials
+	}
+	if l.Hasher != nil && l.Hasher.NeedsRehash(user.Password) {
+		l.rehash(user, password)
+	}
+	return user, nil
+}
+
+// rehash stores a new hash of the user's password. Failing only delays the
+// upgrade to the next login.
+func (l Local) rehash(user models.User, password string) {
+	hash, err := l.Hasher.Hash(password)
+	if err != nil {
+		log.Printf("rehash: Failed to hash password of user %d: %v", user.ID, err)
+		return
+	}
+	replaced, err := database.ReplacePasswordHash(user.ID, user.Password, hash)
+	if err != nil {
+		log.Printf("rehash: Failed to store password hash of user %d: %v", user.ID, err)
+		return
+	}
+	if replaced {
+		log.Printf("rehash: Upgraded password hash of user %d", user.ID)
+	}
+}
@@ -0,0 +1,290 @@
+// Command mock-idp is a minimal OpenID Connect provider for trying out and
+// testing single sign-on locally. It signs in whoever submits its login form,
+// so it must never be exposed to a network.
+//
+//	go run ./cmd/mock-idp -addr :9000
+//
+// and configure a provider with issuer http://localhost:9000, client_id
+// todo-app and client_secret mock-secret.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	keyID   = "mock-key"
+	codeTTL = time.Minute
+)
+
+type authCode struct {
+	redirectURI   string
+	challenge     string
+	nonce         string
+	email         string
+	name          string
+	emailVerified bool
+	expiresAt     time.Time
+}
+
+type server struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>Mock IdP</title></head>
+<body style="font-family: sans-serif; max-width: 24rem; margin: 4rem auto;">
+  <h1>Mock IdP</h1>
+  <p>Sign in to <b>{{ .ClientID }}</b> as:</p>
+  <form method="post" action="/authorize">
+    {{ range $name, $value := .Params }}<input type="hidden" name="{{ $name }}" value="{{ $value }}">
+    {{ end }}
+    <p><label>Email<br><input type="email" name="email" value="{{ .Email }}" required></label></p>
+    <p><label>Name<br><input type="text" name="name" value="{{ .Name }}"></label></p>
+    <p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+    <p>
+      <button type="submit" name="action" value="allow">Sign in</button>
+      <button type="submit" name="action" value="deny">Cancel</button>
+    </p>
+  </form>
+</body>
+</html>`))
+
+func main() {
+	addr := flag.String("addr", ":9000", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, as configured in the application")
+	clientID := flag.String("client-id", "todo-app", "accepted client ID")
+	clientSecret := flag.String("client-secret", "mock-secret", "accepted client secret; empty for a public client")
+	email := flag.String("email", "sso-user@example.com", "email address suggested on the login form")
+	name := flag.String("name", "SSO User", "name suggested on the login form")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal("Failed to generate signing key:", err)
+	}
+	s := &server{
+		issuer:       strings.TrimSuffix(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		key:          key,
+		codes:        make(map[string]authCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		s.showLogin(w, r, *email, *name)
+	})
+	mux.HandleFunc("POST /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+
+	log.Printf("MockIdP: Issuer %s listening on %s", s.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (s *server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (s *server) jwks(w http.ResponseWriter, r *http.Request) {
+	public := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *server) showLogin(w http.ResponseWriter, r *http.Request, email, name string) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.clientID || q.Get("response_type") != "code" || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	params := map[string]string{}
+	for _, name := range []string{"redirect_uri", "state", "nonce", "code_challenge"} {
+		params[name] = q.Get(name)
+	}
+	err := loginPage.Execute(w, map[string]any{
+		"ClientID": s.clientID,
+		"Params":   params,
+		"Email":    email,
+		"Name":     name,
+	})
+	if err != nil {
+		log.Printf("MockIdP: Failed to render login page: %v", err)
+	}
+}
+
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.PostForm.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := redirectURI.Query()
+	q.Set("state", r.PostForm.Get("state"))
+
+	if r.PostForm.Get("action") == "deny" {
+		q.Set("error", "access_denied")
+		redirectURI.RawQuery = q.Encode()
+		http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+		return
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = authCode{
+		redirectURI:   r.PostForm.Get("redirect_uri"),
+		challenge:     r.PostForm.Get("code_challenge"),
+		nonce:         r.PostForm.Get("nonce"),
+		email:         r.PostForm.Get("email"),
+		name:          r.PostForm.Get("name"),
+		emailVerified: r.PostForm.Get("email_verified") == "true",
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	s.mu.Unlock()
+	log.Printf("MockIdP: Issued code for %s", r.PostForm.Get("email"))
+
+	q.Set("code", code)
+	redirectURI.RawQuery = q.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID != s.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.clientSecret)) != 1 {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	// Codes are single-use
+	s.mu.Lock()
+	code, found := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+	if !found || time.Now().After(code.expiresAt) || code.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	subject := sha256.Sum256([]byte(strings.ToLower(code.email)))
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                s.issuer,
+		"sub":                hex.EncodeToString(subject[:8]),
+		"aud":                s.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              code.nonce,
+		"email":              code.email,
+		"email_verified":     code.emailVerified,
+		"name":               code.name,
+		"preferred_username": strings.SplitN(code.email, "@", 2)[0],
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(s.key)
+	if err != nil {
+		log.Printf("MockIdP: Failed to sign ID token: %v", err)
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Failed to read random bytes:", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
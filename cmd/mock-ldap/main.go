@@ -0,0 +1,53 @@
+// Command mock-ldap is a tiny in-memory LDAP server for trying out the ldap
+// auth backend locally. It supports simple bind and search, without TLS, so
+// it must never be exposed to a network.
+//
+//	go run ./cmd/mock-ldap -addr :3389 -user jdoe:secret:jdoe@example.com
+//
+// and configure ldap.url ldap://localhost:3389, ldap.base_dn
+// dc=example,dc=com, ldap.bind_dn cn=admin,dc=example,dc=com and
+// ldap.bind_password admin.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"strings"
+
+	"todo-app/ldap/ldaptest"
+)
+
+type userFlag []string
+
+func (u *userFlag) String() string     { return strings.Join(*u, ",") }
+func (u *userFlag) Set(v string) error { *u = append(*u, v); return nil }
+
+func main() {
+	addr := flag.String("addr", ":3389", "address to listen on")
+	bindDN := flag.String("bind-dn", "cn=admin,dc=example,dc=com", "service account DN")
+	bindPassword := flag.String("bind-password", "admin", "service account password")
+	var users userFlag
+	flag.Var(&users, "user", "uid:password:email of a user, may be repeated (default jdoe:secret:jdoe@example.com)")
+	flag.Parse()
+
+	if len(users) == 0 {
+		users = userFlag{"jdoe:secret:jdoe@example.com"}
+	}
+	var entries []ldaptest.User
+	for _, spec := range users {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) != 3 {
+			log.Fatalf("invalid -user %q, want uid:password:email", spec)
+		}
+		entries = append(entries, ldaptest.User{UID: parts[0], Password: parts[1], Email: parts[2]})
+	}
+	dir := ldaptest.NewDirectory(*bindDN, *bindPassword, entries...)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal("Failed to listen:", err)
+	}
+	log.Printf("MockLDAP: Serving %d users on %s", dir.Len(), *addr)
+	log.Fatal(dir.Serve(listener))
+}
@@ -0,0 +1,925 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultJWTSecret is the development-only secret the application used to
+// ship with. It is still accepted outside of production so a fresh
+// checkout keeps working, but Load refuses it when Env is "production".
+const DefaultJWTSecret = "your-secret-key"
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+type Config struct {
+	Env       string          `yaml:"env" toml:"env"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Account   AccountConfig   `yaml:"account" toml:"account"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Password  PasswordConfig  `yaml:"password" toml:"password"`
+	Todos     TodosConfig     `yaml:"todos" toml:"todos"`
+	Mail      MailConfig      `yaml:"mail" toml:"mail"`
+	OIDC      OIDCConfig      `yaml:"oidc" toml:"oidc"`
+	LDAP      LDAPConfig      `yaml:"ldap" toml:"ldap"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr" toml:"addr"`
+	// BaseURL is the public address of the application, used to build links
+	// in outgoing email.
+	BaseURL        string   `yaml:"base_url" toml:"base_url"`
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+}
+
+type DatabaseConfig struct {
+	Path string `yaml:"path" toml:"path"`
+}
+
+type AuthConfig struct {
+	// JWTSecret is the master secret HS256 signing keys are derived from. It
+	// also encrypts stored asymmetric keys and TOTP secrets and signs CSRF
+	// tokens.
+	JWTSecret       string   `yaml:"jwt_secret" toml:"jwt_secret"`
+	AccessTokenTTL  Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	RefreshTokenTTL Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+	SecureCookies   bool     `yaml:"secure_cookies" toml:"secure_cookies"`
+
+	// Backends are the AuthBackend* password checkers tried in order on
+	// login; the first one that accepts the credentials wins.
+	Backends []string `yaml:"backends" toml:"backends"`
+	// AdminUsers are usernames given the admin role at startup, which is how
+	// the first admin is created. Removing a name does not demote the user.
+	AdminUsers []string `yaml:"admin_users" toml:"admin_users"`
+
+	PasswordResetTTL Duration `yaml:"password_reset_ttl" toml:"password_reset_ttl"`
+
+	// EmailVerification is one of the EmailVerification* policies.
+	EmailVerification          string   `yaml:"email_verification" toml:"email_verification"`
+	EmailVerificationTTL       Duration `yaml:"email_verification_ttl" toml:"email_verification_ttl"`
+	VerificationResendInterval Duration `yaml:"verification_resend_interval" toml:"verification_resend_interval"`
+
+	// SigningAlgorithm is one of the Algorithm* constants.
+	SigningAlgorithm string `yaml:"signing_algorithm" toml:"signing_algorithm"`
+	// KeyRotationInterval is how long a signing key is used before a new one
+	// replaces it; zero disables rotation. Replaced keys keep verifying
+	// tokens for KeyGracePeriod.
+	KeyRotationInterval Duration `yaml:"key_rotation_interval" toml:"key_rotation_interval"`
+	KeyGracePeriod      Duration `yaml:"key_grace_period" toml:"key_grace_period"`
+	// Issuer and Audience are written to and required in the iss and aud
+	// claims. Issuer defaults to server.base_url.
+	Issuer   string `yaml:"issuer" toml:"issuer"`
+	Audience string `yaml:"audience" toml:"audience"`
+
+	// TOTPIssuer is the account label shown in authenticator apps.
+	TOTPIssuer string `yaml:"totp_issuer" toml:"totp_issuer"`
+	// MFATokenTTL is how long a password-verified login may wait for its
+	// second factor.
+	MFATokenTTL Duration `yaml:"mfa_token_ttl" toml:"mfa_token_ttl"`
+}
+
+type AccountConfig struct {
+	// DeletionGracePeriod is how long a deleted account can still be
+	// restored by logging in before it is purged for good.
+	DeletionGracePeriod Duration `yaml:"deletion_grace_period" toml:"deletion_grace_period"`
+	PurgeInterval       Duration `yaml:"purge_interval" toml:"purge_interval"`
+	// AuditRetention is how long security log entries are kept. Zero keeps
+	// them forever.
+	AuditRetention Duration `yaml:"audit_retention" toml:"audit_retention"`
+}
+
+// TodosConfig controls todo reminders and subtasks.
+type TodosConfig struct {
+	// ReminderInterval is how often reminders that have come due are sent;
+	// zero disables reminders.
+	ReminderInterval Duration `yaml:"reminder_interval" toml:"reminder_interval"`
+	// ReminderNotifier is one of the Notifier* ways of delivering them.
+	ReminderNotifier string `yaml:"reminder_notifier" toml:"reminder_notifier"`
+	// SubtaskDepth is how many levels deep todos can nest, counting the
+	// top-level todo; 1 turns subtasks off.
+	SubtaskDepth int `yaml:"subtask_depth" toml:"subtask_depth"`
+	// ParentCompletion is one of the ParentCompletion* ways of completing a
+	// todo whose subtasks are still open.
+	ParentCompletion string `yaml:"parent_completion" toml:"parent_completion"`
+}
+
+// RateLimitConfig protects the login endpoint against password guessing and
+// the password reset endpoint against being used to flood mailboxes.
+type RateLimitConfig struct {
+	// LoginIPAttempts and LoginAccountAttempts cap the failed logins allowed
+	// from one IP address and against one username within LoginWindow.
+	LoginIPAttempts      int      `yaml:"login_ip_attempts" toml:"login_ip_attempts"`
+	LoginAccountAttempts int      `yaml:"login_account_attempts" toml:"login_account_attempts"`
+	LoginWindow          Duration `yaml:"login_window" toml:"login_window"`
+
+	// After LockoutThreshold consecutive failures the account is locked for
+	// LockoutDuration, doubling with every further failure up to
+	// LockoutMaxDuration.
+	LockoutThreshold   int      `yaml:"lockout_threshold" toml:"lockout_threshold"`
+	LockoutDuration    Duration `yaml:"lockout_duration" toml:"lockout_duration"`
+	LockoutMaxDuration Duration `yaml:"lockout_max_duration" toml:"lockout_max_duration"`
+
+	// PasswordResetIPAttempts caps the password reset requests allowed from
+	// one IP address within LoginWindow.
+	PasswordResetIPAttempts int `yaml:"password_reset_ip_attempts" toml:"password_reset_ip_attempts"`
+}
+
+// PasswordConfig is the policy new passwords must meet on registration,
+// password change and reset.
+type PasswordConfig struct {
+	// MinLength counts characters and MaxBytes UTF-8 bytes, as bcrypt
+	// ignores everything past the 72nd byte. Argon2id has no such limit.
+	MinLength int `yaml:"min_length" toml:"min_length"`
+	MaxBytes  int `yaml:"max_bytes" toml:"max_bytes"`
+	// MinClasses is how many of lowercase letters, uppercase letters,
+	// digits and other characters a password must mix.
+	MinClasses int `yaml:"min_classes" toml:"min_classes"`
+	// RejectPersonalInfo refuses passwords containing the username or the
+	// email address.
+	RejectPersonalInfo bool `yaml:"reject_personal_info" toml:"reject_personal_info"`
+	// BreachedList refuses passwords found in a list of SHA-1 hashes of
+	// breached passwords: either a file with one HASH[:COUNT] per line, or
+	// a directory of Have I Been Pwned range files named by the first five
+	// hex digits of the hash, each holding SUFFIX:COUNT lines. Empty
+	// disables the check.
+	BreachedList string `yaml:"breached_list" toml:"breached_list"`
+	// Hash is how passwords are stored.
+	Hash PasswordHashConfig `yaml:"hash" toml:"hash"`
+}
+
+// PasswordHashConfig chooses the hash new passwords are stored with.
+// Passwords stored with another algorithm or weaker parameters keep working
+// and are rehashed on the user's next login.
+type PasswordHashConfig struct {
+	// Algorithm is "argon2id" or "bcrypt".
+	Algorithm  string `yaml:"algorithm" toml:"algorithm"`
+	BcryptCost int    `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+	// Argon2Memory is in KiB; Argon2Iterations is the number of passes over
+	// it and Argon2Parallelism the number of threads.
+	Argon2Memory      int `yaml:"argon2_memory" toml:"argon2_memory"`
+	Argon2Iterations  int `yaml:"argon2_iterations" toml:"argon2_iterations"`
+	Argon2Parallelism int `yaml:"argon2_parallelism" toml:"argon2_parallelism"`
+}
+
+// OIDCConfig lists the OpenID Connect identity providers users can sign in
+// with instead of a password.
+type OIDCConfig struct {
+	Providers []OIDCProvider `yaml:"providers" toml:"providers"`
+}
+
+type OIDCProvider struct {
+	// ID identifies the provider in URLs, e.g. /auth/oidc/<id>.
+	ID string `yaml:"id" toml:"id"`
+	// Name is shown on the "Sign in with ..." button.
+	Name string `yaml:"name" toml:"name"`
+	// Issuer is the provider's issuer URL; its discovery document is read
+	// from <issuer>/.well-known/openid-configuration.
+	Issuer       string `yaml:"issuer" toml:"issuer"`
+	ClientID     string `yaml:"client_id" toml:"client_id"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret"`
+	// Scopes requested besides "openid"; defaults to email and profile.
+	Scopes []string `yaml:"scopes" toml:"scopes"`
+	// AllowSignup creates an account on first sign-in for a verified email
+	// address that has none yet. Without it only existing accounts can use
+	// the provider.
+	AllowSignup bool `yaml:"allow_signup" toml:"allow_signup"`
+}
+
+// LDAPConfig is the directory the "ldap" auth backend binds against.
+type LDAPConfig struct {
+	// URL is ldap://host[:port] or ldaps://host[:port].
+	URL string `yaml:"url" toml:"url"`
+	// StartTLS upgrades an ldap:// connection to TLS before binding.
+	StartTLS           bool `yaml:"start_tls" toml:"start_tls"`
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+	// BindDN and BindPassword are the service account used to look users
+	// up; leave both empty to search anonymously.
+	BindDN       string `yaml:"bind_dn" toml:"bind_dn"`
+	BindPassword string `yaml:"bind_password" toml:"bind_password"`
+	// BaseDN is where users are searched for, by UserAttribute equal to the
+	// login name and, if set, ObjectClass.
+	BaseDN        string `yaml:"base_dn" toml:"base_dn"`
+	UserAttribute string `yaml:"user_attribute" toml:"user_attribute"`
+	ObjectClass   string `yaml:"object_class" toml:"object_class"`
+	// EmailAttribute holds the address given to accounts created on first
+	// login.
+	EmailAttribute string   `yaml:"email_attribute" toml:"email_attribute"`
+	Timeout        Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// Auth backends.
+const (
+	AuthBackendLocal = "local"
+	AuthBackendLDAP  = "ldap"
+)
+
+// Password hash algorithms.
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+)
+
+// Longest password accepted with a hash that reads all of it. Hashing cost
+// must not grow with what a client chooses to send.
+const (
+	BcryptMaxBytes   = 72
+	PasswordMaxBytes = 1024
+)
+
+// Token signing algorithms.
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Email verification policies.
+const (
+	// EmailVerificationOff never sends verification emails.
+	EmailVerificationOff = "off"
+	// EmailVerificationRestricted lets unverified accounts log in but keeps
+	// them out of features that send notifications or share data.
+	EmailVerificationRestricted = "restricted"
+	// EmailVerificationRequired refuses to log in unverified accounts.
+	EmailVerificationRequired = "required"
+)
+
+// Reminder notifiers.
+const (
+	// NotifierMail emails the owner of the todo.
+	NotifierMail = "mail"
+	// NotifierLog only writes reminders to the log.
+	NotifierLog = "log"
+)
+
+// Ways of completing a todo with open subtasks.
+const (
+	// ParentCompletionAllow completes the todo and leaves its subtasks.
+	ParentCompletionAllow = "allow"
+	// ParentCompletionBlock refuses until the subtasks are done.
+	ParentCompletionBlock = "block"
+	// ParentCompletionCascade completes the subtasks along with the todo.
+	ParentCompletionCascade = "cascade"
+)
+
+const (
+	MailDriverLog  = "log"
+	MailDriverSMTP = "smtp"
+)
+
+type MailConfig struct {
+	// Driver is "log" to print messages (and optionally save them to Dir)
+	// or "smtp" to deliver them through SMTP.
+	Driver string     `yaml:"driver" toml:"driver"`
+	From   string     `yaml:"from" toml:"from"`
+	Dir    string     `yaml:"dir" toml:"dir"`
+	SMTP   SMTPConfig `yaml:"smtp" toml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// Duration is a time.Duration that can be written as "15m" or "24h" in
+// config files and environment variables.
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Default returns the settings the application used before it was
+// configurable.
+func Default() *Config {
+	return &Config{
+		Env: EnvDevelopment,
+		Server: ServerConfig{
+			Addr:           ":8080",
+			BaseURL:        "http://localhost:8080",
+			AllowedOrigins: []string{"http://localhost:8080"},
+		},
+		Database: DatabaseConfig{
+			Path: "./todos.db",
+		},
+		Auth: AuthConfig{
+			JWTSecret:       DefaultJWTSecret,
+			AccessTokenTTL:  Duration(15 * time.Minute),
+			RefreshTokenTTL: Duration(30 * 24 * time.Hour),
+			Backends:        []string{AuthBackendLocal},
+
+			PasswordResetTTL: Duration(time.Hour),
+
+			EmailVerification:          EmailVerificationRestricted,
+			EmailVerificationTTL:       Duration(48 * time.Hour),
+			VerificationResendInterval: Duration(5 * time.Minute),
+
+			SigningAlgorithm:    AlgorithmHS256,
+			KeyRotationInterval: Duration(30 * 24 * time.Hour),
+			KeyGracePeriod:      Duration(24 * time.Hour),
+			Audience:            "todo-app",
+
+			TOTPIssuer:  "Todo List",
+			MFATokenTTL: Duration(5 * time.Minute),
+		},
+		Account: AccountConfig{
+			DeletionGracePeriod: Duration(14 * 24 * time.Hour),
+			PurgeInterval:       Duration(time.Hour),
+			AuditRetention:      Duration(90 * 24 * time.Hour),
+		},
+		Todos: TodosConfig{
+			ReminderInterval: Duration(time.Minute),
+			ReminderNotifier: NotifierMail,
+			SubtaskDepth:     3,
+			ParentCompletion: ParentCompletionAllow,
+		},
+		RateLimit: RateLimitConfig{
+			LoginIPAttempts:      20,
+			LoginAccountAttempts: 10,
+			LoginWindow:          Duration(15 * time.Minute),
+			LockoutThreshold:     5,
+			LockoutDuration:      Duration(time.Minute),
+			LockoutMaxDuration:   Duration(time.Hour),
+
+			PasswordResetIPAttempts: 5,
+		},
+		Password: PasswordConfig{
+			MinLength:          8,
+			MaxBytes:           72,
+			RejectPersonalInfo: true,
+			// Argon2id with the parameters OWASP recommends as a minimum
+			Hash: PasswordHashConfig{
+				Algorithm:         PasswordHashArgon2id,
+				BcryptCost:        10,
+				Argon2Memory:      19 * 1024,
+				Argon2Iterations:  2,
+				Argon2Parallelism: 1,
+			},
+		},
+		LDAP: LDAPConfig{
+			UserAttribute:  "uid",
+			ObjectClass:    "person",
+			EmailAttribute: "mail",
+			Timeout:        Duration(10 * time.Second),
+		},
+		Mail: MailConfig{
+			Driver: MailDriverLog,
+			From:   "Todo List <no-reply@localhost>",
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the optional config file at
+// path (YAML or TOML, chosen by extension) and TODO_* environment variables,
+// in that order of precedence, and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+		log.Printf("Config: Loaded settings from %s", path)
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Auth.Issuer == "" {
+		cfg.Auth.Issuer = cfg.Server.BaseURL
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("config: unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	if v, ok := os.LookupEnv("TODO_ENV"); ok {
+		c.Env = v
+	}
+	if v, ok := os.LookupEnv("TODO_ADDR"); ok {
+		c.Server.Addr = v
+	}
+	if v, ok := os.LookupEnv("TODO_BASE_URL"); ok {
+		c.Server.BaseURL = v
+	}
+	if v, ok := os.LookupEnv("TODO_ALLOWED_ORIGINS"); ok {
+		c.Server.AllowedOrigins = splitList(v)
+	}
+	if v, ok := os.LookupEnv("TODO_DB_PATH"); ok {
+		c.Database.Path = v
+	}
+	if v, ok := os.LookupEnv("TODO_JWT_SECRET"); ok {
+		c.Auth.JWTSecret = v
+	}
+	if v, ok := os.LookupEnv("TODO_ACCESS_TOKEN_TTL"); ok {
+		if err := c.Auth.AccessTokenTTL.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_ACCESS_TOKEN_TTL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_REFRESH_TOKEN_TTL"); ok {
+		if err := c.Auth.RefreshTokenTTL.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_REFRESH_TOKEN_TTL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_DELETION_GRACE_PERIOD"); ok {
+		if err := c.Account.DeletionGracePeriod.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_DELETION_GRACE_PERIOD: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_PURGE_INTERVAL"); ok {
+		if err := c.Account.PurgeInterval.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_PURGE_INTERVAL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_AUDIT_RETENTION"); ok {
+		if err := c.Account.AuditRetention.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_AUDIT_RETENTION: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_PASSWORD_RESET_TTL"); ok {
+		if err := c.Auth.PasswordResetTTL.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_PASSWORD_RESET_TTL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_EMAIL_VERIFICATION"); ok {
+		c.Auth.EmailVerification = v
+	}
+	if v, ok := os.LookupEnv("TODO_EMAIL_VERIFICATION_TTL"); ok {
+		if err := c.Auth.EmailVerificationTTL.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_EMAIL_VERIFICATION_TTL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_VERIFICATION_RESEND_INTERVAL"); ok {
+		if err := c.Auth.VerificationResendInterval.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_VERIFICATION_RESEND_INTERVAL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_JWT_ALGORITHM"); ok {
+		c.Auth.SigningAlgorithm = v
+	}
+	if v, ok := os.LookupEnv("TODO_KEY_ROTATION_INTERVAL"); ok {
+		if err := c.Auth.KeyRotationInterval.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_KEY_ROTATION_INTERVAL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_KEY_GRACE_PERIOD"); ok {
+		if err := c.Auth.KeyGracePeriod.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_KEY_GRACE_PERIOD: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_JWT_ISSUER"); ok {
+		c.Auth.Issuer = v
+	}
+	if v, ok := os.LookupEnv("TODO_JWT_AUDIENCE"); ok {
+		c.Auth.Audience = v
+	}
+	if v, ok := os.LookupEnv("TODO_TOTP_ISSUER"); ok {
+		c.Auth.TOTPIssuer = v
+	}
+	if v, ok := os.LookupEnv("TODO_MFA_TOKEN_TTL"); ok {
+		if err := c.Auth.MFATokenTTL.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: TODO_MFA_TOKEN_TTL: %w", err)
+		}
+	}
+	for _, setting := range []struct {
+		env string
+		dst *int
+	}{
+		{"TODO_LOGIN_IP_ATTEMPTS", &c.RateLimit.LoginIPAttempts},
+		{"TODO_LOGIN_ACCOUNT_ATTEMPTS", &c.RateLimit.LoginAccountAttempts},
+		{"TODO_LOCKOUT_THRESHOLD", &c.RateLimit.LockoutThreshold},
+		{"TODO_PASSWORD_RESET_IP_ATTEMPTS", &c.RateLimit.PasswordResetIPAttempts},
+		{"TODO_PASSWORD_MIN_LENGTH", &c.Password.MinLength},
+		{"TODO_PASSWORD_MIN_CLASSES", &c.Password.MinClasses},
+		{"TODO_BCRYPT_COST", &c.Password.Hash.BcryptCost},
+		{"TODO_ARGON2_MEMORY", &c.Password.Hash.Argon2Memory},
+		{"TODO_ARGON2_ITERATIONS", &c.Password.Hash.Argon2Iterations},
+		{"TODO_ARGON2_PARALLELISM", &c.Password.Hash.Argon2Parallelism},
+		{"TODO_SUBTASK_DEPTH", &c.Todos.SubtaskDepth},
+	} {
+		if v, ok := os.LookupEnv(setting.env); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("config: %s: %w", setting.env, err)
+			}
+			*setting.dst = n
+		}
+	}
+	for _, setting := range []struct {
+		env string
+		dst *Duration
+	}{
+		{"TODO_LOGIN_WINDOW", &c.RateLimit.LoginWindow},
+		{"TODO_LOCKOUT_DURATION", &c.RateLimit.LockoutDuration},
+		{"TODO_LOCKOUT_MAX_DURATION", &c.RateLimit.LockoutMaxDuration},
+		{"TODO_REMINDER_INTERVAL", &c.Todos.ReminderInterval},
+	} {
+		if v, ok := os.LookupEnv(setting.env); ok {
+			if err := setting.dst.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("config: %s: %w", setting.env, err)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("TODO_AUTH_BACKENDS"); ok {
+		c.Auth.Backends = splitList(v)
+	}
+	if v, ok := os.LookupEnv("TODO_BREACHED_PASSWORDS"); ok {
+		c.Password.BreachedList = v
+	}
+	if v, ok := os.LookupEnv("TODO_PASSWORD_HASH"); ok {
+		c.Password.Hash.Algorithm = v
+	}
+	if v, ok := os.LookupEnv("TODO_REMINDER_NOTIFIER"); ok {
+		c.Todos.ReminderNotifier = v
+	}
+	if v, ok := os.LookupEnv("TODO_PARENT_COMPLETION"); ok {
+		c.Todos.ParentCompletion = v
+	}
+	if v, ok := os.LookupEnv("TODO_ADMIN_USERS"); ok {
+		c.Auth.AdminUsers = splitList(v)
+	}
+	if v, ok := os.LookupEnv("TODO_LDAP_URL"); ok {
+		c.LDAP.URL = v
+	}
+	if v, ok := os.LookupEnv("TODO_LDAP_BIND_DN"); ok {
+		c.LDAP.BindDN = v
+	}
+	if v, ok := os.LookupEnv("TODO_LDAP_BIND_PASSWORD"); ok {
+		c.LDAP.BindPassword = v
+	}
+	if v, ok := os.LookupEnv("TODO_LDAP_BASE_DN"); ok {
+		c.LDAP.BaseDN = v
+	}
+	if v, ok := os.LookupEnv("TODO_LDAP_START_TLS"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("config: TODO_LDAP_START_TLS: %w", err)
+		}
+		c.LDAP.StartTLS = b
+	}
+	if v, ok := os.LookupEnv("TODO_MAIL_DRIVER"); ok {
+		c.Mail.Driver = v
+	}
+	if v, ok := os.LookupEnv("TODO_MAIL_FROM"); ok {
+		c.Mail.From = v
+	}
+	if v, ok := os.LookupEnv("TODO_MAIL_DIR"); ok {
+		c.Mail.Dir = v
+	}
+	if v, ok := os.LookupEnv("TODO_SMTP_HOST"); ok {
+		c.Mail.SMTP.Host = v
+	}
+	if v, ok := os.LookupEnv("TODO_SMTP_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: TODO_SMTP_PORT: %w", err)
+		}
+		c.Mail.SMTP.Port = port
+	}
+	if v, ok := os.LookupEnv("TODO_SMTP_USERNAME"); ok {
+		c.Mail.SMTP.Username = v
+	}
+	if v, ok := os.LookupEnv("TODO_SMTP_PASSWORD"); ok {
+		c.Mail.SMTP.Password = v
+	}
+	if v, ok := os.LookupEnv("TODO_SECURE_COOKIES"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("config: TODO_SECURE_COOKIES: %w", err)
+		}
+		c.Auth.SecureCookies = b
+	}
+	return nil
+}
+
+// Validate reports every problem with the configuration at once so an
+// operator can fix them in a single pass.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Env {
+	case EnvDevelopment, EnvProduction:
+	default:
+		errs = append(errs, fmt.Errorf("env must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env))
+	}
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr must not be empty"))
+	}
+	if c.Database.Path == "" {
+		errs = append(errs, errors.New("database.path must not be empty"))
+	}
+
+	if c.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("auth.jwt_secret must not be empty"))
+	}
+	if c.IsProduction() {
+		if c.Auth.JWTSecret == DefaultJWTSecret {
+			errs = append(errs, errors.New("auth.jwt_secret must be changed from the default in production"))
+		} else if len(c.Auth.JWTSecret) < 32 {
+			errs = append(errs, errors.New("auth.jwt_secret must be at least 32 bytes in production"))
+		}
+	} else if c.Auth.JWTSecret == DefaultJWTSecret {
+		log.Printf("Config: WARNING: using the default JWT secret; set TODO_JWT_SECRET before deploying")
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.access_token_ttl must be positive"))
+	}
+	if c.Auth.RefreshTokenTTL < c.Auth.AccessTokenTTL {
+		errs = append(errs, errors.New("auth.refresh_token_ttl must not be shorter than auth.access_token_ttl"))
+	}
+
+	if len(c.Auth.Backends) == 0 {
+		errs = append(errs, errors.New("auth.backends must not be empty"))
+	}
+	seenBackends := make(map[string]bool)
+	for _, backend := range c.Auth.Backends {
+		switch {
+		case backend != AuthBackendLocal && backend != AuthBackendLDAP:
+			errs = append(errs, fmt.Errorf("auth.backends entries must be %q or %q, got %q", AuthBackendLocal, AuthBackendLDAP, backend))
+		case seenBackends[backend]:
+			errs = append(errs, fmt.Errorf("auth.backends lists %q twice", backend))
+		}
+		seenBackends[backend] = true
+	}
+	if seenBackends[AuthBackendLDAP] {
+		errs = append(errs, c.LDAP.validate(c.IsProduction())...)
+	}
+
+	if c.Auth.PasswordResetTTL <= 0 {
+		errs = append(errs, errors.New("auth.password_reset_ttl must be positive"))
+	}
+	switch c.Auth.EmailVerification {
+	case EmailVerificationOff, EmailVerificationRestricted, EmailVerificationRequired:
+	default:
+		errs = append(errs, fmt.Errorf("auth.email_verification must be %q, %q or %q, got %q",
+			EmailVerificationOff, EmailVerificationRestricted, EmailVerificationRequired, c.Auth.EmailVerification))
+	}
+	if c.Auth.EmailVerificationTTL <= 0 {
+		errs = append(errs, errors.New("auth.email_verification_ttl must be positive"))
+	}
+	if c.Auth.VerificationResendInterval < 0 {
+		errs = append(errs, errors.New("auth.verification_resend_interval must not be negative"))
+	}
+	switch c.Auth.SigningAlgorithm {
+	case AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		errs = append(errs, fmt.Errorf("auth.signing_algorithm must be %q, %q or %q, got %q",
+			AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA, c.Auth.SigningAlgorithm))
+	}
+	if c.Auth.KeyRotationInterval < 0 {
+		errs = append(errs, errors.New("auth.key_rotation_interval must not be negative"))
+	}
+	// Tokens signed just before a rotation must stay verifiable until they
+	// expire
+	if c.Auth.KeyGracePeriod < c.Auth.AccessTokenTTL || c.Auth.KeyGracePeriod < c.Auth.MFATokenTTL {
+		errs = append(errs, errors.New("auth.key_grace_period must not be shorter than auth.access_token_ttl or auth.mfa_token_ttl"))
+	}
+	if c.Auth.Audience == "" {
+		errs = append(errs, errors.New("auth.audience must not be empty"))
+	}
+	if c.Auth.TOTPIssuer == "" {
+		errs = append(errs, errors.New("auth.totp_issuer must not be empty"))
+	}
+	if c.Auth.MFATokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.mfa_token_ttl must be positive"))
+	}
+
+	if c.RateLimit.LoginIPAttempts <= 0 || c.RateLimit.LoginAccountAttempts <= 0 {
+		errs = append(errs, errors.New("rate_limit.login_ip_attempts and rate_limit.login_account_attempts must be positive"))
+	}
+	if c.RateLimit.LoginWindow <= 0 {
+		errs = append(errs, errors.New("rate_limit.login_window must be positive"))
+	}
+	if c.RateLimit.LockoutThreshold <= 0 {
+		errs = append(errs, errors.New("rate_limit.lockout_threshold must be positive"))
+	}
+	if c.RateLimit.LockoutDuration <= 0 || c.RateLimit.LockoutMaxDuration < c.RateLimit.LockoutDuration {
+		errs = append(errs, errors.New("rate_limit.lockout_duration must be positive and not longer than rate_limit.lockout_max_duration"))
+	}
+	if c.RateLimit.PasswordResetIPAttempts <= 0 {
+		errs = append(errs, errors.New("rate_limit.password_reset_ip_attempts must be positive"))
+	}
+	if c.Server.BaseURL == "" {
+		errs = append(errs, errors.New("server.base_url must not be empty"))
+	}
+
+	if c.Password.MinLength < 1 {
+		errs = append(errs, errors.New("password.min_length must be positive"))
+	}
+	maxBytes := PasswordMaxBytes
+	if c.Password.Hash.Algorithm == PasswordHashBcrypt {
+		maxBytes = BcryptMaxBytes
+	}
+	if c.Password.MaxBytes < c.Password.MinLength || c.Password.MaxBytes > maxBytes {
+		errs = append(errs, fmt.Errorf("password.max_bytes must be at least password.min_length and at most %d with %s", maxBytes, c.Password.Hash.Algorithm))
+	}
+	if c.Password.MinClasses < 0 || c.Password.MinClasses > 4 {
+		errs = append(errs, errors.New("password.min_classes must be between 0 and 4"))
+	}
+	errs = append(errs, c.Password.Hash.validate()...)
+
+	switch c.Mail.Driver {
+	case MailDriverLog:
+		if c.IsProduction() {
+			log.Printf("Config: WARNING: mail.driver is %q, emails will only be logged", MailDriverLog)
+		}
+	case MailDriverSMTP:
+		if c.Mail.SMTP.Host == "" || c.Mail.SMTP.Port <= 0 {
+			errs = append(errs, errors.New("mail.smtp.host and mail.smtp.port are required for the smtp driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver must be %q or %q, got %q", MailDriverLog, MailDriverSMTP, c.Mail.Driver))
+	}
+	if c.Mail.From == "" {
+		errs = append(errs, errors.New("mail.from must not be empty"))
+	}
+
+	seenProviders := make(map[string]bool)
+	for i, p := range c.OIDC.Providers {
+		switch {
+		case !validProviderID(p.ID):
+			errs = append(errs, fmt.Errorf("oidc.providers[%d].id must be lowercase letters, digits and dashes, got %q", i, p.ID))
+		case seenProviders[p.ID]:
+			errs = append(errs, fmt.Errorf("oidc.providers[%d].id %q is used twice", i, p.ID))
+		}
+		seenProviders[p.ID] = true
+		if p.Name == "" || p.Issuer == "" || p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("oidc.providers[%d]: name, issuer and client_id are required", i))
+		}
+		if c.IsProduction() && !strings.HasPrefix(p.Issuer, "https://") {
+			errs = append(errs, fmt.Errorf("oidc.providers[%d].issuer must use https in production", i))
+		}
+	}
+
+	if c.Account.DeletionGracePeriod < 0 {
+		errs = append(errs, errors.New("account.deletion_grace_period must not be negative"))
+	}
+	if c.Account.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("account.purge_interval must be positive"))
+	}
+	if c.Account.AuditRetention < 0 {
+		errs = append(errs, errors.New("account.audit_retention must not be negative"))
+	}
+
+	if c.Todos.ReminderInterval < 0 {
+		errs = append(errs, errors.New("todos.reminder_interval must not be negative"))
+	}
+	switch c.Todos.ReminderNotifier {
+	case NotifierMail, NotifierLog:
+	default:
+		errs = append(errs, fmt.Errorf("todos.reminder_notifier must be %q or %q, got %q", NotifierMail, NotifierLog, c.Todos.ReminderNotifier))
+	}
+	if c.Todos.SubtaskDepth < 1 {
+		errs = append(errs, errors.New("todos.subtask_depth must be at least 1"))
+	}
+	switch c.Todos.ParentCompletion {
+	case ParentCompletionAllow, ParentCompletionBlock, ParentCompletionCascade:
+	default:
+		errs = append(errs, fmt.Errorf("todos.parent_completion must be %q, %q or %q, got %q",
+			ParentCompletionAllow, ParentCompletionBlock, ParentCompletionCascade, c.Todos.ParentCompletion))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (h PasswordHashConfig) validate() []error {
+	var errs []error
+	switch h.Algorithm {
+	case PasswordHashArgon2id, PasswordHashBcrypt:
+	default:
+		errs = append(errs, fmt.Errorf("password.hash.algorithm must be %q or %q, got %q", PasswordHashArgon2id, PasswordHashBcrypt, h.Algorithm))
+	}
+	// The limits of golang.org/x/crypto/bcrypt
+	if h.BcryptCost < 4 || h.BcryptCost > 31 {
+		errs = append(errs, errors.New("password.hash.bcrypt_cost must be between 4 and 31"))
+	}
+	if h.Argon2Iterations < 1 {
+		errs = append(errs, errors.New("password.hash.argon2_iterations must be positive"))
+	}
+	if h.Argon2Parallelism < 1 || h.Argon2Parallelism > 255 {
+		errs = append(errs, errors.New("password.hash.argon2_parallelism must be between 1 and 255"))
+	}
+	// Argon2 needs 8 KiB per thread; more than 4 GiB is surely a typo
+	if h.Argon2Memory < 8*h.Argon2Parallelism || h.Argon2Memory > 4*1024*1024 {
+		errs = append(errs, errors.New("password.hash.argon2_memory must be at least 8 KiB per thread and at most 4 GiB"))
+	}
+	return errs
+}
+
+func (l LDAPConfig) validate(production bool) []error {
+	var errs []error
+	switch {
+	case strings.HasPrefix(l.URL, "ldaps://"):
+		if l.StartTLS {
+			errs = append(errs, errors.New("ldap.start_tls cannot be combined with an ldaps:// URL"))
+		}
+	case strings.HasPrefix(l.URL, "ldap://"):
+		// Passwords would cross the network in the clear
+		if production && !l.StartTLS {
+			errs = append(errs, errors.New("ldap.url must use ldaps:// or ldap.start_tls in production"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("ldap.url must start with ldap:// or ldaps://, got %q", l.URL))
+	}
+	if l.BaseDN == "" || l.UserAttribute == "" || l.EmailAttribute == "" {
+		errs = append(errs, errors.New("ldap.base_dn, ldap.user_attribute and ldap.email_attribute are required"))
+	}
+	if (l.BindDN == "") != (l.BindPassword == "") {
+		errs = append(errs, errors.New("ldap.bind_dn and ldap.bind_password must be set together"))
+	}
+	if l.Timeout <= 0 {
+		errs = append(errs, errors.New("ldap.timeout must be positive"))
+	}
+	return errs
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+func validProviderID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"todo-app/models"
+)
+
+// Personal access token functions
+func CreateAccessToken(token models.PersonalAccessToken) (models.PersonalAccessToken, error) {
+	log.Printf("CreateAccessToken: Creating token %q for user %d", token.Name, token.UserID)
+	var expiresAt any
+	if token.ExpiresAt != nil {
+		expiresAt = token.ExpiresAt.UTC()
+	}
+	result, err := db.Exec(
+		"INSERT INTO personal_access_tokens (user_id, name, prefix, token_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		token.UserID, token.Name, token.Prefix, token.TokenHash, strings.Join(token.Scopes, " "), token.CreatedAt.UTC(), expiresAt,
+	)
+	if err != nil {
+		log.Printf("CreateAccessToken: Database error: %v", err)
+		return models.PersonalAccessToken{}, err
+	}
+	token.ID, err = result.LastInsertId()
+	return token, err
+}
+
+const accessTokenColumns = "id, user_id, name, prefix, token_hash, scopes, created_at, expires_at, last_used_at"
+
+func scanAccessToken(row rowScanner) (models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.TokenHash, &scopes,
+		&token.CreatedAt, &expiresAt, &lastUsedAt)
+	token.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return token, err
+}
+
+// GetAccessTokenByHash returns the unexpired token with the given hash, or
+// sql.ErrNoRows.
+func GetAccessTokenByHash(tokenHash string) (models.PersonalAccessToken, error) {
+	return scanAccessToken(db.QueryRow(
+		"SELECT "+accessTokenColumns+" FROM personal_access_tokens WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > ?)",
+		tokenHash, time.Now().UTC(),
+	))
+}
+
+// GetAccessTokens lists all of the user's tokens, newest first. Expired
+// tokens are included so the user can see and clean them up.
+func GetAccessTokens(userID int64) ([]models.PersonalAccessToken, error) {
+	rows, err := db.Query(
+		"SELECT "+accessTokenColumns+" FROM personal_access_tokens WHERE user_id = ? ORDER BY created_at DESC",
+		userID,
+	)
+	if err != nil {
+		log.Printf("GetAccessTokens: Database error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.PersonalAccessToken
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			log.Printf("GetAccessTokens: Error scanning row: %v", err)
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAccessToken revokes one of the user's tokens and reports whether it
+// existed.
+func DeleteAccessToken(userID, id int64) (bool, error) {
+	log.Printf("DeleteAccessToken: Deleting token %d for user %d", id, userID)
+	result, err := db.Exec("DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Printf("DeleteAccessToken: Database error: %v", err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteUserAccessTokens revokes all of the user's tokens, for when the
+// password changes or is reset, and returns how many there were.
+func DeleteUserAccessTokens(userID int64) (int64, error) {
+	log.Printf("DeleteUserAccessTokens: Deleting all tokens of user %d", userID)
+	result, err := db.Exec("DELETE FROM personal_access_tokens WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("DeleteUserAccessTokens: Database error: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// TouchAccessToken records that the token was used, writing at most once
+// per minInterval.
+func TouchAccessToken(id int64, minInterval time.Duration) error {
+	now := time.Now().UTC()
+	_, err := db.Exec(
+		"UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		now, id, now.Add(-minInterval),
+	)
+	return err
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"todo-app/models"
+)
+
+// ErrLastAdmin is returned when a change would leave no enabled admin.
+var ErrLastAdmin = errors.New("database: cannot remove the last admin")
+
+// ListUsers returns a page of users ordered by ID, together with the total
+// number of users.
+func ListUsers(limit, offset int) ([]models.User, int, error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&total); err != nil {
+		log.Printf("ListUsers: Error counting users: %v", err)
+		return nil, 0, err
+	}
+
+	rows, err := db.Query("SELECT "+userColumns+" FROM users ORDER BY id LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		log.Printf("ListUsers: Error querying users: %v", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			log.Printf("ListUsers: Error scanning user: %v", err)
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// SetUserDisabled disables or re-enables an account. Disabling the last
+// enabled admin fails with ErrLastAdmin.
+func SetUserDisabled(userID int64, disabled bool) error {
+	log.Printf("SetUserDisabled: Setting disabled=%t for user %d", disabled, userID)
+	if !disabled {
+		return updateUser(userID, "UPDATE users SET disabled_at = NULL, updated_at = ? WHERE id = ?", time.Now(), userID)
+	}
+	now := time.Now()
+	return updateUser(userID,
+		"UPDATE users SET disabled_at = COALESCE(disabled_at, ?), updated_at = ? WHERE id = ? AND "+notLastAdmin,
+		now.UTC(), now, userID, userID,
+	)
+}
+
+// SetUserRole changes the role of a user. Demoting the last enabled admin
+// fails with ErrLastAdmin.
+func SetUserRole(userID int64, role string) error {
+	log.Printf("SetUserRole: Setting role %q for user %d", role, userID)
+	if role == models.RoleAdmin {
+		return updateUser(userID, "UPDATE users SET role = ?, updated_at = ? WHERE id = ?", role, time.Now(), userID)
+	}
+	return updateUser(userID,
+		"UPDATE users SET role = ?, updated_at = ? WHERE id = ? AND "+notLastAdmin,
+		role, time.Now(), userID, userID,
+	)
+}
+
+// notLastAdmin is a condition on the user with the bound ID that holds
+// unless they are the only enabled admin.
+const notLastAdmin = `(role != 'admin' OR disabled_at IS NOT NULL OR
+	(SELECT COUNT(*) FROM users WHERE role = 'admin' AND disabled_at IS NULL AND id != ?) > 0)`
+
+// updateUser runs an UPDATE on one user. When it matches no row it tells a
+// missing user (sql.ErrNoRows) apart from one the condition protected
+// (ErrLastAdmin).
+func updateUser(userID int64, query string, args ...any) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		log.Printf("updateUser: Database error: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return ErrLastAdmin
+}
+
+// PromoteAdmins gives the admin role to the named users and returns how many
+// were promoted. Unknown usernames are skipped.
+func PromoteAdmins(usernames []string) (int64, error) {
+	var promoted int64
+	for _, username := range usernames {
+		user, err := GetUserByUsername(username)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("PromoteAdmins: No user named %s", username)
+			continue
+		}
+		if err != nil {
+			log.Printf("PromoteAdmins: Error looking up %s: %v", username, err)
+			return promoted, err
+		}
+		if user.Role == models.RoleAdmin {
+			continue
+		}
+		if err := SetUserRole(user.ID, models.RoleAdmin); err != nil {
+			return promoted, err
+		}
+		log.Printf("PromoteAdmins: Promoted %s to admin", user.Username)
+		promoted++
+	}
+	return promoted, nil
+}
+
+// GetSystemStats counts users, todos, sessions and access tokens.
+func GetSystemStats() (models.SystemStats, error) {
+	var stats models.SystemStats
+	now := time.Now().UTC()
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM users WHERE role = 'admin'),
+			(SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM users WHERE email_verified_at IS NOT NULL),
+			(SELECT COUNT(*) FROM users WHERE totp_enabled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM users WHERE deletion_scheduled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM todos),
+			(SELECT COUNT(*) FROM todos WHERE completed),
+			(SELECT COUNT(*) FROM sessions WHERE revoked_at IS NULL AND expires_at > ?),
+			(SELECT COUNT(*) FROM personal_access_tokens WHERE expires_at IS NULL OR expires_at > ?)`,
+		now, now,
+	).Scan(
+		&stats.Users, &stats.Admins, &stats.DisabledUsers, &stats.VerifiedUsers, &stats.TwoFactorUsers,
+		&stats.PendingDeletions, &stats.Todos, &stats.CompletedTodos, &stats.ActiveSessions, &stats.AccessTokens,
+	)
+	if err != nil {
+		log.Printf("GetSystemStats: Database error: %v", err)
+	}
+	return stats, err
+}
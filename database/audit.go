@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"todo-app/models"
+)
+
+// CreateAuditEvent appends an event to the security log.
+func CreateAuditEvent(event models.AuditEvent) error {
+	var details sql.NullString
+	if len(event.Details) > 0 {
+		encoded, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		details = sql.NullString{String: string(encoded), Valid: true}
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	_, err := db.Exec(
+		"INSERT INTO audit_events (user_id, actor_id, event, ip_address, user_agent, details, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		event.UserID, event.ActorID, event.Event, event.IPAddress, event.UserAgent, details, event.CreatedAt.UTC(),
+	)
+	if err != nil {
+		log.Printf("CreateAuditEvent: Database error: %v", err)
+	}
+	return err
+}
+
+// ListAuditEvents returns a page of the events matching the query, newest
+// first, together with the total number of matches.
+func ListAuditEvents(query models.AuditQuery) ([]models.AuditEvent, int, error) {
+	var where []string
+	var args []any
+	if query.UserID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, query.UserID)
+	}
+	if query.Event != "" {
+		where = append(where, "(event = ? OR substr(event, 1, ?) = ?)")
+		prefix := strings.TrimSuffix(query.Event, ".") + "."
+		args = append(args, query.Event, len(prefix), prefix)
+	}
+	if query.IPAddress != "" {
+		where = append(where, "ip_address = ?")
+		args = append(args, query.IPAddress)
+	}
+	if query.Since != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.Since.UTC())
+	}
+	if query.Until != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, query.Until.UTC())
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_events"+filter, args...).Scan(&total); err != nil {
+		log.Printf("ListAuditEvents: Error counting events: %v", err)
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(
+		"SELECT id, user_id, actor_id, event, ip_address, user_agent, details, created_at FROM audit_events"+
+			filter+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, query.Limit, query.Offset)...,
+	)
+	if err != nil {
+		log.Printf("ListAuditEvents: Error querying events: %v", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var userID, actorID sql.NullInt64
+		var details sql.NullString
+		if err := rows.Scan(&event.ID, &userID, &actorID, &event.Event, &event.IPAddress, &event.UserAgent, &details, &event.CreatedAt); err != nil {
+			log.Printf("ListAuditEvents: Error scanning event: %v", err)
+			return nil, 0, err
+		}
+		if userID.Valid {
+			event.UserID = &userID.Int64
+		}
+		if actorID.Valid {
+			event.ActorID = &actorID.Int64
+		}
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &event.Details); err != nil {
+				log.Printf("ListAuditEvents: Bad details on event %d: %v", event.ID, err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+// PurgeAuditEvents deletes events recorded before the given time and
+// returns how many were deleted.
+func PurgeAuditEvents(before time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM audit_events WHERE created_at < ?", before.UTC())
+	if err != nil {
+		log.Printf("PurgeAuditEvents: Database error: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Close closes the database opened by InitDB.
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	return db.Close()
+}
+
+// Backup writes a consistent copy of the open database to path, which must
+// not exist yet. It is safe to run while the server is serving requests.
+func Backup(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup: %s already exists", path)
+	}
+	log.Printf("Backup: Writing backup to %s", path)
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		log.Printf("Backup: Database error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Restore replaces the database file at dbPath with the backup at
+// backupPath after checking the backup is intact. The server must not be
+// running, and the database must not be open in this process. The schema
+// of an older backup is brought up to date by the next InitDB.
+func Restore(backupPath, dbPath string) error {
+	if err := checkBackup(backupPath); err != nil {
+		return err
+	}
+
+	// Write next to the target and rename, so a failed copy never leaves a
+	// half-written database behind
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dbPath), filepath.Base(dbPath)+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// A leftover journal of the old database must not be replayed into the
+	// restored one
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), dbPath); err != nil {
+		return err
+	}
+	log.Printf("Restore: Restored %s from %s", dbPath, backupPath)
+	return nil
+}
+
+// checkBackup makes sure path is an intact SQLite database of this
+// application.
+func checkBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	backup, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+
+	var result string
+	if err := backup.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("restore: %s is not a readable database: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("restore: %s failed the integrity check: %s", path, result)
+	}
+	var hasUsers bool
+	if err := backup.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'users')").Scan(&hasUsers); err != nil {
+		return err
+	}
+	if !hasUsers {
+		return fmt.Errorf("restore: %s is not a backup of this application", path)
+	}
+	return nil
+}
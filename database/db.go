@@ -2,24 +2,54 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"log"
+	"strings"
 	"time"
 
+	"todo-app/config"
 	"todo-app/models"
-
-	"golang.org/x/crypto/bcrypt"
+	"todo-app/normalize"
+	"todo-app/passwords"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var db *sql.DB
+var (
+	db             *sql.DB
+	passwordHasher = passwords.NewHasher(config.Default().Password.Hash)
+)
+
+// ErrUserExists is returned by CreateUser when the username or email is
+// already taken, compared in normalized form.
+var ErrUserExists = errors.New("database: username or email already taken")
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-func InitDB() error {
+// SetPasswordHasher replaces the hasher new passwords are stored with.
+func SetPasswordHasher(h *passwords.Hasher) {
+	passwordHasher = h
+}
+
+func InitDB(cfg config.DatabaseConfig) error {
 	var err error
-	db, err = sql.Open("sqlite3", "./todos.db")
+	// Foreign keys are a per-connection setting in SQLite, so ask the driver
+	// to enable them on every connection in the pool rather than only the
+	// one that happens to run the PRAGMA below.
+	dsn := cfg.Path
+	if strings.Contains(dsn, "?") {
+		dsn += "&_foreign_keys=on"
+	} else {
+		dsn += "?_foreign_keys=on"
+	}
+	db, err = sql.Open("sqlite3", dsn)
 	if err != nil {
 		return err
 	}
+	log.Printf("InitDB: Opened database at %s", cfg.Path)
 
 	// Enable foreign key constraints
 	_, err = db.Exec("PRAGMA foreign_keys = ON")
@@ -50,7 +80,18 @@ func InitDB() error {
 		email TEXT NOT NULL UNIQUE,
 		password TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		deletion_scheduled_at DATETIME,
+		email_verified_at DATETIME,
+		totp_secret TEXT,
+		totp_enabled_at DATETIME,
+		totp_last_step INTEGER NOT NULL DEFAULT 0,
+		failed_login_count INTEGER NOT NULL DEFAULT 0,
+		locked_until DATETIME,
+		role TEXT NOT NULL DEFAULT 'user',
+		disabled_at DATETIME,
+		username_normalized TEXT,
+		email_normalized TEXT
 	);`
 
 	// Create todos table with user_id and foreign key constraint
@@ -58,14 +99,160 @@ func InitDB() error {
 	CREATE TABLE IF NOT EXISTS todos (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INTEGER NOT NULL,
+		list_id INTEGER REFERENCES lists(id),
+		parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
 		title TEXT NOT NULL,
 		description TEXT,
 		completed BOOLEAN DEFAULT FALSE,
+		priority TEXT NOT NULL DEFAULT 'none',
+		position TEXT NOT NULL DEFAULT '',
+		due_at DATETIME,
+		remind_at DATETIME,
+		reminded_at DATETIME,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);`
 
+	// Create lists table; each user has at most one inbox
+	createListsTable := `
+	CREATE TABLE IF NOT EXISTS lists (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		color TEXT NOT NULL,
+		icon TEXT NOT NULL,
+		inbox BOOLEAN NOT NULL DEFAULT FALSE,
+		archived_at DATETIME,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_lists_user_id ON lists(user_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_lists_inbox ON lists(user_id) WHERE inbox;`
+
+	// Create tags and todo_tags tables; tag names are unique per user
+	createTagsTable := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL COLLATE NOCASE,
+		color TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		UNIQUE (user_id, name),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS todo_tags (
+		todo_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (todo_id, tag_id),
+		FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_todo_tags_tag_id ON todo_tags(tag_id);`
+
+	// Create sessions table holding the hashed refresh token of every login
+	createSessionsTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		refresh_token_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip_address TEXT NOT NULL DEFAULT '',
+		last_seen_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);`
+
+	// Create user_tokens table for single-use links sent by email
+	createUserTokensTable := `
+	CREATE TABLE IF NOT EXISTS user_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		purpose TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id, purpose);`
+
+	// Create recovery_codes table for hashed two-factor backup codes
+	createRecoveryCodesTable := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);`
+
+	// Create personal_access_tokens table for API tokens used by scripts
+	createAccessTokensTable := `
+	CREATE TABLE IF NOT EXISTS personal_access_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);`
+
+	// Create signing_keys table for the access token key ring
+	createSigningKeysTable := `
+	CREATE TABLE IF NOT EXISTS signing_keys (
+		id TEXT PRIMARY KEY,
+		algorithm TEXT NOT NULL,
+		key_data TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		retired_at DATETIME,
+		expires_at DATETIME
+	);`
+
+	// Create user_identities table linking accounts to OIDC provider subjects
+	createUserIdentitiesTable := `
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_login_at DATETIME,
+		UNIQUE (provider, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);`
+
+	// Security events outlive a purged account, which only loses the link
+	createAuditEventsTable := `
+	CREATE TABLE IF NOT EXISTS audit_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		actor_id INTEGER,
+		event TEXT NOT NULL,
+		ip_address TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		details TEXT,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+		FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events(user_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);`
+
 	_, err = db.Exec(createUsersTable)
 	if err != nil {
 		log.Printf("InitDB: Error creating users table: %v", err)
@@ -73,6 +260,55 @@ func InitDB() error {
 	}
 	log.Printf("InitDB: Users table created")
 
+	if _, err = addColumnIfMissing("users", "deletion_scheduled_at", "DATETIME"); err != nil {
+		log.Printf("InitDB: Error adding users.deletion_scheduled_at column: %v", err)
+		return err
+	}
+
+	// Accounts created before email verification existed are treated as
+	// verified so upgrading does not lock anyone out.
+	added, err := addColumnIfMissing("users", "email_verified_at", "DATETIME")
+	if err != nil {
+		log.Printf("InitDB: Error adding users.email_verified_at column: %v", err)
+		return err
+	}
+	if added {
+		if _, err = db.Exec("UPDATE users SET email_verified_at = created_at"); err != nil {
+			log.Printf("InitDB: Error marking existing users as verified: %v", err)
+			return err
+		}
+	}
+
+	// Columns added after the users table was first released
+	addedUserColumns := []struct{ name, definition string }{
+		{"totp_secret", "TEXT"},
+		{"totp_enabled_at", "DATETIME"},
+		{"totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+		{"failed_login_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"locked_until", "DATETIME"},
+		{"role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"disabled_at", "DATETIME"},
+		{"username_normalized", "TEXT"},
+		{"email_normalized", "TEXT"},
+	}
+	for _, col := range addedUserColumns {
+		if _, err = addColumnIfMissing("users", col.name, col.definition); err != nil {
+			log.Printf("InitDB: Error adding users.%s column: %v", col.name, err)
+			return err
+		}
+	}
+	if err = migrateNormalizedUsers(); err != nil {
+		log.Printf("InitDB: Error normalizing usernames and emails: %v", err)
+		return err
+	}
+
+	_, err = db.Exec(createListsTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating lists table: %v", err)
+		return err
+	}
+	log.Printf("InitDB: Lists table created")
+
 	_, err = db.Exec(createTodosTable)
 	if err != nil {
 		log.Printf("InitDB: Error creating todos table: %v", err)
@@ -80,6 +316,110 @@ func InitDB() error {
 	}
 	log.Printf("InitDB: Todos table created")
 
+	// Columns added after the todos table was first released
+	addedTodoColumns := []struct{ name, definition string }{
+		{"due_at", "DATETIME"},
+		{"remind_at", "DATETIME"},
+		{"reminded_at", "DATETIME"},
+		{"priority", "TEXT NOT NULL DEFAULT 'none'"},
+		{"position", "TEXT NOT NULL DEFAULT ''"},
+		{"list_id", "INTEGER REFERENCES lists(id)"},
+		{"parent_id", "INTEGER REFERENCES todos(id) ON DELETE CASCADE"},
+	}
+	for _, col := range addedTodoColumns {
+		if _, err = addColumnIfMissing("todos", col.name, col.definition); err != nil {
+			log.Printf("InitDB: Error adding todos.%s column: %v", col.name, err)
+			return err
+		}
+	}
+	_, err = db.Exec(`
+	CREATE INDEX IF NOT EXISTS idx_todos_user_id_due_at ON todos(user_id, due_at);
+	CREATE INDEX IF NOT EXISTS idx_todos_user_id_position ON todos(user_id, position);
+	CREATE INDEX IF NOT EXISTS idx_todos_list_id ON todos(list_id);
+	CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id);
+	CREATE INDEX IF NOT EXISTS idx_todos_pending_reminders ON todos(remind_at) WHERE reminded_at IS NULL;`)
+	if err != nil {
+		log.Printf("InitDB: Error creating todos indexes: %v", err)
+		return err
+	}
+	if err = migrateTodoPositions(); err != nil {
+		log.Printf("InitDB: Error assigning todo positions: %v", err)
+		return err
+	}
+	if err = migrateTodoLists(); err != nil {
+		log.Printf("InitDB: Error moving todos to inboxes: %v", err)
+		return err
+	}
+
+	_, err = db.Exec(createTagsTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating tags tables: %v", err)
+		return err
+	}
+	log.Printf("InitDB: Tags tables created")
+
+	_, err = db.Exec(createSessionsTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating sessions table: %v", err)
+		return err
+	}
+	log.Printf("InitDB: Sessions table created")
+
+	// Columns added after the sessions table was first released
+	sessionColumns := []struct{ name, definition string }{
+		{"user_agent", "TEXT NOT NULL DEFAULT ''"},
+		{"ip_address", "TEXT NOT NULL DEFAULT ''"},
+		{"last_seen_at", "DATETIME"},
+	}
+	for _, col := range sessionColumns {
+		if _, err = addColumnIfMissing("sessions", col.name, col.definition); err != nil {
+			log.Printf("InitDB: Error adding sessions.%s column: %v", col.name, err)
+			return err
+		}
+	}
+
+	_, err = db.Exec(createUserTokensTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating user_tokens table: %v", err)
+		return err
+	}
+	log.Printf("InitDB: User tokens table created")
+
+	_, err = db.Exec(createRecoveryCodesTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating recovery_codes table: %v", err)
+		return err
+	}
+	log.Printf("InitDB: Recovery codes table created")
+
+	_, err = db.Exec(createAccessTokensTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating personal_access_tokens table: %v", err)
+		return err
+	}
+	log.Printf("InitDB: Personal access tokens table created")
+
+	_, err = db.Exec(createSigningKeysTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating signing_keys table: %v", err)
+		return err
+	}
+	log.Printf("InitDB: Signing keys table created")
+
+	_, err = db.Exec(createUserIdentitiesTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating user_identities table: %v", err)
+		return err
+	}
+	log.Printf("InitDB: User identities table created")
+
+	_, err = db.Exec(createAuditEventsTable)
+	if err != nil {
+		log.Printf("InitDB: Error creating audit_events table: %v", err)
+		return err
+	}
+	log.Printf("InitDB: Audit events table created")
+
 	// Verify foreign key constraints
 	var foreignKeysEnabled int
 	err = db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeysEnabled)
@@ -92,18 +432,53 @@ func InitDB() error {
 	return nil
 }
 
+// addColumnIfMissing brings tables created by an older version of the
+// application up to date; CREATE TABLE IF NOT EXISTS leaves them untouched.
+// It reports whether the column had to be added.
+func addColumnIfMissing(table, column, definition string) (bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("InitDB: Added column %s.%s", table, column)
+	return true, nil
+}
+
 // User functions
 func CreateUser(input models.RegisterInput) (models.User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	hashedPassword, err := passwordHasher.Hash(input.Password)
 	if err != nil {
 		return models.User{}, err
 	}
 
 	now := time.Now()
 	result, err := db.Exec(
-		"INSERT INTO users (username, email, password, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-		input.Username, input.Email, string(hashedPassword), now, now,
+		"INSERT INTO users (username, email, password, created_at, updated_at, username_normalized, email_normalized) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		input.Username, input.Email, hashedPassword, now, now,
+		normalize.Username(input.Username), normalize.Email(input.Email),
 	)
+	if isUniqueViolation(err) {
+		return models.User{}, ErrUserExists
+	}
 	if err != nil {
 		return models.User{}, err
 	}
@@ -119,38 +494,232 @@ func CreateUser(input models.RegisterInput) (models.User, error) {
 		Email:     input.Email,
 		CreatedAt: now,
 		UpdatedAt: now,
+		Role:      models.RoleUser,
 	}, nil
 }
 
-func GetUserByEmail(email string) (models.User, error) {
+const userColumns = "id, username, email, password, created_at, updated_at, deletion_scheduled_at, email_verified_at, totp_enabled_at, failed_login_count, locked_until, role, disabled_at"
+
+func scanUser(row rowScanner) (models.User, error) {
 	var user models.User
-	err := db.QueryRow(
-		"SELECT id, username, email, password, created_at, updated_at FROM users WHERE email = ?",
-		email,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	var deletionScheduledAt, emailVerifiedAt, totpEnabledAt, lockedUntil, disabledAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt,
+		&deletionScheduledAt, &emailVerifiedAt, &totpEnabledAt, &user.FailedLoginCount, &lockedUntil,
+		&user.Role, &disabledAt)
+	if deletionScheduledAt.Valid {
+		user.DeletionScheduledAt = &deletionScheduledAt.Time
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if totpEnabledAt.Valid {
+		user.TwoFactorEnabledAt = &totpEnabledAt.Time
+	}
+	if lockedUntil.Valid {
+		user.LockedUntil = &lockedUntil.Time
+	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
 	return user, err
 }
 
+// GetUserByEmail finds a user by email address, ignoring case and Unicode
+// compatibility differences. An exact match wins, so an account whose
+// normalized address clashed during migration stays reachable.
+func GetUserByEmail(email string) (models.User, error) {
+	return scanUser(db.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE email = ? OR email_normalized = ? ORDER BY email = ? DESC LIMIT 1",
+		email, normalize.Email(email), email,
+	))
+}
+
+// GetUserByUsername finds a user by username the same way GetUserByEmail
+// finds one by email.
 func GetUserByUsername(username string) (models.User, error) {
-	var user models.User
-	err := db.QueryRow(
-		"SELECT id, username, email, password, created_at, updated_at FROM users WHERE username = ?",
-		username,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
-	return user, err
+	return scanUser(db.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE username = ? OR username_normalized = ? ORDER BY username = ? DESC LIMIT 1",
+		username, normalize.Username(username), username,
+	))
+}
+
+// GetUserByIdentifier finds a user by the username or email address
+// entered on the login form.
+func GetUserByIdentifier(identifier string) (models.User, error) {
+	if normalize.IsEmail(identifier) {
+		return GetUserByEmail(identifier)
+	}
+	return GetUserByUsername(identifier)
 }
 
 func GetUserByID(id int64) (models.User, error) {
-	var user models.User
+	return scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+// UpdateUserPassword hashes and stores a new password for the user.
+func UpdateUserPassword(userID int64, password string) error {
+	hashedPassword, err := passwordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(
+		"UPDATE users SET password = ?, updated_at = ? WHERE id = ?",
+		hashedPassword, time.Now(), userID,
+	)
+	if err != nil {
+		log.Printf("UpdateUserPassword: Database error: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	log.Printf("UpdateUserPassword: Updated password for user %d", userID)
+	return nil
+}
+
+// ReplacePasswordHash swaps the stored hash of an unchanged password for a
+// stronger one. It reports false if the password changed in the meantime.
+func ReplacePasswordHash(userID int64, oldHash, newHash string) (bool, error) {
+	result, err := db.Exec("UPDATE users SET password = ? WHERE id = ? AND password = ?", newHash, userID, oldHash)
+	if err != nil {
+		log.Printf("ReplacePasswordHash: Database error: %v", err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func MarkEmailVerified(userID int64) error {
+	log.Printf("MarkEmailVerified: Marking email of user %d as verified", userID)
+	now := time.Now()
+	_, err := db.Exec(
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?), updated_at = ? WHERE id = ?",
+		now, now, userID,
+	)
+	return err
+}
+
+// RecordFailedLogin counts a failed password attempt and returns the number
+// of consecutive failures.
+func RecordFailedLogin(userID int64) (int, error) {
+	var count int
 	err := db.QueryRow(
-		"SELECT id, username, email, password, created_at, updated_at FROM users WHERE id = ?",
-		id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
-	return user, err
+		"UPDATE users SET failed_login_count = failed_login_count + 1 WHERE id = ? RETURNING failed_login_count",
+		userID,
+	).Scan(&count)
+	if err != nil {
+		log.Printf("RecordFailedLogin: Database error: %v", err)
+	}
+	return count, err
+}
+
+// LockUser refuses logins to the account until the given time.
+func LockUser(userID int64, until time.Time) error {
+	_, err := db.Exec("UPDATE users SET locked_until = ? WHERE id = ?", until.UTC(), userID)
+	if err != nil {
+		log.Printf("LockUser: Database error: %v", err)
+	}
+	return err
+}
+
+// ResetFailedLogins clears the failure count and any lockout, after a
+// successful login or a password reset.
+func ResetFailedLogins(userID int64) error {
+	_, err := db.Exec(
+		"UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = ? AND (failed_login_count != 0 OR locked_until IS NOT NULL)",
+		userID,
+	)
+	if err != nil {
+		log.Printf("ResetFailedLogins: Database error: %v", err)
+	}
+	return err
+}
+
+// ScheduleUserDeletion marks the account for removal at the given time. The
+// user keeps existing until PurgeDeletedUsers runs past that point.
+func ScheduleUserDeletion(userID int64, at time.Time) error {
+	log.Printf("ScheduleUserDeletion: Scheduling deletion of user %d at %s", userID, at)
+	_, err := db.Exec(
+		"UPDATE users SET deletion_scheduled_at = ?, updated_at = ? WHERE id = ?",
+		at.UTC(), time.Now(), userID,
+	)
+	return err
+}
+
+func CancelUserDeletion(userID int64) error {
+	log.Printf("CancelUserDeletion: Restoring user %d", userID)
+	_, err := db.Exec(
+		"UPDATE users SET deletion_scheduled_at = NULL, updated_at = ? WHERE id = ?",
+		time.Now(), userID,
+	)
+	return err
+}
+
+// PurgeDeletedUsers hard-deletes every account whose deletion time has
+// passed. Todos and sessions go with them through ON DELETE CASCADE.
+func PurgeDeletedUsers() (int64, error) {
+	result, err := db.Exec(
+		"DELETE FROM users WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?",
+		time.Now().UTC(),
+	)
+	if err != nil {
+		log.Printf("PurgeDeletedUsers: Database error: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 // Todo functions
-func GetTodos(userID int64) ([]models.Todo, error) {
+
+const todoColumns = "id, user_id, list_id, parent_id, title, description, completed, priority, position, due_at, remind_at, reminded_at, created_at, updated_at"
+
+func scanTodo(row rowScanner) (models.Todo, error) {
+	var todo models.Todo
+	var listID, parentID sql.NullInt64
+	var dueAt, remindAt, remindedAt sql.NullTime
+	err := row.Scan(&todo.ID, &todo.UserID, &listID, &parentID, &todo.Title, &todo.Description, &todo.Completed,
+		&todo.Priority, &todo.Position, &dueAt, &remindAt, &remindedAt, &todo.CreatedAt, &todo.UpdatedAt)
+	todo.ListID = listID.Int64
+	if parentID.Valid {
+		todo.ParentID = &parentID.Int64
+	}
+	if dueAt.Valid {
+		todo.DueAt = &dueAt.Time
+	}
+	if remindAt.Valid {
+		todo.RemindAt = &remindAt.Time
+	}
+	if remindedAt.Valid {
+		todo.RemindedAt = &remindedAt.Time
+	}
+	return todo, err
+}
+
+// utcTime stores t as UTC so due and reminder times compare correctly in
+// SQL whatever offset the client sent them with.
+func utcTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// todoOrders are the ORDER BY clauses of the models.Sort* orders. Ties
+// fall back to the manual order.
+var todoOrders = map[string]string{
+	models.SortPriority: `CASE priority WHEN 'urgent' THEN 4 WHEN 'high' THEN 3 WHEN 'medium' THEN 2 WHEN 'low' THEN 1 ELSE 0 END DESC, position, id`,
+	models.SortDue:      "due_at IS NULL, due_at, position, id",
+	models.SortPosition: "position, id",
+	models.SortCreated:  "created_at DESC, id DESC",
+	models.SortUpdated:  "updated_at DESC, id DESC",
+}
+
+func GetTodos(userID int64, query models.TodoQuery) ([]models.Todo, error) {
 	log.Printf("GetTodos: Fetching todos for user ID: %d", userID)
 
 	// First verify the user exists
@@ -183,9 +752,44 @@ func GetTodos(userID int64) ([]models.Todo, error) {
 		log.Printf("GetTodos: Total todos for user %d: %d", userID, userTodosCount)
 	}
 
+	where := []string{"user_id = ?"}
+	args := []any{userID}
+	switch {
+	case query.ListID != 0:
+		where = append(where, "list_id = ?")
+		args = append(args, query.ListID)
+	case !query.Archived:
+		where = append(where, "NOT EXISTS (SELECT 1 FROM lists l WHERE l.id = todos.list_id AND l.archived_at IS NOT NULL)")
+	}
+	switch {
+	case query.ParentID != 0:
+		where = append(where, "parent_id = ?")
+		args = append(args, query.ParentID)
+	case !query.Subtasks:
+		where = append(where, "parent_id IS NULL")
+	}
+	if query.DueBefore != nil {
+		where = append(where, "due_at < ?")
+		args = append(args, query.DueBefore.UTC())
+	}
+	if query.Overdue {
+		where = append(where, "due_at < ? AND NOT completed")
+		args = append(args, time.Now().UTC())
+	}
+	if len(query.Tags) > 0 {
+		filter, filterArgs := tagFilter(query.Tags, query.TagMatch == models.TagMatchAny)
+		where = append(where, filter)
+		args = append(args, filterArgs...)
+	}
+
+	order, ok := todoOrders[query.Sort]
+	if !ok {
+		order = todoOrders[models.SortCreated]
+	}
+
 	rows, err := db.Query(
-		"SELECT id, user_id, title, description, completed, created_at, updated_at FROM todos WHERE user_id = ? ORDER BY created_at DESC",
-		userID,
+		"SELECT "+todoColumns+" FROM todos WHERE "+strings.Join(where, " AND ")+" ORDER BY "+order,
+		args...,
 	)
 	if err != nil {
 		log.Printf("GetTodos: Database error: %v", err)
@@ -195,8 +799,7 @@ func GetTodos(userID int64) ([]models.Todo, error) {
 
 	var todos []models.Todo
 	for rows.Next() {
-		var todo models.Todo
-		err := rows.Scan(&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed, &todo.CreatedAt, &todo.UpdatedAt)
+		todo, err := scanTodo(rows)
 		if err != nil {
 			log.Printf("GetTodos: Error scanning row: %v", err)
 			return nil, err
@@ -210,6 +813,15 @@ func GetTodos(userID int64) ([]models.Todo, error) {
 		return nil, err
 	}
 
+	if err = attachTags(userID, todos); err != nil {
+		log.Printf("GetTodos: Error loading tags: %v", err)
+		return nil, err
+	}
+	if err = attachProgress(userID, todos); err != nil {
+		log.Printf("GetTodos: Error loading progress: %v", err)
+		return nil, err
+	}
+
 	log.Printf("GetTodos: Found %d todos for user %d", len(todos), userID)
 	return todos, nil
 }
@@ -218,9 +830,42 @@ func CreateTodo(userID int64, todo models.CreateTodoInput) (models.Todo, error)
 	log.Printf("CreateTodo: Creating todo for user %d with title: %s", userID, todo.Title)
 	now := time.Now()
 
-	result, err := db.Exec(
-		"INSERT INTO todos (user_id, title, description, completed, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
-		userID, todo.Title, todo.Description, false, now, now,
+	priority := todo.Priority
+	if priority == "" {
+		priority = models.PriorityNone
+	}
+	if todo.ParentID != 0 && todo.ListID != 0 {
+		return models.Todo{}, ErrSubtaskList
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	var listID int64
+	var parentID any
+	if todo.ParentID != 0 {
+		// Subtasks go on the list of their parent
+		listID, err = checkParent(tx, userID, 0, todo.ParentID)
+		parentID = todo.ParentID
+	} else {
+		listID, err = resolveListID(tx, userID, todo.ListID)
+	}
+	if err != nil {
+		log.Printf("CreateTodo: Error resolving list or parent: %v", err)
+		return models.Todo{}, err
+	}
+	position, err := firstTodoPosition(tx, userID)
+	if err != nil {
+		log.Printf("CreateTodo: Error finding a position: %v", err)
+		return models.Todo{}, err
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO todos (user_id, list_id, parent_id, title, description, completed, priority, position, due_at, remind_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, listID, parentID, todo.Title, todo.Description, false, priority, position, utcTime(todo.DueAt), utcTime(todo.RemindAt), now, now,
 	)
 	if err != nil {
 		log.Printf("CreateTodo: Database error: %v", err)
@@ -232,28 +877,41 @@ func CreateTodo(userID int64, todo models.CreateTodoInput) (models.Todo, error)
 		log.Printf("CreateTodo: Error getting last insert ID: %v", err)
 		return models.Todo{}, err
 	}
+	if len(position) > maxPositionLength {
+		if err := spreadTodoPositions(tx, userID); err != nil {
+			log.Printf("CreateTodo: Error rebalancing positions: %v", err)
+			return models.Todo{}, err
+		}
+	}
+	if len(todo.Tags) > 0 {
+		if err := setTodoTags(tx, userID, id, todo.Tags); err != nil {
+			log.Printf("CreateTodo: Error setting tags: %v", err)
+			return models.Todo{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("CreateTodo: Error committing: %v", err)
+		return models.Todo{}, err
+	}
 	log.Printf("CreateTodo: Successfully created todo with ID: %d for user %d", id, userID)
 
-	return models.Todo{
-		ID:          id,
-		UserID:      userID,
-		Title:       todo.Title,
-		Description: todo.Description,
-		Completed:   false,
-		CreatedAt:   now,
-		UpdatedAt:   now,
-	}, nil
+	return GetTodoByID(userID, id)
 }
 
 func UpdateTodo(userID int64, todoID int64, todo models.UpdateTodoInput) error {
 	log.Printf("UpdateTodo: Updating todo %d for user %d", todoID, userID)
 
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// First get the existing todo
-	var existingTodo models.Todo
-	err := db.QueryRow(
-		"SELECT id, title, description, completed FROM todos WHERE id = ? AND user_id = ?",
+	existingTodo, err := scanTodo(tx.QueryRow(
+		"SELECT "+todoColumns+" FROM todos WHERE id = ? AND user_id = ?",
 		todoID, userID,
-	).Scan(&existingTodo.ID, &existingTodo.Title, &existingTodo.Description, &existingTodo.Completed)
+	))
 	if err != nil {
 		log.Printf("UpdateTodo: Error fetching existing todo: %v", err)
 		return err
@@ -273,18 +931,81 @@ func UpdateTodo(userID int64, todoID int64, todo models.UpdateTodoInput) error {
 	if !todo.Completed {
 		completed = existingTodo.Completed
 	}
+	priority := todo.Priority
+	if priority == "" {
+		priority = existingTodo.Priority
+	}
+	parentID := existingTodo.ParentID
+	if todo.ParentID.Set {
+		parentID = todo.ParentID.ID
+	}
+	listID := existingTodo.ListID
+	switch {
+	case todo.ListID != 0 && parentID != nil:
+		return ErrSubtaskList
+	case todo.ListID != 0:
+		listID, err = resolveListID(tx, userID, todo.ListID)
+	case todo.ParentID.Set && parentID != nil:
+		// Subtasks go on the list of their parent
+		listID, err = checkParent(tx, userID, todoID, *parentID)
+	}
+	if err != nil {
+		log.Printf("UpdateTodo: Error resolving list or parent: %v", err)
+		return err
+	}
+	completing := completed && !existingTodo.Completed
+	if completing && todosConfig.ParentCompletion == config.ParentCompletionBlock {
+		open, err := hasOpenSubtasks(tx, userID, todoID)
+		if err != nil {
+			return err
+		}
+		if open {
+			return ErrOpenSubtasks
+		}
+	}
+	dueAt := existingTodo.DueAt
+	if todo.DueAt.Set {
+		dueAt = todo.DueAt.Time
+	}
+	// A new reminder time arms the reminder again
+	remindAt, remindedAt := existingTodo.RemindAt, existingTodo.RemindedAt
+	if todo.RemindAt.Set {
+		remindAt, remindedAt = todo.RemindAt.Time, nil
+	}
 
-	log.Printf("UpdateTodo: Updating with values - title: %s, description: %s, completed: %v",
-		title, description, completed)
+	log.Printf("UpdateTodo: Updating with values - title: %s, description: %s, completed: %v, priority: %s, due_at: %v, remind_at: %v",
+		title, description, completed, priority, dueAt, remindAt)
 
-	_, err = db.Exec(
-		"UPDATE todos SET title = ?, description = ?, completed = ?, updated_at = ? WHERE id = ? AND user_id = ?",
-		title, description, completed, time.Now(), todoID, userID,
+	_, err = tx.Exec(
+		"UPDATE todos SET list_id = ?, parent_id = ?, title = ?, description = ?, completed = ?, priority = ?, due_at = ?, remind_at = ?, reminded_at = ?, updated_at = ? WHERE id = ? AND user_id = ?",
+		listID, parentID, title, description, completed, priority, utcTime(dueAt), utcTime(remindAt), utcTime(remindedAt), time.Now(), todoID, userID,
 	)
 	if err != nil {
 		log.Printf("UpdateTodo: Error updating todo: %v", err)
 		return err
 	}
+	if listID != existingTodo.ListID {
+		if err := moveSubtasks(tx, userID, todoID, listID); err != nil {
+			log.Printf("UpdateTodo: Error moving subtasks: %v", err)
+			return err
+		}
+	}
+	if completing && todosConfig.ParentCompletion == config.ParentCompletionCascade {
+		if err := completeSubtasks(tx, userID, todoID); err != nil {
+			log.Printf("UpdateTodo: Error completing subtasks: %v", err)
+			return err
+		}
+	}
+	if todo.Tags != nil {
+		if err := setTodoTags(tx, userID, todoID, *todo.Tags); err != nil {
+			log.Printf("UpdateTodo: Error setting tags: %v", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("UpdateTodo: Error committing: %v", err)
+		return err
+	}
 	log.Printf("UpdateTodo: Successfully updated todo")
 	return nil
 }
@@ -296,15 +1017,24 @@ func DeleteTodo(userID int64, todoID int64) error {
 
 func GetTodoByID(userID int64, todoID int64) (models.Todo, error) {
 	log.Printf("GetTodoByID: Fetching todo ID %d for user ID %d", todoID, userID)
-	var todo models.Todo
-	err := db.QueryRow(
-		"SELECT id, user_id, title, description, completed, created_at, updated_at FROM todos WHERE id = ? AND user_id = ?",
+	todo, err := scanTodo(db.QueryRow(
+		"SELECT "+todoColumns+" FROM todos WHERE id = ? AND user_id = ?",
 		todoID, userID,
-	).Scan(&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed, &todo.CreatedAt, &todo.UpdatedAt)
+	))
 	if err != nil {
 		log.Printf("GetTodoByID: Error fetching todo: %v", err)
 		return models.Todo{}, err
 	}
+	todos := []models.Todo{todo}
+	if err := attachTags(userID, todos); err != nil {
+		log.Printf("GetTodoByID: Error loading tags: %v", err)
+		return models.Todo{}, err
+	}
+	if err := attachProgress(userID, todos); err != nil {
+		log.Printf("GetTodoByID: Error loading progress: %v", err)
+		return models.Todo{}, err
+	}
+	todo = todos[0]
 	log.Printf("GetTodoByID: Found todo - ID: %d, UserID: %d, Title: %s", todo.ID, todo.UserID, todo.Title)
 	return todo, nil
 }
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"todo-app/models"
+)
+
+// Identity functions
+
+// GetUserByIdentity returns the user linked to the provider's subject, or
+// sql.ErrNoRows.
+func GetUserByIdentity(provider, subject string) (models.User, error) {
+	return scanUser(db.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE id = (SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?)",
+		provider, subject,
+	))
+}
+
+// HasUserIdentity reports whether the user is linked to any subject of the
+// provider.
+func HasUserIdentity(userID int64, provider string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = ? AND provider = ?)",
+		userID, provider,
+	).Scan(&exists)
+	return exists, err
+}
+
+// CreateUserIdentity links a user to a provider subject.
+func CreateUserIdentity(identity models.UserIdentity) error {
+	log.Printf("CreateUserIdentity: Linking user %d to provider %s", identity.UserID, identity.Provider)
+	_, err := db.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at) VALUES (?, ?, ?, ?, ?, ?)",
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt.UTC(), identity.CreatedAt.UTC(),
+	)
+	if err != nil {
+		log.Printf("CreateUserIdentity: Database error: %v", err)
+	}
+	return err
+}
+
+// TouchUserIdentity records a sign-in through the identity and the email
+// address the provider reported for it.
+func TouchUserIdentity(provider, subject, email string) error {
+	_, err := db.Exec(
+		"UPDATE user_identities SET email = ?, last_login_at = ? WHERE provider = ? AND subject = ?",
+		email, time.Now().UTC(), provider, subject,
+	)
+	return err
+}
@@ -0,0 +1,265 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"todo-app/models"
+)
+
+var (
+	// ErrListNotFound is returned when a todo is put on a list that is not
+	// one of the user's.
+	ErrListNotFound = errors.New("database: list not found")
+	// ErrInboxList is returned when archiving or deleting the Inbox.
+	ErrInboxList = errors.New("database: the inbox cannot be archived or deleted")
+)
+
+const listColumns = "id, name, color, icon, inbox, archived_at, created_at, updated_at"
+
+func scanList(row rowScanner) (models.List, error) {
+	var list models.List
+	var archivedAt sql.NullTime
+	err := row.Scan(&list.ID, &list.Name, &list.Color, &list.Icon, &list.Inbox, &archivedAt, &list.CreatedAt, &list.UpdatedAt)
+	if archivedAt.Valid {
+		list.Archived = true
+		list.ArchivedAt = &archivedAt.Time
+	}
+	return list, err
+}
+
+// inboxID returns the ID of the user's Inbox, creating it on first use.
+func inboxID(tx *sql.Tx, userID int64) (int64, error) {
+	now := time.Now()
+	_, err := tx.Exec(
+		"INSERT OR IGNORE INTO lists (user_id, name, color, icon, inbox, created_at, updated_at) VALUES (?, ?, ?, ?, TRUE, ?, ?)",
+		userID, models.InboxName, models.DefaultListColor, models.InboxIcon, now, now,
+	)
+	if err != nil {
+		log.Printf("inboxID: Error creating inbox for user %d: %v", userID, err)
+		return 0, err
+	}
+	var id int64
+	err = tx.QueryRow("SELECT id FROM lists WHERE user_id = ? AND inbox", userID).Scan(&id)
+	return id, err
+}
+
+// resolveListID checks that listID is a list of the user, standing in the
+// Inbox for zero.
+func resolveListID(tx *sql.Tx, userID, listID int64) (int64, error) {
+	if listID == 0 {
+		return inboxID(tx, userID)
+	}
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM lists WHERE id = ? AND user_id = ?)", listID, userID).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrListNotFound
+	}
+	return listID, nil
+}
+
+// ListLists returns the user's lists, Inbox first and the rest by name,
+// with their todo counts. Archived lists come last and only when asked for.
+func ListLists(userID int64, includeArchived bool) ([]models.ListStats, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := inboxID(tx, userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	filter := ""
+	if !includeArchived {
+		filter = " AND l.archived_at IS NULL"
+	}
+	rows, err := db.Query(`
+		SELECT l.id, l.name, l.color, l.icon, l.inbox, l.archived_at, l.created_at, l.updated_at,
+			COUNT(t.id),
+			COALESCE(SUM(CASE WHEN NOT t.completed THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN NOT t.completed AND t.due_at < ? THEN 1 ELSE 0 END), 0)
+		FROM lists l LEFT JOIN todos t ON t.list_id = l.id
+		WHERE l.user_id = ?`+filter+`
+		GROUP BY l.id
+		ORDER BY l.inbox DESC, l.archived_at IS NOT NULL, l.name COLLATE NOCASE, l.id`,
+		time.Now().UTC(), userID,
+	)
+	if err != nil {
+		log.Printf("ListLists: Database error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []models.ListStats{}
+	for rows.Next() {
+		var list models.ListStats
+		var archivedAt sql.NullTime
+		err := rows.Scan(&list.ID, &list.Name, &list.Color, &list.Icon, &list.Inbox, &archivedAt, &list.CreatedAt, &list.UpdatedAt,
+			&list.TodoCount, &list.OpenCount, &list.OverdueCount)
+		if err != nil {
+			log.Printf("ListLists: Error scanning list: %v", err)
+			return nil, err
+		}
+		if archivedAt.Valid {
+			list.Archived = true
+			list.ArchivedAt = &archivedAt.Time
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func GetList(userID, listID int64) (models.List, error) {
+	return scanList(db.QueryRow("SELECT "+listColumns+" FROM lists WHERE id = ? AND user_id = ?", listID, userID))
+}
+
+func CreateList(userID int64, input models.CreateListInput) (models.List, error) {
+	log.Printf("CreateList: Creating list %q for user %d", input.Name, userID)
+	color := input.Color
+	if color == "" {
+		color = models.DefaultListColor
+	}
+	icon := input.Icon
+	if icon == "" {
+		icon = models.DefaultListIcon
+	}
+	now := time.Now()
+	result, err := db.Exec(
+		"INSERT INTO lists (user_id, name, color, icon, inbox, created_at, updated_at) VALUES (?, ?, ?, ?, FALSE, ?, ?)",
+		userID, input.Name, color, icon, now, now,
+	)
+	if err != nil {
+		log.Printf("CreateList: Database error: %v", err)
+		return models.List{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.List{}, err
+	}
+	return GetList(userID, id)
+}
+
+// UpdateList renames, recolors, archives or restores a list of the user.
+func UpdateList(userID, listID int64, input models.UpdateListInput) (models.List, error) {
+	log.Printf("UpdateList: Updating list %d of user %d", listID, userID)
+	list, err := GetList(userID, listID)
+	if err != nil {
+		return models.List{}, err
+	}
+	if input.Name != "" {
+		list.Name = input.Name
+	}
+	if input.Color != "" {
+		list.Color = input.Color
+	}
+	if input.Icon != "" {
+		list.Icon = input.Icon
+	}
+	now := time.Now()
+	if input.Archived != nil {
+		switch {
+		case *input.Archived && list.Inbox:
+			return models.List{}, ErrInboxList
+		case *input.Archived && list.ArchivedAt == nil:
+			archivedAt := now.UTC()
+			list.ArchivedAt = &archivedAt
+		case !*input.Archived:
+			list.ArchivedAt = nil
+		}
+	}
+
+	_, err = db.Exec(
+		"UPDATE lists SET name = ?, color = ?, icon = ?, archived_at = ?, updated_at = ? WHERE id = ? AND user_id = ?",
+		list.Name, list.Color, list.Icon, utcTime(list.ArchivedAt), now, listID, userID,
+	)
+	if err != nil {
+		log.Printf("UpdateList: Database error: %v", err)
+		return models.List{}, err
+	}
+	return GetList(userID, listID)
+}
+
+// DeleteList deletes a list of the user. Its todos move to the Inbox.
+func DeleteList(userID, listID int64) error {
+	log.Printf("DeleteList: Deleting list %d of user %d", listID, userID)
+	list, err := GetList(userID, listID)
+	if err != nil {
+		return err
+	}
+	if list.Inbox {
+		return ErrInboxList
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	inbox, err := inboxID(tx, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE todos SET list_id = ? WHERE list_id = ? AND user_id = ?", inbox, listID, userID); err != nil {
+		log.Printf("DeleteList: Error moving todos to the inbox: %v", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM lists WHERE id = ? AND user_id = ?", listID, userID); err != nil {
+		log.Printf("DeleteList: Database error: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateTodoLists puts the todos from before lists existed in their
+// owner's Inbox.
+func migrateTodoLists() error {
+	rows, err := db.Query("SELECT DISTINCT user_id FROM todos WHERE list_id IS NULL AND user_id IN (SELECT id FROM users)")
+	if err != nil {
+		return err
+	}
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := migrateUserTodoLists(userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateUserTodoLists(userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	inbox, err := inboxID(tx, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE todos SET list_id = ? WHERE user_id = ? AND list_id IS NULL", inbox, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
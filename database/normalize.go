@@ -0,0 +1,124 @@
+package database
+
+import (
+	"errors"
+	"log"
+
+	"todo-app/models"
+	"todo-app/normalize"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// migrateNormalizedUsers fills in the normalized username and email of
+// accounts created before they existed and enforces their uniqueness. A
+// value another account already holds is left empty and reported; it is
+// retried on every start so the conflict clears once resolved.
+func migrateNormalizedUsers() error {
+	_, err := db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_normalized ON users(username_normalized);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_normalized ON users(email_normalized);`)
+	if err != nil {
+		return err
+	}
+
+	type pending struct {
+		id              int64
+		username, email string
+		needsUsername   bool
+		needsEmail      bool
+	}
+	rows, err := db.Query(`SELECT id, username, email, username_normalized IS NULL, email_normalized IS NULL
+		FROM users WHERE username_normalized IS NULL OR email_normalized IS NULL ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	var users []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.username, &p.email, &p.needsUsername, &p.needsEmail); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Older accounts keep the normalized value when two of them clash
+	for _, p := range users {
+		if p.needsUsername {
+			_, err := db.Exec("UPDATE users SET username_normalized = ? WHERE id = ?", normalize.Username(p.username), p.id)
+			if err != nil && !isUniqueViolation(err) {
+				return err
+			}
+		}
+		if p.needsEmail {
+			_, err := db.Exec("UPDATE users SET email_normalized = ? WHERE id = ?", normalize.Email(p.email), p.id)
+			if err != nil && !isUniqueViolation(err) {
+				return err
+			}
+		}
+	}
+	if len(users) > 0 {
+		log.Printf("migrateNormalizedUsers: Normalized %d users", len(users))
+	}
+
+	conflicts, err := NormalizationConflicts()
+	if err != nil {
+		return err
+	}
+	for _, conflict := range conflicts {
+		log.Printf("migrateNormalizedUsers: User %d has %s %q, which normalizes to that of user %d; it can only log in with the exact spelling",
+			conflict.UserID, conflict.Field, conflict.Value, conflict.ConflictsWith)
+	}
+	return nil
+}
+
+// NormalizationConflicts lists the accounts whose username or email could
+// not be normalized because another account already has the same form.
+func NormalizationConflicts() ([]models.NormalizationConflict, error) {
+	rows, err := db.Query(`SELECT id, username, email, username_normalized IS NULL, email_normalized IS NULL
+		FROM users WHERE username_normalized IS NULL OR email_normalized IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conflicts []models.NormalizationConflict
+	for rows.Next() {
+		var id int64
+		var username, email string
+		var missingUsername, missingEmail bool
+		if err := rows.Scan(&id, &username, &email, &missingUsername, &missingEmail); err != nil {
+			return nil, err
+		}
+		if missingUsername {
+			conflicts = append(conflicts, models.NormalizationConflict{UserID: id, Field: "username", Value: username})
+		}
+		if missingEmail {
+			conflicts = append(conflicts, models.NormalizationConflict{UserID: id, Field: "email", Value: email})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, conflict := range conflicts {
+		query, value := "SELECT id FROM users WHERE username_normalized = ?", normalize.Username(conflict.Value)
+		if conflict.Field == "email" {
+			query, value = "SELECT id FROM users WHERE email_normalized = ?", normalize.Email(conflict.Value)
+		}
+		if err := db.QueryRow(query, value).Scan(&conflicts[i].ConflictsWith); err != nil {
+			return nil, err
+		}
+	}
+	return conflicts, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
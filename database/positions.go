@@ -0,0 +1,187 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"todo-app/lexorank"
+)
+
+// maxPositionLength is how long a todo position may grow, from many moves
+// into the same gap, before the user's positions are spread out again.
+const maxPositionLength = 32
+
+// ErrInvalidMove is returned by MoveTodo when a neighbor is not another
+// todo of the same user, or the two neighbors are not in order.
+var ErrInvalidMove = errors.New("database: invalid move")
+
+// firstTodoPosition returns a position before every todo of the user, where
+// new todos go so the manual order starts out newest first.
+func firstTodoPosition(tx *sql.Tx, userID int64) (string, error) {
+	var first sql.NullString
+	err := tx.QueryRow("SELECT MIN(position) FROM todos WHERE user_id = ? AND position != ''", userID).Scan(&first)
+	if err != nil {
+		return "", err
+	}
+	return lexorank.Between("", first.String)
+}
+
+// MoveTodo places a todo directly after the todo afterID or directly before
+// the todo beforeID. Either may be zero; given both, they must be in that
+// order. Only the moved todo is rewritten unless positions grew too long.
+func MoveTodo(userID, todoID, afterID, beforeID int64) error {
+	log.Printf("MoveTodo: Moving todo %d of user %d after %d, before %d", todoID, userID, afterID, beforeID)
+	if _, err := GetTodoByID(userID, todoID); err != nil {
+		return err
+	}
+	if afterID == todoID || beforeID == todoID || (afterID == 0 && beforeID == 0) {
+		return ErrInvalidMove
+	}
+
+	position, err := positionBetween(userID, todoID, afterID, beforeID)
+	if errors.Is(err, lexorank.ErrOrder) {
+		// Neighbors that share a position need spreading out first
+		if err := rebalanceTodoPositions(userID); err != nil {
+			return err
+		}
+		position, err = positionBetween(userID, todoID, afterID, beforeID)
+		if errors.Is(err, lexorank.ErrOrder) {
+			return ErrInvalidMove
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("UPDATE todos SET position = ? WHERE id = ? AND user_id = ?", position, todoID, userID); err != nil {
+		log.Printf("MoveTodo: Error updating position: %v", err)
+		return err
+	}
+	if len(position) > maxPositionLength {
+		return rebalanceTodoPositions(userID)
+	}
+	return nil
+}
+
+// positionBetween finds a position between the given neighbors, looking up
+// the todo on the other side when only one is given.
+func positionBetween(userID, todoID, afterID, beforeID int64) (string, error) {
+	var lower, upper string
+	if afterID != 0 {
+		if err := db.QueryRow("SELECT position FROM todos WHERE id = ? AND user_id = ?", afterID, userID).Scan(&lower); err != nil {
+			return "", neighborError(err)
+		}
+	}
+	if beforeID != 0 {
+		if err := db.QueryRow("SELECT position FROM todos WHERE id = ? AND user_id = ?", beforeID, userID).Scan(&upper); err != nil {
+			return "", neighborError(err)
+		}
+	}
+
+	var other sql.NullString
+	switch {
+	case beforeID == 0:
+		err := db.QueryRow(
+			"SELECT MIN(position) FROM todos WHERE user_id = ? AND id != ? AND position > ?",
+			userID, todoID, lower,
+		).Scan(&other)
+		if err != nil {
+			return "", err
+		}
+		upper = other.String
+	case afterID == 0:
+		err := db.QueryRow(
+			"SELECT MAX(position) FROM todos WHERE user_id = ? AND id != ? AND position < ?",
+			userID, todoID, upper,
+		).Scan(&other)
+		if err != nil {
+			return "", err
+		}
+		lower = other.String
+	}
+	return lexorank.Between(lower, upper)
+}
+
+func neighborError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidMove
+	}
+	return err
+}
+
+// rebalanceTodoPositions gives all todos of the user short, evenly spaced
+// positions in their current order. Todos without a position, from before
+// manual ordering existed, follow newest first.
+func rebalanceTodoPositions(userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := spreadTodoPositions(tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// spreadTodoPositions does the work of rebalanceTodoPositions inside tx.
+func spreadTodoPositions(tx *sql.Tx, userID int64) error {
+	log.Printf("spreadTodoPositions: Spreading out positions of user %d", userID)
+	rows, err := tx.Query(
+		"SELECT id FROM todos WHERE user_id = ? ORDER BY position = '', position, created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, position := range lexorank.Spread(len(ids)) {
+		if _, err := tx.Exec("UPDATE todos SET position = ? WHERE id = ?", position, ids[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTodoPositions gives positions to the todos of every user who has
+// some without one.
+func migrateTodoPositions() error {
+	rows, err := db.Query("SELECT DISTINCT user_id FROM todos WHERE position = ''")
+	if err != nil {
+		return err
+	}
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := rebalanceTodoPositions(userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"todo-app/models"
+)
+
+// DueReminders returns up to limit unfinished todos whose reminder time has
+// passed and whose reminder has not gone out, oldest first. Todos on
+// archived lists and of disabled accounts or accounts awaiting deletion
+// are left out.
+func DueReminders(now time.Time, limit int) ([]models.Reminder, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.user_id, t.title, t.description, t.completed, t.due_at, t.remind_at, t.reminded_at,
+			t.created_at, t.updated_at, u.username, u.email, u.email_verified_at
+		FROM todos t JOIN users u ON u.id = t.user_id
+		WHERE t.remind_at <= ? AND t.reminded_at IS NULL AND NOT t.completed
+			AND u.disabled_at IS NULL AND u.deletion_scheduled_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM lists l WHERE l.id = t.list_id AND l.archived_at IS NOT NULL)
+		ORDER BY t.remind_at LIMIT ?`,
+		now.UTC(), limit,
+	)
+	if err != nil {
+		log.Printf("DueReminders: Database error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []models.Reminder
+	for rows.Next() {
+		var r models.Reminder
+		var dueAt, remindAt, remindedAt, emailVerifiedAt sql.NullTime
+		err := rows.Scan(&r.Todo.ID, &r.Todo.UserID, &r.Todo.Title, &r.Todo.Description, &r.Todo.Completed,
+			&dueAt, &remindAt, &remindedAt, &r.Todo.CreatedAt, &r.Todo.UpdatedAt,
+			&r.Username, &r.Email, &emailVerifiedAt)
+		if err != nil {
+			log.Printf("DueReminders: Error scanning row: %v", err)
+			return nil, err
+		}
+		if dueAt.Valid {
+			r.Todo.DueAt = &dueAt.Time
+		}
+		if remindAt.Valid {
+			r.Todo.RemindAt = &remindAt.Time
+		}
+		r.EmailVerified = emailVerifiedAt.Valid
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+// MarkReminded records that the reminder of a todo went out. It reports
+// false when another worker got there first, so each reminder is sent at
+// most once.
+func MarkReminded(todoID int64, at time.Time) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE todos SET reminded_at = ? WHERE id = ? AND reminded_at IS NULL",
+		at.UTC(), todoID,
+	)
+	if err != nil {
+		log.Printf("MarkReminded: Database error: %v", err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"todo-app/models"
+)
+
+// Session functions
+func CreateSession(session models.Session) error {
+	log.Printf("CreateSession: Creating session %s for user %d", session.ID, session.UserID)
+	_, err := db.Exec(
+		"INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip_address, created_at, last_seen_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		session.ID, session.UserID, session.RefreshTokenHash, session.UserAgent, session.IPAddress,
+		session.CreatedAt, session.CreatedAt, session.ExpiresAt,
+	)
+	if err != nil {
+		log.Printf("CreateSession: Database error: %v", err)
+	}
+	return err
+}
+
+const sessionColumns = "id, user_id, refresh_token_hash, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at"
+
+func scanSession(row rowScanner) (models.Session, error) {
+	var session models.Session
+	var lastSeenAt, revokedAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.RefreshTokenHash, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &lastSeenAt, &session.ExpiresAt, &revokedAt)
+	session.LastSeenAt = session.CreatedAt
+	if lastSeenAt.Valid {
+		session.LastSeenAt = lastSeenAt.Time
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, err
+}
+
+func GetSession(id string) (models.Session, error) {
+	return scanSession(db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+}
+
+// GetActiveSessions returns the user's sessions that can still be used,
+// most recently active first.
+func GetActiveSessions(userID int64) ([]models.Session, error) {
+	rows, err := db.Query(
+		"SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY COALESCE(last_seen_at, created_at) DESC",
+		userID, time.Now().UTC(),
+	)
+	if err != nil {
+		log.Printf("GetActiveSessions: Database error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			log.Printf("GetActiveSessions: Error scanning row: %v", err)
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RotateSessionToken swaps the session's refresh token hash for a new one.
+// The swap only happens while oldHash is still current and the session is
+// live, so two concurrent refreshes with the same token cannot both win.
+func RotateSessionToken(id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE sessions SET refresh_token_hash = ?, expires_at = ?, last_seen_at = ? WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL",
+		newHash, expiresAt, time.Now().UTC(), id, oldHash,
+	)
+	if err != nil {
+		log.Printf("RotateSessionToken: Database error: %v", err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func RevokeSession(id string) error {
+	log.Printf("RevokeSession: Revoking session %s", id)
+	_, err := db.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), id,
+	)
+	return err
+}
+
+// RevokeUserSession revokes one of the user's sessions. It reports false
+// when no live session with that ID belongs to the user.
+func RevokeUserSession(userID int64, id string) (bool, error) {
+	log.Printf("RevokeUserSession: Revoking session %s for user %d", id, userID)
+	result, err := db.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), id, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeOtherSessions revokes every session of the user except exceptID and
+// returns how many were revoked. Pass an empty exceptID to revoke them all.
+func RevokeOtherSessions(userID int64, exceptID string) (int64, error) {
+	log.Printf("RevokeOtherSessions: Revoking sessions of user %d except %q", userID, exceptID)
+	result, err := db.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id != ? AND revoked_at IS NULL",
+		time.Now().UTC(), userID, exceptID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// TouchSession records activity on a session. Writes are skipped while the
+// stored last-seen time is younger than minInterval so busy clients do not
+// turn every request into a database write.
+func TouchSession(id, ipAddress string, minInterval time.Duration) error {
+	now := time.Now().UTC()
+	_, err := db.Exec(
+		"UPDATE sessions SET last_seen_at = ?, ip_address = ? WHERE id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)",
+		now, ipAddress, id, now.Add(-minInterval),
+	)
+	return err
+}
+
+// IsSessionActive reports whether the session exists, belongs to the user
+// and has been neither revoked nor allowed to expire.
+func IsSessionActive(id string, userID int64) (bool, error) {
+	var active bool
+	err := db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sessions WHERE id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?)",
+		id, userID, time.Now().UTC(),
+	).Scan(&active)
+	return active, err
+}
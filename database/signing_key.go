@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"todo-app/models"
+)
+
+// Signing key functions
+func CreateSigningKey(key models.SigningKey) error {
+	log.Printf("CreateSigningKey: Storing %s key %s", key.Algorithm, key.ID)
+	_, err := db.Exec(
+		"INSERT INTO signing_keys (id, algorithm, key_data, created_at) VALUES (?, ?, ?, ?)",
+		key.ID, key.Algorithm, key.KeyData, key.CreatedAt.UTC(),
+	)
+	if err != nil {
+		log.Printf("CreateSigningKey: Database error: %v", err)
+	}
+	return err
+}
+
+// GetSigningKeys returns the keys that can still verify tokens, oldest
+// first.
+func GetSigningKeys() ([]models.SigningKey, error) {
+	rows, err := db.Query(
+		"SELECT id, algorithm, key_data, created_at, retired_at, expires_at FROM signing_keys WHERE expires_at IS NULL OR expires_at > ? ORDER BY created_at",
+		time.Now().UTC(),
+	)
+	if err != nil {
+		log.Printf("GetSigningKeys: Database error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var key models.SigningKey
+		var retiredAt, expiresAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Algorithm, &key.KeyData, &key.CreatedAt, &retiredAt, &expiresAt); err != nil {
+			log.Printf("GetSigningKeys: Error scanning row: %v", err)
+			return nil, err
+		}
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RetireSigningKey stops a key from signing; it keeps verifying tokens
+// until expiresAt.
+func RetireSigningKey(id string, retiredAt, expiresAt time.Time) error {
+	log.Printf("RetireSigningKey: Retiring key %s, verifiable until %s", id, expiresAt)
+	_, err := db.Exec(
+		"UPDATE signing_keys SET retired_at = ?, expires_at = ? WHERE id = ? AND retired_at IS NULL",
+		retiredAt.UTC(), expiresAt.UTC(), id,
+	)
+	return err
+}
+
+// DeleteExpiredSigningKeys removes keys whose grace period is over.
+func DeleteExpiredSigningKeys() (int64, error) {
+	result, err := db.Exec(
+		"DELETE FROM signing_keys WHERE expires_at IS NOT NULL AND expires_at <= ?",
+		time.Now().UTC(),
+	)
+	if err != nil {
+		log.Printf("DeleteExpiredSigningKeys: Database error: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"todo-app/config"
+	"todo-app/models"
+)
+
+var (
+	// ErrParentNotFound is returned when a todo is made a subtask of a todo
+	// that is not one of the user's.
+	ErrParentNotFound = errors.New("database: parent todo not found")
+	// ErrSubtaskCycle is returned when a todo is made a subtask of itself
+	// or of one of its own subtasks.
+	ErrSubtaskCycle = errors.New("database: todo cannot be its own subtask")
+	// ErrSubtaskDepth is returned when a move would nest todos deeper than
+	// the configured subtask depth.
+	ErrSubtaskDepth = errors.New("database: subtasks nested too deep")
+	// ErrSubtaskList is returned when a subtask is put on a list; subtasks
+	// stay on the list of their parent.
+	ErrSubtaskList = errors.New("database: subtasks stay on their parent's list")
+	// ErrOpenSubtasks is returned when completing a todo with unfinished
+	// subtasks under config.ParentCompletionBlock.
+	ErrOpenSubtasks = errors.New("database: todo has open subtasks")
+)
+
+var todosConfig = config.Default().Todos
+
+// SetTodosConfig sets the subtask depth and the parent completion rule.
+func SetTodosConfig(cfg config.TodosConfig) {
+	todosConfig = cfg
+}
+
+// subtreeCTE selects a todo of the user and all of its subtasks, with how
+// deep each is below it; the todo itself is at depth 1. It takes the todo
+// and user IDs.
+const subtreeCTE = `WITH RECURSIVE subtree(id, depth) AS (
+	SELECT id, 1 FROM todos WHERE id = ? AND user_id = ?
+	UNION ALL
+	SELECT t.id, s.depth + 1 FROM todos t JOIN subtree s ON t.parent_id = s.id
+) `
+
+// todoDepth returns how deep a todo of the user is nested, 1 at the top
+// level, or sql.ErrNoRows when there is no such todo.
+func todoDepth(tx *sql.Tx, userID, todoID int64) (int, error) {
+	var depth sql.NullInt64
+	err := tx.QueryRow(`WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+		SELECT id, parent_id, 1 FROM todos WHERE id = ? AND user_id = ?
+		UNION ALL
+		SELECT t.id, t.parent_id, a.depth + 1 FROM todos t JOIN ancestors a ON t.id = a.parent_id
+	) SELECT MAX(depth) FROM ancestors`, todoID, userID).Scan(&depth)
+	if err == nil && !depth.Valid {
+		err = sql.ErrNoRows
+	}
+	return int(depth.Int64), err
+}
+
+// checkParent checks that a todo, zero for a new one, can become a
+// subtask of parentID without a cycle or nesting too deep. It returns the
+// list of the parent, which its subtasks share.
+func checkParent(tx *sql.Tx, userID, todoID, parentID int64) (int64, error) {
+	depth, err := todoDepth(tx, userID, parentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrParentNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	height := 1
+	if todoID != 0 {
+		var inSubtree bool
+		err := tx.QueryRow(
+			subtreeCTE+"SELECT COALESCE(MAX(depth), 1), EXISTS(SELECT 1 FROM subtree WHERE id = ?) FROM subtree",
+			todoID, userID, parentID,
+		).Scan(&height, &inSubtree)
+		if err != nil {
+			return 0, err
+		}
+		if inSubtree {
+			return 0, ErrSubtaskCycle
+		}
+	}
+	if depth+height > todosConfig.SubtaskDepth {
+		return 0, ErrSubtaskDepth
+	}
+
+	var listID sql.NullInt64
+	err = tx.QueryRow("SELECT list_id FROM todos WHERE id = ? AND user_id = ?", parentID, userID).Scan(&listID)
+	if err != nil {
+		return 0, err
+	}
+	if !listID.Valid {
+		return inboxID(tx, userID)
+	}
+	return listID.Int64, nil
+}
+
+// hasOpenSubtasks reports whether a todo has unfinished subtasks at any
+// depth.
+func hasOpenSubtasks(tx *sql.Tx, userID, todoID int64) (bool, error) {
+	var open bool
+	err := tx.QueryRow(
+		subtreeCTE+"SELECT EXISTS(SELECT 1 FROM todos WHERE id IN (SELECT id FROM subtree WHERE depth > 1) AND NOT completed)",
+		todoID, userID,
+	).Scan(&open)
+	return open, err
+}
+
+// completeSubtasks completes every unfinished subtask of a todo.
+func completeSubtasks(tx *sql.Tx, userID, todoID int64) error {
+	_, err := tx.Exec(
+		subtreeCTE+"UPDATE todos SET completed = TRUE, updated_at = ? WHERE id IN (SELECT id FROM subtree WHERE depth > 1) AND NOT completed",
+		todoID, userID, time.Now(),
+	)
+	return err
+}
+
+// moveSubtasks puts every subtask of a todo on the given list.
+func moveSubtasks(tx *sql.Tx, userID, todoID, listID int64) error {
+	_, err := tx.Exec(
+		subtreeCTE+"UPDATE todos SET list_id = ? WHERE id IN (SELECT id FROM subtree WHERE depth > 1)",
+		todoID, userID, listID,
+	)
+	return err
+}
+
+// attachProgress fills in the subtask progress of todos, all of which
+// belong to the user.
+func attachProgress(userID int64, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	query := `SELECT parent_id, COUNT(*), SUM(CASE WHEN completed THEN 1 ELSE 0 END)
+		FROM todos WHERE user_id = ? AND parent_id IS NOT NULL`
+	args := []any{userID}
+	if len(todos) == 1 {
+		query += " AND parent_id = ?"
+		args = append(args, todos[0].ID)
+	}
+	rows, err := db.Query(query+" GROUP BY parent_id", args...)
+	if err != nil {
+		log.Printf("attachProgress: Database error: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	progress := make(map[int64]models.Progress)
+	for rows.Next() {
+		var parentID int64
+		var p models.Progress
+		if err := rows.Scan(&parentID, &p.Total, &p.Done); err != nil {
+			return err
+		}
+		progress[parentID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range todos {
+		todos[i].Progress = progress[todos[i].ID]
+	}
+	return nil
+}
+
+// GetTodoTree returns a todo of the user with its subtasks nested under
+// it, each level in the manual order.
+func GetTodoTree(userID, todoID int64) (models.Todo, error) {
+	log.Printf("GetTodoTree: Fetching todo ID %d with subtasks for user ID %d", todoID, userID)
+	rows, err := db.Query(
+		subtreeCTE+"SELECT "+todoColumns+" FROM todos WHERE id IN (SELECT id FROM subtree) ORDER BY position, id",
+		todoID, userID,
+	)
+	if err != nil {
+		log.Printf("GetTodoTree: Database error: %v", err)
+		return models.Todo{}, err
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			log.Printf("GetTodoTree: Error scanning row: %v", err)
+			return models.Todo{}, err
+		}
+		todos = append(todos, todo)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Todo{}, err
+	}
+	if len(todos) == 0 {
+		return models.Todo{}, sql.ErrNoRows
+	}
+	if err := attachTags(userID, todos); err != nil {
+		log.Printf("GetTodoTree: Error loading tags: %v", err)
+		return models.Todo{}, err
+	}
+	if err := attachProgress(userID, todos); err != nil {
+		log.Printf("GetTodoTree: Error loading progress: %v", err)
+		return models.Todo{}, err
+	}
+
+	root := -1
+	children := make(map[int64][]int)
+	for i, todo := range todos {
+		if todo.ID == todoID {
+			root = i
+		} else if todo.ParentID != nil {
+			children[*todo.ParentID] = append(children[*todo.ParentID], i)
+		}
+	}
+	var nest func(i int) models.Todo
+	nest = func(i int) models.Todo {
+		todo := todos[i]
+		for _, child := range children[todo.ID] {
+			todo.Subtasks = append(todo.Subtasks, nest(child))
+		}
+		return todo
+	}
+	return nest(root), nil
+}
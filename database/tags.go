@@ -0,0 +1,202 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"todo-app/models"
+)
+
+// ErrTagExists is returned when a user already has a tag of that name.
+var ErrTagExists = errors.New("database: tag already exists")
+
+// ListTags returns the user's tags by name, with how many todos carry each.
+func ListTags(userID int64) ([]models.TagStats, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.name, t.color, COUNT(tt.todo_id)
+		FROM tags t LEFT JOIN todo_tags tt ON tt.tag_id = t.id
+		WHERE t.user_id = ?
+		GROUP BY t.id ORDER BY t.name`,
+		userID,
+	)
+	if err != nil {
+		log.Printf("ListTags: Database error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.TagStats{}
+	for rows.Next() {
+		var tag models.TagStats
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.TodoCount); err != nil {
+			log.Printf("ListTags: Error scanning tag: %v", err)
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func CreateTag(userID int64, input models.CreateTagInput) (models.Tag, error) {
+	log.Printf("CreateTag: Creating tag %q for user %d", input.Name, userID)
+	color := input.Color
+	if color == "" {
+		color = models.DefaultTagColor
+	}
+	now := time.Now()
+	result, err := db.Exec(
+		"INSERT INTO tags (user_id, name, color, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		userID, input.Name, color, now, now,
+	)
+	if isUniqueViolation(err) {
+		return models.Tag{}, ErrTagExists
+	}
+	if err != nil {
+		log.Printf("CreateTag: Database error: %v", err)
+		return models.Tag{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.Tag{}, err
+	}
+	return models.Tag{ID: id, Name: input.Name, Color: color}, nil
+}
+
+// UpdateTag renames or recolors a tag of the user.
+func UpdateTag(userID, tagID int64, input models.UpdateTagInput) (models.Tag, error) {
+	log.Printf("UpdateTag: Updating tag %d of user %d", tagID, userID)
+	var tag models.Tag
+	err := db.QueryRow("SELECT id, name, color FROM tags WHERE id = ? AND user_id = ?", tagID, userID).
+		Scan(&tag.ID, &tag.Name, &tag.Color)
+	if err != nil {
+		return models.Tag{}, err
+	}
+	if input.Name != "" {
+		tag.Name = input.Name
+	}
+	if input.Color != "" {
+		tag.Color = input.Color
+	}
+
+	_, err = db.Exec(
+		"UPDATE tags SET name = ?, color = ?, updated_at = ? WHERE id = ? AND user_id = ?",
+		tag.Name, tag.Color, time.Now(), tagID, userID,
+	)
+	if isUniqueViolation(err) {
+		return models.Tag{}, ErrTagExists
+	}
+	if err != nil {
+		log.Printf("UpdateTag: Database error: %v", err)
+		return models.Tag{}, err
+	}
+	return tag, nil
+}
+
+// DeleteTag deletes a tag of the user and takes it off every todo.
+func DeleteTag(userID, tagID int64) error {
+	log.Printf("DeleteTag: Deleting tag %d of user %d", tagID, userID)
+	result, err := db.Exec("DELETE FROM tags WHERE id = ? AND user_id = ?", tagID, userID)
+	if err != nil {
+		log.Printf("DeleteTag: Database error: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// setTodoTags replaces the tags of a todo with the named ones, creating
+// the tags the user does not have yet.
+func setTodoTags(tx *sql.Tx, userID, todoID int64, names []string) error {
+	if _, err := tx.Exec("DELETE FROM todo_tags WHERE todo_id = ?", todoID); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO tags (user_id, name, color, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			userID, name, models.DefaultTagColor, now, now,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"INSERT OR IGNORE INTO todo_tags (todo_id, tag_id) SELECT ?, id FROM tags WHERE user_id = ? AND name = ?",
+			todoID, userID, name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachTags fills in the tags of todos, all of which belong to the user.
+func attachTags(userID int64, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	query := `SELECT tt.todo_id, t.id, t.name, t.color
+		FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id
+		WHERE t.user_id = ?`
+	args := []any{userID}
+	if len(todos) == 1 {
+		query += " AND tt.todo_id = ?"
+		args = append(args, todos[0].ID)
+	}
+	rows, err := db.Query(query+" ORDER BY t.name", args...)
+	if err != nil {
+		log.Printf("attachTags: Database error: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	tags := make(map[int64][]models.Tag)
+	for rows.Next() {
+		var todoID int64
+		var tag models.Tag
+		if err := rows.Scan(&todoID, &tag.ID, &tag.Name, &tag.Color); err != nil {
+			return err
+		}
+		tags[todoID] = append(tags[todoID], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range todos {
+		todos[i].Tags = tags[todos[i].ID]
+		if todos[i].Tags == nil {
+			todos[i].Tags = []models.Tag{}
+		}
+	}
+	return nil
+}
+
+// tagFilter is the WHERE condition on todos selecting those carrying all,
+// or with matchAny any, of the named tags.
+func tagFilter(names []string, matchAny bool) (string, []any) {
+	conditions := make([]string, len(names))
+	args := make([]any, len(names))
+	for i, name := range names {
+		conditions[i] = `EXISTS (SELECT 1 FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id
+			WHERE tt.todo_id = todos.id AND t.name = ?)`
+		args[i] = strings.TrimSpace(name)
+	}
+	join := " AND "
+	if matchAny {
+		join = " OR "
+	}
+	return "(" + strings.Join(conditions, join) + ")", args
+}
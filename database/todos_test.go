@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"todo-app/config"
+	"todo-app/models"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// setupTodos opens a fresh database with one user and returns the user's
+// ID.
+func setupTodos(t *testing.T, todos config.TodosConfig) int64 {
+	t.Helper()
+	if err := InitDB(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "todo.db")}); err != nil {
+		t.Fatal(err)
+	}
+	previous := todosConfig
+	SetTodosConfig(todos)
+	t.Cleanup(func() {
+		Close()
+		SetTodosConfig(previous)
+	})
+	user, err := CreateUser(models.RegisterInput{Username: "alice", Email: "alice@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// failTagWrites makes every write to todo_tags fail, the last step of
+// creating and updating todos.
+func failTagWrites(t *testing.T) {
+	t.Helper()
+	_, err := db.Exec(`CREATE TRIGGER fail_todo_tags BEFORE INSERT ON todo_tags
+		BEGIN SELECT RAISE(ABORT, 'todo_tags is read-only'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustCreateTodo(t *testing.T, userID int64, input models.CreateTodoInput) models.Todo {
+	t.Helper()
+	todo, err := CreateTodo(userID, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func TestCreateTodoRollsBack(t *testing.T) {
+	userID := setupTodos(t, config.Default().Todos)
+	failTagWrites(t)
+
+	if _, err := CreateTodo(userID, models.CreateTodoInput{Title: "tagged", Tags: []string{"work"}}); err == nil {
+		t.Fatal("CreateTodo succeeded with failing tag writes")
+	}
+	var todos, tags int
+	if err := db.QueryRow("SELECT (SELECT COUNT(*) FROM todos), (SELECT COUNT(*) FROM tags)").Scan(&todos, &tags); err != nil {
+		t.Fatal(err)
+	}
+	if todos != 0 || tags != 0 {
+		t.Errorf("left %d todos and %d tags behind, want none", todos, tags)
+	}
+}
+
+func TestUpdateTodoRollsBack(t *testing.T) {
+	todosCfg := config.Default().Todos
+	todosCfg.ParentCompletion = config.ParentCompletionCascade
+	userID := setupTodos(t, todosCfg)
+
+	work, err := CreateList(userID, models.CreateListInput{Name: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := mustCreateTodo(t, userID, models.CreateTodoInput{Title: "parent"})
+	child := mustCreateTodo(t, userID, models.CreateTodoInput{Title: "child", ParentID: parent.ID})
+	failTagWrites(t)
+
+	// Moving and completing the parent touches the subtask too, and the tag
+	// write at the end fails
+	tags := []string{"work"}
+	err = UpdateTodo(userID, parent.ID, models.UpdateTodoInput{Title: "renamed", ListID: work.ID, Completed: true, Tags: &tags})
+	if err == nil {
+		t.Fatal("UpdateTodo succeeded with failing tag writes")
+	}
+
+	for _, before := range []models.Todo{parent, child} {
+		after, err := GetTodoByID(userID, before.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Title != before.Title || after.Completed || after.ListID != before.ListID {
+			t.Errorf("todo %q changed to %q, completed %v, list %d; want it untouched on list %d",
+				before.Title, after.Title, after.Completed, after.ListID, before.ListID)
+		}
+	}
+}
+
+func TestUpdateTodoCascades(t *testing.T) {
+	todosCfg := config.Default().Todos
+	todosCfg.ParentCompletion = config.ParentCompletionCascade
+	userID := setupTodos(t, todosCfg)
+
+	work, err := CreateList(userID, models.CreateListInput{Name: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := mustCreateTodo(t, userID, models.CreateTodoInput{Title: "parent"})
+	child := mustCreateTodo(t, userID, models.CreateTodoInput{Title: "child", ParentID: parent.ID})
+	grandchild := mustCreateTodo(t, userID, models.CreateTodoInput{Title: "grandchild", ParentID: child.ID})
+
+	tags := []string{"work"}
+	if err := UpdateTodo(userID, parent.ID, models.UpdateTodoInput{ListID: work.ID, Completed: true, Tags: &tags}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{parent.ID, child.ID, grandchild.ID} {
+		todo, err := GetTodoByID(userID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !todo.Completed || todo.ListID != work.ID {
+			t.Errorf("todo %q: completed %v on list %d, want completed on list %d", todo.Title, todo.Completed, todo.ListID, work.ID)
+		}
+	}
+	if got, _ := GetTodoByID(userID, parent.ID); len(got.Tags) != 1 || got.Tags[0].Name != "work" {
+		t.Errorf("parent tags = %+v, want work", got.Tags)
+	}
+}
+
+func TestUpdateTodoSubtaskRules(t *testing.T) {
+	todosCfg := config.Default().Todos
+	todosCfg.SubtaskDepth = 2
+	todosCfg.ParentCompletion = config.ParentCompletionBlock
+	userID := setupTodos(t, todosCfg)
+
+	parent := mustCreateTodo(t, userID, models.CreateTodoInput{Title: "parent"})
+	child := mustCreateTodo(t, userID, models.CreateTodoInput{Title: "child", ParentID: parent.ID})
+	other := mustCreateTodo(t, userID, models.CreateTodoInput{Title: "other"})
+
+	if _, err := CreateTodo(userID, models.CreateTodoInput{Title: "too deep", ParentID: child.ID}); !errors.Is(err, ErrSubtaskDepth) {
+		t.Errorf("creating a third level: %v, want ErrSubtaskDepth", err)
+	}
+	if err := UpdateTodo(userID, parent.ID, models.UpdateTodoInput{ParentID: models.OptionalID{Set: true, ID: &child.ID}}); !errors.Is(err, ErrSubtaskCycle) {
+		t.Errorf("moving a todo under its subtask: %v, want ErrSubtaskCycle", err)
+	}
+	if err := UpdateTodo(userID, parent.ID, models.UpdateTodoInput{ParentID: models.OptionalID{Set: true, ID: &other.ID}}); !errors.Is(err, ErrSubtaskDepth) {
+		t.Errorf("nesting a todo with subtasks: %v, want ErrSubtaskDepth", err)
+	}
+	if err := UpdateTodo(userID, parent.ID, models.UpdateTodoInput{Completed: true}); !errors.Is(err, ErrOpenSubtasks) {
+		t.Errorf("completing with open subtasks: %v, want ErrOpenSubtasks", err)
+	}
+	missing := int64(9999)
+	if err := UpdateTodo(userID, other.ID, models.UpdateTodoInput{ParentID: models.OptionalID{Set: true, ID: &missing}}); !errors.Is(err, ErrParentNotFound) {
+		t.Errorf("moving under a missing todo: %v, want ErrParentNotFound", err)
+	}
+	if err := UpdateTodo(userID, missing, models.UpdateTodoInput{Title: "x"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("updating a missing todo: %v, want sql.ErrNoRows", err)
+	}
+}
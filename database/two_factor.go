@@ -0,0 +1,216 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Two-factor functions
+
+// SetPendingTOTPSecret stores a freshly generated secret for a user who has
+// not enabled two-factor authentication yet. The secret only takes effect
+// once EnableTwoFactor confirms it; it returns sql.ErrNoRows if two-factor
+// authentication is already enabled.
+func SetPendingTOTPSecret(userID int64, secret string) error {
+	log.Printf("SetPendingTOTPSecret: Storing pending TOTP secret for user %d", userID)
+	result, err := db.Exec(
+		"UPDATE users SET totp_secret = ?, totp_last_step = 0, updated_at = ? WHERE id = ? AND totp_enabled_at IS NULL",
+		secret, time.Now(), userID,
+	)
+	if err != nil {
+		log.Printf("SetPendingTOTPSecret: Database error: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetTOTPSecret returns the user's TOTP secret, pending or enabled, and the
+// last time step a code was accepted for. The secret is empty if setup was
+// never started.
+func GetTOTPSecret(userID int64) (string, int64, error) {
+	var secret sql.NullString
+	var lastStep int64
+	err := db.QueryRow("SELECT totp_secret, totp_last_step FROM users WHERE id = ?", userID).Scan(&secret, &lastStep)
+	return secret.String, lastStep, err
+}
+
+// GetTOTPSecrets returns the stored TOTP secret of every user who has one,
+// by user ID.
+func GetTOTPSecrets() (map[int64]string, error) {
+	rows, err := db.Query("SELECT id, totp_secret FROM users WHERE totp_secret IS NOT NULL")
+	if err != nil {
+		log.Printf("GetTOTPSecrets: Database error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	secrets := make(map[int64]string)
+	for rows.Next() {
+		var userID int64
+		var secret string
+		if err := rows.Scan(&userID, &secret); err != nil {
+			return nil, err
+		}
+		secrets[userID] = secret
+	}
+	return secrets, rows.Err()
+}
+
+// ReplaceTOTPSecret swaps the stored secret for a re-encoded form of the
+// same secret, if it is still the one read. It reports whether it was
+// replaced; it is not when the user set up or disabled two-factor
+// authentication in the meantime.
+func ReplaceTOTPSecret(userID int64, old, replacement string) (bool, error) {
+	result, err := db.Exec("UPDATE users SET totp_secret = ? WHERE id = ? AND totp_secret = ?", replacement, userID, old)
+	if err != nil {
+		log.Printf("ReplaceTOTPSecret: Database error: %v", err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RecordTOTPStep remembers the time step of an accepted code so the same
+// code cannot be used twice. It reports false if that step, or a later one,
+// was already used.
+func RecordTOTPStep(userID, step int64) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?",
+		step, userID, step,
+	)
+	if err != nil {
+		log.Printf("RecordTOTPStep: Database error: %v", err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// EnableTwoFactor switches two-factor authentication on for the pending
+// secret and replaces the user's recovery codes.
+func EnableTwoFactor(userID int64, codeHashes []string) error {
+	log.Printf("EnableTwoFactor: Enabling two-factor authentication for user %d", userID)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(
+		"UPDATE users SET totp_enabled_at = ?, updated_at = ? WHERE id = ? AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL",
+		now.UTC(), now, userID,
+	)
+	if err != nil {
+		log.Printf("EnableTwoFactor: Database error: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		log.Printf("EnableTwoFactor: Error storing recovery codes: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableTwoFactor removes the user's TOTP secret and recovery codes.
+func DisableTwoFactor(userID int64) error {
+	log.Printf("DisableTwoFactor: Disabling two-factor authentication for user %d", userID)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = ? WHERE id = ?",
+		time.Now(), userID,
+	)
+	if err != nil {
+		log.Printf("DisableTwoFactor: Database error: %v", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		log.Printf("DisableTwoFactor: Error deleting recovery codes: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes invalidates every existing recovery code of the user
+// and stores the given hashes instead.
+func ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	log.Printf("ReplaceRecoveryCodes: Replacing recovery codes for user %d", userID)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		log.Printf("ReplaceRecoveryCodes: Database error: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)",
+			userID, hash, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used and reports
+// whether one matched.
+func ConsumeRecoveryCode(userID int64, codeHash string) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, codeHash,
+	)
+	if err != nil {
+		log.Printf("ConsumeRecoveryCode: Database error: %v", err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func CountRecoveryCodes(userID int64) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Purposes of the single-use tokens stored in user_tokens.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// User token functions
+func CreateUserToken(userID int64, purpose, tokenHash string, expiresAt time.Time) error {
+	log.Printf("CreateUserToken: Creating %s token for user %d", purpose, userID)
+	_, err := db.Exec(
+		"INSERT INTO user_tokens (user_id, purpose, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		userID, purpose, tokenHash, time.Now().UTC(), expiresAt.UTC(),
+	)
+	if err != nil {
+		log.Printf("CreateUserToken: Database error: %v", err)
+	}
+	return err
+}
+
+// PeekUserToken returns the user of a valid token without using it up. It
+// returns sql.ErrNoRows for unknown, expired or already used tokens.
+func PeekUserToken(purpose, tokenHash string) (int64, error) {
+	var userID int64
+	err := db.QueryRow(
+		"SELECT user_id FROM user_tokens WHERE purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		purpose, tokenHash, time.Now().UTC(),
+	).Scan(&userID)
+	return userID, err
+}
+
+// ConsumeUserToken marks a valid token as used and returns its user. It
+// returns sql.ErrNoRows for unknown, expired or already used tokens, and a
+// token can only ever be consumed once even under concurrent requests.
+func ConsumeUserToken(purpose, tokenHash string) (int64, error) {
+	now := time.Now().UTC()
+
+	var id, userID int64
+	err := db.QueryRow(
+		"SELECT id, user_id FROM user_tokens WHERE purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		purpose, tokenHash, now,
+	).Scan(&id, &userID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := db.Exec("UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", now, id)
+	if err != nil {
+		log.Printf("ConsumeUserToken: Database error: %v", err)
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+// InvalidateUserTokens marks every outstanding token of the given purpose
+// for the user as used.
+func InvalidateUserTokens(userID int64, purpose string) error {
+	_, err := db.Exec(
+		"UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, purpose,
+	)
+	return err
+}
+
+// LastUserTokenCreatedAt returns when the newest token of the given purpose
+// was issued to the user, or the zero time if there is none.
+func LastUserTokenCreatedAt(userID int64, purpose string) (time.Time, error) {
+	var createdAt time.Time
+	err := db.QueryRow(
+		"SELECT created_at FROM user_tokens WHERE user_id = ? AND purpose = ? ORDER BY created_at DESC LIMIT 1",
+		userID, purpose,
+	).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return createdAt, err
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo-app/database"
+	"todo-app/models"
+	"todo-app/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAccessToken issues a personal access token. The token itself is only
+// returned here; afterwards just its prefix is known.
+func CreateAccessToken(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("CreateAccessToken: Processing request for user ID: %d", userID)
+
+	var input models.CreateAccessTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("CreateAccessToken: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret, prefix, err := tokens.GeneratePersonalAccessToken()
+	if err != nil {
+		log.Printf("CreateAccessToken: Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	now := time.Now().UTC()
+	token := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      input.Name,
+		Prefix:    prefix,
+		TokenHash: tokens.Hash(secret),
+		Scopes:    uniqueScopes(input.Scopes),
+		CreatedAt: now,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, input.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	token, err = database.CreateAccessToken(token)
+	if err != nil {
+		log.Printf("CreateAccessToken: Failed to store token for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	log.Printf("CreateAccessToken: Created token %d (%s) for user ID: %d", token.ID, token.Prefix, userID)
+	recordAudit(c, models.AuditTokenCreated, userID, gin.H{"token_id": token.ID, "name": token.Name, "scopes": token.Scopes})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":        secret,
+		"access_token": token,
+	})
+}
+
+func GetAccessTokens(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("GetAccessTokens: Processing request for user ID: %d", userID)
+
+	accessTokens, err := database.GetAccessTokens(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tokens"})
+		return
+	}
+	if accessTokens == nil {
+		accessTokens = []models.PersonalAccessToken{}
+	}
+
+	c.JSON(http.StatusOK, accessTokens)
+}
+
+func DeleteAccessToken(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+	log.Printf("DeleteAccessToken: Revoking token %d for user ID: %d", id, userID)
+
+	deleted, err := database.DeleteAccessToken(userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	recordAudit(c, models.AuditTokenRevoked, userID, gin.H{"token_id": id})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+}
+
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	unique := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeleteAccount schedules the account for deletion after the configured grace
+// period and signs it out everywhere. Logging in again before the period is
+// over restores the account.
+func DeleteAccount(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("DeleteAccount: Processing request for user ID: %d", userID)
+
+	var input models.DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("DeleteAccount: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("DeleteAccount: Failed to get user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		return
+	}
+
+	if !checkLoginAllowed(c, user.Username, &user) || checkAccountLocked(c, user) {
+		return
+	}
+	confirmed, err := confirmPassword(c.Request.Context(), user, input.Password)
+	if err != nil {
+		log.Printf("DeleteAccount: Failed to check password for user ID %d: %v", userID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication service unavailable"})
+		return
+	}
+	if !confirmed {
+		log.Printf("DeleteAccount: Invalid password for user ID %d", userID)
+		recordLoginFailure(c, user.Username, &user)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	deleteAt := time.Now().Add(cfg.Account.DeletionGracePeriod.Std())
+	if err := database.ScheduleUserDeletion(userID, deleteAt); err != nil {
+		log.Printf("DeleteAccount: Failed to schedule deletion for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if _, err := database.RevokeOtherSessions(userID, ""); err != nil {
+		log.Printf("DeleteAccount: Failed to revoke sessions for user ID %d: %v", userID, err)
+	}
+	clearAuthCookies(c)
+	log.Printf("DeleteAccount: User ID %d scheduled for deletion at %s", userID, deleteAt)
+	recordAudit(c, models.AuditAccountDeleted, userID, gin.H{"deletion_scheduled_at": deleteAt.UTC()})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "Account scheduled for deletion. Log in again before the deletion date to restore it.",
+		"deletion_scheduled_at": deleteAt.UTC(),
+	})
+}
+
+// ExportAccount returns everything stored about the user as a downloadable
+// JSON document.
+func ExportAccount(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("ExportAccount: Processing request for user ID: %d", userID)
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("ExportAccount: Failed to get user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		return
+	}
+	user.Password = ""
+
+	todos, err := database.GetTodos(userID, models.TodoQuery{Archived: true, Subtasks: true})
+	if err != nil {
+		log.Printf("ExportAccount: Failed to get todos for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+
+	lists, err := database.ListLists(userID, true)
+	if err != nil {
+		log.Printf("ExportAccount: Failed to get lists for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	tags, err := database.ListTags(userID)
+	if err != nil {
+		log.Printf("ExportAccount: Failed to get tags for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	sessions, err := database.GetActiveSessions(userID)
+	if err != nil {
+		log.Printf("ExportAccount: Failed to get sessions for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+	for i := range sessions {
+		sessions[i].Device = describeUserAgent(sessions[i].UserAgent)
+		sessions[i].Current = sessions[i].ID == c.GetString("session_id")
+	}
+
+	now := time.Now().UTC()
+	filename := fmt.Sprintf("todo-export-%s-%s.json", user.Username, now.Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"exported_at": now,
+		"user":        user,
+		"todos":       todos,
+		"lists":       lists,
+		"tags":        tags,
+		"sessions":    sessions,
+	})
+}
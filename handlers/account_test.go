@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func deleteProfile(r *gin.Engine, password string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"password": %q}`, password)
+	req := httptest.NewRequest(http.MethodDelete, "/api/profile", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Wrong passwords when deleting the account count as failed logins, so a
+// stolen session cannot be used to guess the password.
+func TestDeleteAccountLimitsGuesses(t *testing.T) {
+	setupTest(t, func(c *config.Config) {
+		c.RateLimit.LoginAccountAttempts = 3
+		c.RateLimit.LockoutThreshold = 100
+	})
+	user, err := database.CreateUser(models.RegisterInput{Username: "judy", Email: "judy@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.DELETE("/api/profile", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		DeleteAccount(c)
+	})
+
+	for i := range 3 {
+		if w := deleteProfile(r, fmt.Sprintf("guess %d", i)); w.Code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: status = %d, want 400", i+1, w.Code)
+		}
+	}
+	assertTooManyAttempts(t, deleteProfile(r, "correct horse battery"))
+
+	stored, err := database.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLoginCount != 3 {
+		t.Errorf("failed logins = %d, want 3", stored.FailedLoginCount)
+	}
+	if stored.DeletionScheduledAt != nil {
+		t.Error("account scheduled for deletion")
+	}
+}
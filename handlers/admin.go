@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"todo-app/database"
+	"todo-app/models"
+	"todo-app/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultUserPageSize = 50
+
+// AdminListUsers returns a page of all users, newest last.
+func AdminListUsers(c *gin.Context) {
+	log.Printf("AdminListUsers: Processing request from admin ID: %d", c.GetInt64("user_id"))
+
+	var query models.ListUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Printf("AdminListUsers: Invalid query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultUserPageSize
+	}
+
+	users, total, err := database.ListUsers(query.Limit, query.Offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":  users,
+		"total":  total,
+		"limit":  query.Limit,
+		"offset": query.Offset,
+	})
+}
+
+// AdminDisableUser blocks an account from logging in and signs it out
+// everywhere. Its access tokens stop working until it is enabled again.
+func AdminDisableUser(c *gin.Context) {
+	userID, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+	log.Printf("AdminDisableUser: Admin ID %d disabling user ID %d", c.GetInt64("user_id"), userID)
+
+	if !applyUserChange(c, database.SetUserDisabled(userID, true), "Failed to disable user") {
+		return
+	}
+	if _, err := database.RevokeOtherSessions(userID, ""); err != nil {
+		log.Printf("AdminDisableUser: Failed to revoke sessions for user ID %d: %v", userID, err)
+	}
+	recordAudit(c, models.AuditUserDisabled, userID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User disabled"})
+}
+
+// AdminEnableUser lifts a previous AdminDisableUser.
+func AdminEnableUser(c *gin.Context) {
+	userID, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+	log.Printf("AdminEnableUser: Admin ID %d enabling user ID %d", c.GetInt64("user_id"), userID)
+
+	if !applyUserChange(c, database.SetUserDisabled(userID, false), "Failed to enable user") {
+		return
+	}
+	recordAudit(c, models.AuditUserEnabled, userID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User enabled"})
+}
+
+// AdminForcePasswordReset replaces the user's password with a random one
+// nobody knows, signs them out everywhere, revokes their access tokens and
+// emails them a reset link.
+func AdminForcePasswordReset(c *gin.Context) {
+	userID, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+	log.Printf("AdminForcePasswordReset: Admin ID %d forcing a password reset for user ID %d", c.GetInt64("user_id"), userID)
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		applyUserChange(c, err, "Failed to reset password")
+		return
+	}
+	if refuseDirectoryAccount(c, userID, "Failed to reset password") {
+		return
+	}
+
+	password, err := tokens.Generate(32)
+	if err != nil {
+		log.Printf("AdminForcePasswordReset: Failed to generate password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if err := database.UpdateUserPassword(userID, password); err != nil {
+		log.Printf("AdminForcePasswordReset: Failed to update password for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if _, err := database.RevokeOtherSessions(userID, ""); err != nil {
+		log.Printf("AdminForcePasswordReset: Failed to revoke sessions for user ID %d: %v", userID, err)
+	}
+	if _, err := database.DeleteUserAccessTokens(userID); err != nil {
+		log.Printf("AdminForcePasswordReset: Failed to revoke access tokens for user ID %d: %v", userID, err)
+	}
+
+	emailSent := true
+	if err := sendPasswordResetEmail(user, true); err != nil {
+		log.Printf("AdminForcePasswordReset: Failed to issue reset link for user ID %d: %v", userID, err)
+		emailSent = false
+	}
+	recordAudit(c, models.AuditPasswordResetForced, userID, gin.H{"email_sent": emailSent})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Password reset",
+		"email_sent": emailSent,
+	})
+}
+
+// AdminSetUserRole promotes a user to admin or demotes them. The last
+// enabled admin cannot be demoted.
+func AdminSetUserRole(c *gin.Context) {
+	userID, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	var input models.SetRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("AdminSetUserRole: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("AdminSetUserRole: Admin ID %d setting role %q for user ID %d", c.GetInt64("user_id"), input.Role, userID)
+
+	if !applyUserChange(c, database.SetUserRole(userID, input.Role), "Failed to change role") {
+		return
+	}
+	recordAudit(c, models.AuditUserRoleChanged, userID, gin.H{"role": input.Role})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "role": input.Role})
+}
+
+// AdminGetStats returns counts of users, todos, sessions and access tokens.
+func AdminGetStats(c *gin.Context) {
+	log.Printf("AdminGetStats: Processing request from admin ID: %d", c.GetInt64("user_id"))
+
+	stats, err := database.GetSystemStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// adminTargetUser reads the user ID from the path. Admins may not use these
+// endpoints on their own account, so they cannot lock themselves out.
+func adminTargetUser(c *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	if userID == c.GetInt64("user_id") {
+		log.Printf("adminTargetUser: Admin ID %d tried to change their own account at %s", userID, c.Request.URL.Path)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own account here"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// applyUserChange writes the error response for a failed change to a user
+// and reports whether it succeeded.
+func applyUserChange(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, database.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "At least one enabled admin must remain"})
+	default:
+		log.Printf("applyUserChange: %s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
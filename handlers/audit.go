@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditPageSize = 50
+	// Browsers send a few hundred bytes; anything longer is cut so a client
+	// cannot fill the log with one header
+	maxAuditUserAgent = 512
+)
+
+// recordAudit adds a security event about the user to the audit log, with
+// the client IP and user agent of the request. The signed-in caller, if
+// any, is recorded as the actor. A userID of 0 means no known account.
+// Failures are only logged; they must not fail the request.
+func recordAudit(c *gin.Context, event string, userID int64, details gin.H) {
+	entry := models.AuditEvent{
+		Event:     event,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	}
+	if len(entry.UserAgent) > maxAuditUserAgent {
+		entry.UserAgent = entry.UserAgent[:maxAuditUserAgent]
+	}
+	if userID != 0 {
+		entry.UserID = &userID
+	}
+	if actorID := c.GetInt64("user_id"); actorID != 0 {
+		entry.ActorID = &actorID
+	}
+	if err := database.CreateAuditEvent(entry); err != nil {
+		log.Printf("recordAudit: Failed to record %s for user ID %d: %v", event, userID, err)
+	}
+}
+
+// GetSecurityLog returns the signed-in user's own security events, newest
+// first.
+func GetSecurityLog(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("GetSecurityLog: Processing request for user ID: %d", userID)
+
+	var query models.ListUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Printf("GetSecurityLog: Invalid query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	listAuditEvents(c, models.AuditQuery{UserID: userID, Limit: query.Limit, Offset: query.Offset})
+}
+
+// AdminListAuditEvents searches the security log of all users by user,
+// event, IP address and time range.
+func AdminListAuditEvents(c *gin.Context) {
+	log.Printf("AdminListAuditEvents: Processing request from admin ID: %d", c.GetInt64("user_id"))
+
+	var query models.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Printf("AdminListAuditEvents: Invalid query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	listAuditEvents(c, query)
+}
+
+func listAuditEvents(c *gin.Context, query models.AuditQuery) {
+	if query.Limit == 0 {
+		query.Limit = defaultAuditPageSize
+	}
+	events, total, err := database.ListAuditEvents(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get security log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"total":  total,
+		"limit":  query.Limit,
+		"offset": query.Offset,
+	})
+}
@@ -1,19 +1,54 @@
 package handlers
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"todo-app/authn"
+	"todo-app/config"
 	"todo-app/database"
+	"todo-app/keyring"
+	"todo-app/mail"
 	"todo-app/models"
+	"todo-app/ratelimit"
+	"todo-app/tokens"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtKey = []byte("your-secret-key") // In production, use environment variable
+var (
+	cfg                       = config.Default()
+	mailer        mail.Mailer = &mail.LogMailer{}
+	keyRing       *keyring.Ring
+	authenticator authn.Authenticator = authn.Local{}
+)
+
+// Init hands the handlers the application configuration. It must be called
+// before the router starts serving requests.
+func Init(c *config.Config) {
+	cfg = c
+	loginLimits = newLoginLimiters(cfg.RateLimit, ratelimit.NewMemoryStore())
+	authenticator = authn.New(cfg)
+	initSSOProviders()
+}
+
+// SetKeyRing hands the handlers the key ring tokens are signed with. It must
+// be called before the router starts serving requests.
+func SetKeyRing(r *keyring.Ring) {
+	keyRing = r
+}
+
+// SetMailer replaces the mailer used for account emails, which by default
+// only logs them.
+func SetMailer(m mail.Mailer) {
+	mailer = m
+}
 
 func Register(c *gin.Context) {
 	log.Printf("Register: Starting registration process")
@@ -26,37 +61,69 @@ func Register(c *gin.Context) {
 	}
 	log.Printf("Register: Received registration request for email: %s", input.Email)
 
+	if !checkPasswordPolicy(c, input.Password, input.Username, input.Email) {
+		return
+	}
+
 	user, err := database.CreateUser(input)
+	if errors.Is(err, database.ErrUserExists) {
+		log.Printf("Register: Username %s or email %s is taken", input.Username, input.Email)
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this username or email already exists"})
+		return
+	}
 	if err != nil {
 		log.Printf("Register: Failed to create user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	log.Printf("Register: Successfully created user with ID: %d", user.ID)
+	recordAudit(c, models.AuditAccountRegistered, user.ID, nil)
+
+	verificationRequired := false
+	if cfg.Auth.EmailVerification != config.EmailVerificationOff {
+		if err := sendVerificationEmail(user); err != nil {
+			log.Printf("Register: Failed to send verification email to user ID %d: %v", user.ID, err)
+		}
+		verificationRequired = cfg.Auth.EmailVerification == config.EmailVerificationRequired
+	} else {
+		// Nothing to verify, so the address counts as confirmed
+		if err := database.MarkEmailVerified(user.ID); err != nil {
+			log.Printf("Register: Failed to mark email verified for user ID %d: %v", user.ID, err)
+		} else {
+			user.EmailVerifiedAt = &user.CreatedAt
+		}
+	}
+
+	// Accounts that must verify first get no session until they do
+	if verificationRequired {
+		c.JSON(http.StatusCreated, gin.H{
+			"user":                  user,
+			"verification_required": true,
+			"message":               "Account created. Check your email to verify your address before logging in.",
+		})
+		return
+	}
 
-	// Generate JWT token
-	token, err := generateToken(user.ID)
+	// Start a session and issue tokens
+	issued, err := issueSession(c, user)
 	if err != nil {
-		log.Printf("Register: Failed to generate token: %v", err)
+		log.Printf("Register: Failed to issue session: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-	log.Printf("Register: Successfully generated token for user ID: %d", user.ID)
-
-	// Set token as cookie
-	c.SetCookie("token", token, 24*60*60, "/", "", false, true)
-	log.Printf("Register: Set token cookie for user ID: %d", user.ID)
+	log.Printf("Register: Successfully issued session for user ID: %d", user.ID)
 
 	c.JSON(http.StatusCreated, gin.H{
-		"user":  user,
-		"token": token,
+		"user":          user,
+		"token":         issued.AccessToken,
+		"refresh_token": issued.RefreshToken,
+		"expires_in":    issued.ExpiresIn,
 	})
 	log.Printf("Register: Sent successful response for user ID: %d", user.ID)
 }
 
 func Login(c *gin.Context) {
 	log.Printf("Login: Starting login process")
-	log.Printf("Login: Request headers: %v", c.Request.Header)
 
 	var input models.LoginInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -64,45 +131,186 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	log.Printf("Login: Received login request for username: %s", input.Username)
+	identifier := input.LoginIdentifier()
+	log.Printf("Login: Received login request for identifier: %s", identifier)
 
-	user, err := database.GetUserByUsername(input.Username)
-	if err != nil {
-		log.Printf("Login: User not found for username %s: %v", input.Username, err)
+	// Lockouts and rate limits are kept per local account, which directory
+	// users only have after their first login
+	var known *models.User
+	if existing, err := database.GetUserByIdentifier(identifier); err == nil {
+		known = &existing
+	}
+	if !checkLoginAllowed(c, identifier, known) {
+		return
+	}
+	if known != nil && checkAccountLocked(c, *known) {
+		return
+	}
+
+	user, err := authenticator.Authenticate(c.Request.Context(), identifier, input.Password)
+	switch {
+	case errors.Is(err, authn.ErrInvalidCredentials):
+		log.Printf("Login: Invalid credentials for %s", identifier)
+		recordLoginFailure(c, identifier, known)
+		var knownID int64
+		if known != nil {
+			knownID = known.ID
+		}
+		recordAudit(c, models.AuditLoginFailed, knownID, gin.H{"identifier": identifier, "reason": "invalid_credentials"})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
+	case errors.Is(err, authn.ErrAccountConflict):
+		log.Printf("Login: Credentials for %s belong to a different account", identifier)
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this username or email already exists"})
+		return
+	case err != nil:
+		log.Printf("Login: Authentication failed for %s: %v", identifier, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication service unavailable"})
+		return
+	}
+	log.Printf("Login: Credentials verified for user ID: %d", user.ID)
+
+	// The credentials may have resolved to an account the identifier did
+	// not name, e.g. a directory user linked by email
+	if known == nil || known.ID != user.ID {
+		if checkAccountLocked(c, user) {
+			return
+		}
+	}
+	if checkAccountDisabled(c, user) {
+		return
+	}
+
+	if user.EmailVerifiedAt == nil && cfg.Auth.EmailVerification == config.EmailVerificationRequired {
+		log.Printf("Login: Email not verified for user ID: %d", user.ID)
+		recordAudit(c, models.AuditLoginFailed, user.ID, gin.H{"reason": "email_not_verified"})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Email address not verified",
+			"code":  "email_not_verified",
+		})
+		return
+	}
+
+	// Accounts with two-factor authentication get a pending token that
+	// LoginTwoFactor exchanges for a session once a code is entered
+	if user.TwoFactorEnabledAt != nil {
+		mfaToken, err := generateMFAToken(user.ID)
+		if err != nil {
+			log.Printf("Login: Failed to generate MFA token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		log.Printf("Login: Second factor required for user ID: %d", user.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int(cfg.Auth.MFATokenTTL.Std().Seconds()),
+		})
+		return
 	}
-	log.Printf("Login: Found user with ID: %d", user.ID)
 
-	// Compare passwords
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password))
+	completeLogin(c, user)
+}
+
+// completeLogin starts a session for a fully authenticated user and writes
+// the login response.
+func completeLogin(c *gin.Context, user models.User) {
+	recordLoginSuccess(user)
+
+	restored, err := restoreAccount(c, &user)
 	if err != nil {
-		log.Printf("Login: Invalid password for user ID %d: %v", user.ID, err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		log.Printf("Login: Failed to restore user ID %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
 		return
 	}
-	log.Printf("Login: Password verified for user ID: %d", user.ID)
 
-	// Generate JWT token
-	token, err := generateToken(user.ID)
+	// Start a session and issue tokens
+	issued, err := issueSession(c, user)
 	if err != nil {
-		log.Printf("Login: Failed to generate token: %v", err)
+		log.Printf("Login: Failed to issue session: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-	log.Printf("Login: Successfully generated token for user ID: %d", user.ID)
-
-	// Set token as cookie
-	c.SetCookie("token", token, 24*60*60, "/", "", false, true)
-	log.Printf("Login: Set token cookie for user ID: %d", user.ID)
+	log.Printf("Login: Successfully issued session for user ID: %d", user.ID)
+	recordAudit(c, models.AuditLoginSucceeded, user.ID, gin.H{"two_factor": user.TwoFactorEnabledAt != nil})
 
 	c.JSON(http.StatusOK, gin.H{
-		"user":  user,
-		"token": token,
+		"user":             user,
+		"token":            issued.AccessToken,
+		"refresh_token":    issued.RefreshToken,
+		"expires_in":       issued.ExpiresIn,
+		"account_restored": restored,
 	})
 	log.Printf("Login: Sent successful response for user ID: %d", user.ID)
 }
 
+// confirmPassword re-checks the password of a signed-in user before a
+// sensitive change, using the same backends as login.
+func confirmPassword(ctx context.Context, user models.User, password string) (bool, error) {
+	confirmed, err := authenticator.Authenticate(ctx, user.Username, password)
+	if errors.Is(err, authn.ErrInvalidCredentials) || errors.Is(err, authn.ErrAccountConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return confirmed.ID == user.ID, nil
+}
+
+// refuseDirectoryAccount answers 409 and returns true for an account linked
+// to a directory entry, whose password is managed in the directory. A local
+// password would not reach the directory, and would keep working after the
+// directory password changes or the entry is disabled. failure is the error
+// shown if the check itself fails.
+func refuseDirectoryAccount(c *gin.Context, userID int64, failure string) bool {
+	directory, err := authn.IsDirectoryUser(userID)
+	if err != nil {
+		log.Printf("refuseDirectoryAccount: Failed to check identities of user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return true
+	}
+	if !directory {
+		return false
+	}
+	log.Printf("refuseDirectoryAccount: Refused password change for directory user ID %d on %s", userID, c.Request.URL.Path)
+	c.JSON(http.StatusConflict, gin.H{
+		"error": "This account's password is managed by your organization's directory and cannot be changed here",
+		"code":  "directory_account",
+	})
+	return true
+}
+
+// checkAccountDisabled turns away accounts an admin has disabled, writing a
+// 403 response. It must only run once the credentials are verified, so that
+// the answer tells nothing to someone guessing passwords.
+func checkAccountDisabled(c *gin.Context, user models.User) bool {
+	if user.DisabledAt == nil {
+		return false
+	}
+	log.Printf("checkAccountDisabled: Login attempt for disabled user ID %d from %s", user.ID, c.ClientIP())
+	recordAudit(c, models.AuditLoginFailed, user.ID, gin.H{"reason": "account_disabled"})
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": "This account has been disabled",
+		"code":  "account_disabled",
+	})
+	return true
+}
+
+// restoreAccount cancels a pending deletion, since logging in during the
+// grace period restores the account. It reports whether there was one.
+func restoreAccount(c *gin.Context, user *models.User) (bool, error) {
+	if user.DeletionScheduledAt == nil {
+		return false, nil
+	}
+	if err := database.CancelUserDeletion(user.ID); err != nil {
+		return false, err
+	}
+	user.DeletionScheduledAt = nil
+	log.Printf("restoreAccount: Restored account scheduled for deletion, user ID: %d", user.ID)
+	recordAudit(c, models.AuditAccountRestored, user.ID, nil)
+	return true, nil
+}
+
 func GetProfile(c *gin.Context) {
 	userID := c.GetInt64("user_id")
 	log.Printf("GetProfile: Processing request for user ID: %d", userID)
@@ -121,21 +329,300 @@ func GetProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-func generateToken(userID int64) (string, error) {
-	log.Printf("generateToken: Generating token for user ID: %d", userID)
+// ChangePassword replaces the user's password after checking the current one,
+// then signs out every other session so a stolen login stops working.
+func ChangePassword(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("ChangePassword: Processing request for user ID: %d", userID)
+
+	var input models.ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("ChangePassword: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("ChangePassword: Failed to get user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		return
+	}
+
+	if refuseDirectoryAccount(c, userID, "Failed to change password") {
+		return
+	}
+
+	if !checkLoginAllowed(c, user.Username, &user) || checkAccountLocked(c, user) {
+		return
+	}
+	confirmed, err := confirmPassword(c.Request.Context(), user, input.CurrentPassword)
+	if err != nil {
+		log.Printf("ChangePassword: Failed to check password for user ID %d: %v", userID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication service unavailable"})
+		return
+	}
+	if !confirmed {
+		log.Printf("ChangePassword: Invalid current password for user ID %d", userID)
+		recordLoginFailure(c, user.Username, &user)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if !checkPasswordPolicy(c, input.NewPassword, user.Username, user.Email) {
+		return
+	}
+
+	if err := database.UpdateUserPassword(userID, input.NewPassword); err != nil {
+		log.Printf("ChangePassword: Failed to update password for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	revoked, err := database.RevokeOtherSessions(userID, c.GetString("session_id"))
+	if err != nil {
+		log.Printf("ChangePassword: Failed to revoke other sessions for user ID %d: %v", userID, err)
+	} else {
+		log.Printf("ChangePassword: Revoked %d other sessions for user ID %d", revoked, userID)
+	}
+	if _, err := database.DeleteUserAccessTokens(userID); err != nil {
+		log.Printf("ChangePassword: Failed to revoke access tokens for user ID %d: %v", userID, err)
+	}
+	recordAudit(c, models.AuditPasswordChanged, userID, gin.H{"sessions_revoked": revoked})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Every refresh token is single-use: presenting one that has
+// already been rotated out means it was copied, so the whole session is
+// revoked.
+func RefreshToken(c *gin.Context) {
+	log.Printf("RefreshToken: Processing request")
+
+	refreshToken, err := c.Cookie(refreshCookieName)
+	if err != nil || refreshToken == "" {
+		var input models.RefreshInput
+		if err := c.ShouldBindJSON(&input); err == nil {
+			refreshToken = input.RefreshToken
+		}
+	}
+	if refreshToken == "" {
+		log.Printf("RefreshToken: No refresh token provided")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token is required"})
+		return
+	}
+
+	sessionID, _, _ := strings.Cut(refreshToken, ".")
+	session, err := database.GetSession(sessionID)
+	if err != nil {
+		log.Printf("RefreshToken: Session %s not found: %v", sessionID, err)
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		log.Printf("RefreshToken: Session %s is revoked or expired", session.ID)
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired or been revoked"})
+		return
+	}
+
+	oldHash := tokens.Hash(refreshToken)
+	if subtle.ConstantTimeCompare([]byte(oldHash), []byte(session.RefreshTokenHash)) != 1 {
+		log.Printf("RefreshToken: Reuse of a rotated refresh token detected for session %s (user %d), revoking session", session.ID, session.UserID)
+		recordAudit(c, models.AuditRefreshTokenReused, session.UserID, gin.H{"session_id": session.ID})
+		if err := database.RevokeSession(session.ID); err != nil {
+			log.Printf("RefreshToken: Failed to revoke session %s: %v", session.ID, err)
+		}
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	newRefreshToken, err := generateRefreshToken(session.ID)
+	if err != nil {
+		log.Printf("RefreshToken: Failed to generate refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	expiresAt := time.Now().UTC().Add(cfg.Auth.RefreshTokenTTL.Std())
+	rotated, err := database.RotateSessionToken(session.ID, oldHash, tokens.Hash(newRefreshToken), expiresAt)
+	if err != nil {
+		log.Printf("RefreshToken: Failed to rotate refresh token for session %s: %v", session.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	if !rotated {
+		// Another request rotated the same token first.
+		log.Printf("RefreshToken: Concurrent use of refresh token for session %s, revoking session", session.ID)
+		recordAudit(c, models.AuditRefreshTokenReused, session.UserID, gin.H{"session_id": session.ID, "concurrent": true})
+		if err := database.RevokeSession(session.ID); err != nil {
+			log.Printf("RefreshToken: Failed to revoke session %s: %v", session.ID, err)
+		}
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	// Access tokens carry the role, so it is read afresh on every refresh
+	user, err := database.GetUserByID(session.UserID)
+	if err != nil {
+		log.Printf("RefreshToken: User not found for ID %d: %v", session.UserID, err)
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if user.DisabledAt != nil {
+		log.Printf("RefreshToken: User ID %d is disabled, revoking session %s", user.ID, session.ID)
+		if err := database.RevokeSession(session.ID); err != nil {
+			log.Printf("RefreshToken: Failed to revoke session %s: %v", session.ID, err)
+		}
+		clearAuthCookies(c)
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been disabled", "code": "account_disabled"})
+		return
+	}
+
+	accessToken, err := generateToken(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	issued := sessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    int(cfg.Auth.AccessTokenTTL.Std().Seconds()),
+	}
+	setAuthCookies(c, issued)
+	log.Printf("RefreshToken: Rotated refresh token for session %s", session.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         issued.AccessToken,
+		"refresh_token": issued.RefreshToken,
+		"expires_in":    issued.ExpiresIn,
+	})
+}
+
+func Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	log.Printf("Logout: Revoking session %s for user ID: %d", sessionID, c.GetInt64("user_id"))
+
+	if err := database.RevokeSession(sessionID); err != nil {
+		log.Printf("Logout: Failed to revoke session %s: %v", sessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	clearAuthCookies(c)
+	recordAudit(c, models.AuditSessionRevoked, c.GetInt64("user_id"), gin.H{"session_id": sessionID, "reason": "logout"})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+const (
+	accessCookieName  = "token"
+	refreshCookieName = "refresh_token"
+	// The refresh token is only ever needed by the refresh endpoint, so the
+	// browser is told not to send it anywhere else.
+	refreshCookiePath = "/api/token"
+)
+
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+// issueSession records a new session for the user, sets the auth cookies
+// and returns the tokens so they can also be included in the response body.
+func issueSession(c *gin.Context, user models.User) (sessionTokens, error) {
+	sessionID, err := tokens.Generate(16)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	refreshToken, err := generateRefreshToken(sessionID)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	now := time.Now().UTC()
+	err = database.CreateSession(models.Session{
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: tokens.Hash(refreshToken),
+		UserAgent:        c.Request.UserAgent(),
+		IPAddress:        c.ClientIP(),
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(cfg.Auth.RefreshTokenTTL.Std()),
+	})
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	accessToken, err := generateToken(user, sessionID)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	issued := sessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(cfg.Auth.AccessTokenTTL.Std().Seconds()),
+	}
+	setAuthCookies(c, issued)
+	return issued, nil
+}
+
+// generateRefreshToken prefixes the random secret with the session ID so the
+// session can be found without a lookup by hash.
+func generateRefreshToken(sessionID string) (string, error) {
+	secret, err := tokens.Generate(32)
+	if err != nil {
+		return "", err
+	}
+	return sessionID + "." + secret, nil
+}
+
+func setAuthCookies(c *gin.Context, issued sessionTokens) {
+	// SameSite=Lax keeps the cookies off cross-site POSTs in browsers that
+	// support it, on top of the CSRF token check
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(accessCookieName, issued.AccessToken, issued.ExpiresIn, "/", "", cfg.Auth.SecureCookies, true)
+	c.SetCookie(refreshCookieName, issued.RefreshToken, int(cfg.Auth.RefreshTokenTTL.Std().Seconds()), refreshCookiePath, "", cfg.Auth.SecureCookies, true)
+}
+
+func clearAuthCookies(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(accessCookieName, "", -1, "/", "", cfg.Auth.SecureCookies, true)
+	c.SetCookie(refreshCookieName, "", -1, refreshCookiePath, "", cfg.Auth.SecureCookies, true)
+}
+
+func generateToken(user models.User, sessionID string) (string, error) {
+	log.Printf("generateToken: Generating token for user ID: %d", user.ID)
+
+	jti, err := tokens.Generate(16)
+	if err != nil {
+		return "", err
+	}
 
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
+		"user_id": user.ID,
+		"role":    user.Role,
+		"sid":     sessionID,
+		"jti":     jti,
+		"aud":     cfg.Auth.Audience,
+		"iat":     now.Unix(),
+		"nbf":     now.Unix(),
+		"exp":     now.Add(cfg.Auth.AccessTokenTTL.Std()).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := keyRing.Sign(claims)
 	if err != nil {
-		log.Printf("generateToken: Failed to sign token for user ID %d: %v", userID, err)
+		log.Printf("generateToken: Failed to sign token for user ID %d: %v", user.ID, err)
 		return "", err
 	}
 
-	log.Printf("generateToken: Successfully generated token for user ID: %d", userID)
+	log.Printf("generateToken: Successfully generated token for user ID: %d", user.ID)
 	return tokenString, nil
 }
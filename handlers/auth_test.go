@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// changePasswordRouter serves ChangePassword as if the user were signed in.
+func changePasswordRouter(userID int64) *gin.Engine {
+	r := gin.New()
+	r.PUT("/api/profile/password", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		ChangePassword(c)
+	})
+	return r
+}
+
+func putPassword(r *gin.Engine, current, next string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"current_password": %q, "new_password": %q}`, current, next)
+	req := httptest.NewRequest(http.MethodPut, "/api/profile/password", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// createDirectoryUser creates an account linked to an LDAP entry, with the
+// local password "correct horse battery".
+func createDirectoryUser(t *testing.T, username string) models.User {
+	t.Helper()
+	user, err := database.CreateUser(models.RegisterInput{Username: username, Email: username + "@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.CreateUserIdentity(models.UserIdentity{
+		UserID:    user.ID,
+		Provider:  "ldap",
+		Subject:   "uid=" + username + ",ou=people,dc=example,dc=com",
+		Email:     user.Email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestChangePassword(t *testing.T) {
+	setupTest(t, nil)
+	user, err := database.CreateUser(models.RegisterInput{Username: "grace", Email: "grace@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := changePasswordRouter(user.ID)
+
+	if w := putPassword(r, "wrong password", "staple battery horse"); w.Code != http.StatusBadRequest {
+		t.Fatalf("wrong current password: status = %d, want 400", w.Code)
+	}
+	if w := putPassword(r, "correct horse battery", "staple battery horse"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	confirmed, err := confirmPassword(context.Background(), user, "staple battery horse")
+	if err != nil || !confirmed {
+		t.Errorf("new password not accepted: %v, %v", confirmed, err)
+	}
+}
+
+func TestChangePasswordRefusesDirectoryAccounts(t *testing.T) {
+	setupTest(t, nil)
+	user := createDirectoryUser(t, "jdoe")
+
+	w := putPassword(changePasswordRouter(user.ID), "correct horse battery", "staple battery horse")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"directory_account"`) {
+		t.Fatalf("status = %d, body %s; want 409 directory_account", w.Code, w.Body)
+	}
+	confirmed, err := confirmPassword(context.Background(), user, "correct horse battery")
+	if err != nil || !confirmed {
+		t.Errorf("old password no longer accepted: %v, %v", confirmed, err)
+	}
+}
+
+// Someone holding a stolen session cannot use the current password check
+// to guess the password: failures share the login limits and lockout.
+func TestChangePasswordLimitsGuesses(t *testing.T) {
+	setupTest(t, func(c *config.Config) {
+		c.RateLimit.LoginAccountAttempts = 3
+		c.RateLimit.LockoutThreshold = 100
+	})
+	user, err := database.CreateUser(models.RegisterInput{Username: "heidi", Email: "heidi@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := changePasswordRouter(user.ID)
+	r.POST("/api/login", Login)
+
+	for i := range 3 {
+		if w := putPassword(r, fmt.Sprintf("guess %d", i), "staple battery horse"); w.Code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: status = %d, want 400", i+1, w.Code)
+		}
+	}
+	assertTooManyAttempts(t, putPassword(r, "correct horse battery", "staple battery horse"))
+	assertTooManyAttempts(t, postLogin(r, "192.0.2.1", "heidi", "correct horse battery"))
+}
+
+func TestChangePasswordLocksAccount(t *testing.T) {
+	setupTest(t, func(c *config.Config) {
+		c.RateLimit.LockoutThreshold = 2
+	})
+	user, err := database.CreateUser(models.RegisterInput{Username: "ivan", Email: "ivan@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := changePasswordRouter(user.ID)
+
+	for i := range 2 {
+		putPassword(r, fmt.Sprintf("guess %d", i), "staple battery horse")
+	}
+	stored, err := database.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLoginCount != 2 || stored.LockedUntil == nil {
+		t.Fatalf("failed logins = %d, locked until %v; want 2 and locked", stored.FailedLoginCount, stored.LockedUntil)
+	}
+	if w := putPassword(r, "correct horse battery", "staple battery horse"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("locked account: status = %d, want 429", w.Code)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listIconPattern matches icon names such as "briefcase" or "cart-shopping".
+var listIconPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// GetLists returns the user's lists with their todo counts. Archived lists
+// are included with ?archived=true.
+func GetLists(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("GetLists: Processing request for user ID: %d", userID)
+
+	var query models.ListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Printf("GetLists: Invalid query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lists, err := database.ListLists(userID, query.Archived)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list lists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lists)
+}
+
+func CreateList(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("CreateList: Processing request for user ID: %d", userID)
+
+	var input models.CreateListInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("CreateList: Invalid input format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "List name is required"})
+		return
+	}
+	if input.Icon != "" && !listIconPattern.MatchString(input.Icon) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list icon"})
+		return
+	}
+
+	list, err := database.CreateList(userID, input)
+	if !applyListChange(c, err, "Failed to create list") {
+		return
+	}
+
+	c.JSON(http.StatusCreated, list)
+}
+
+// UpdateList renames, recolors, archives or restores a list.
+func UpdateList(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	listID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list ID"})
+		return
+	}
+	log.Printf("UpdateList: Processing request for list ID %d of user ID: %d", listID, userID)
+
+	var input models.UpdateListInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("UpdateList: Invalid input format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Icon != "" && !listIconPattern.MatchString(input.Icon) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list icon"})
+		return
+	}
+
+	list, err := database.UpdateList(userID, listID, input)
+	if !applyListChange(c, err, "Failed to update list") {
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteList deletes a list; its todos move to the Inbox.
+func DeleteList(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	listID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list ID"})
+		return
+	}
+	log.Printf("DeleteList: Processing request for list ID %d of user ID: %d", listID, userID)
+
+	if !applyListChange(c, database.DeleteList(userID, listID), "Failed to delete list") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "List deleted"})
+}
+
+// applyListChange writes the error response for a failed change to a list
+// and reports whether it succeeded.
+func applyListChange(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "List not found"})
+	case errors.Is(err, database.ErrInboxList):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The Inbox cannot be archived or deleted"})
+	default:
+		log.Printf("applyListChange: %s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/models"
+	"todo-app/normalize"
+	"todo-app/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginLimiters throttle failed logins per client IP and per account, and
+// password reset requests per client IP.
+type loginLimiters struct {
+	byIP      *ratelimit.Limiter
+	byAccount *ratelimit.Limiter
+	resetByIP *ratelimit.Limiter
+}
+
+var loginLimits = newLoginLimiters(cfg.RateLimit, ratelimit.NewMemoryStore())
+
+func newLoginLimiters(rl config.RateLimitConfig, store ratelimit.Store) loginLimiters {
+	return loginLimiters{
+		byIP:      ratelimit.New(store, rl.LoginIPAttempts, rl.LoginWindow.Std()),
+		byAccount: ratelimit.New(store, rl.LoginAccountAttempts, rl.LoginWindow.Std()),
+		resetByIP: ratelimit.New(store, rl.PasswordResetIPAttempts, rl.LoginWindow.Std()),
+	}
+}
+
+// SetRateLimitStore replaces the in-memory store behind the login rate
+// limits, e.g. with one shared by several server instances. It must be
+// called after Init.
+func SetRateLimitStore(store ratelimit.Store) {
+	loginLimits = newLoginLimiters(cfg.RateLimit, store)
+}
+
+func ipLimitKey(c *gin.Context) string {
+	return "login:ip:" + c.ClientIP()
+}
+
+// accountLimitKey names the bucket failed logins are counted in. Once the
+// identifier resolves to an account, the account ID is used, so logging in
+// by username and by email count against the same bucket.
+func accountLimitKey(identifier string, user *models.User) string {
+	if user != nil {
+		return "login:user:" + strconv.FormatInt(user.ID, 10)
+	}
+	return "login:account:" + normalize.Identifier(identifier)
+}
+
+// checkLoginAllowed answers 429 and returns false when the client IP or the
+// account has used up its failed attempts. user is the account the
+// identifier names, or nil if there is none yet.
+func checkLoginAllowed(c *gin.Context, identifier string, user *models.User) bool {
+	for _, check := range []struct {
+		limiter *ratelimit.Limiter
+		key     string
+	}{
+		{loginLimits.byIP, ipLimitKey(c)},
+		{loginLimits.byAccount, accountLimitKey(identifier, user)},
+	} {
+		ok, retryAfter, err := check.limiter.Allow(check.key)
+		if err != nil {
+			// Fail open: a broken limiter store must not lock everyone out
+			log.Printf("checkLoginAllowed: Rate limit store error for %s: %v", check.key, err)
+			continue
+		}
+		if !ok {
+			log.Printf("checkLoginAllowed: Rate limit exceeded for %s, retry after %s", check.key, retryAfter)
+			respondTooManyAttempts(c, retryAfter, tooManyLoginsMessage)
+			return false
+		}
+	}
+	return true
+}
+
+// checkAccountLocked answers 429 and returns true while the account is
+// locked out after repeated failures.
+func checkAccountLocked(c *gin.Context, user models.User) bool {
+	if user.LockedUntil == nil {
+		return false
+	}
+	retryAfter := time.Until(*user.LockedUntil)
+	if retryAfter <= 0 {
+		return false
+	}
+	log.Printf("checkAccountLocked: Login attempt for locked account user ID %d from %s, locked for another %s",
+		user.ID, c.ClientIP(), retryAfter.Round(time.Second))
+	recordAudit(c, models.AuditLoginFailed, user.ID, gin.H{"reason": "locked"})
+	respondTooManyAttempts(c, retryAfter, tooManyLoginsMessage)
+	return true
+}
+
+// recordLoginFailure counts a failed attempt against the client IP and the
+// account. When the identifier belongs to an account, its consecutive
+// failures are also persisted and the account locked once they pass the
+// threshold.
+func recordLoginFailure(c *gin.Context, identifier string, user *models.User) {
+	for _, record := range []struct {
+		limiter *ratelimit.Limiter
+		key     string
+	}{
+		{loginLimits.byIP, ipLimitKey(c)},
+		{loginLimits.byAccount, accountLimitKey(identifier, user)},
+	} {
+		ok, _, err := record.limiter.Record(record.key)
+		if err != nil {
+			log.Printf("recordLoginFailure: Rate limit store error for %s: %v", record.key, err)
+		} else if !ok {
+			log.Printf("recordLoginFailure: %s reached its limit of failed logins", record.key)
+		}
+	}
+
+	if user == nil {
+		return
+	}
+	failures, err := database.RecordFailedLogin(user.ID)
+	if err != nil {
+		return
+	}
+	lockout := lockoutDuration(failures)
+	if lockout == 0 {
+		return
+	}
+	if err := database.LockUser(user.ID, time.Now().Add(lockout)); err != nil {
+		return
+	}
+	log.Printf("recordLoginFailure: Locked account user ID %d for %s after %d consecutive failed logins (last from %s)",
+		user.ID, lockout, failures, c.ClientIP())
+	recordAudit(c, models.AuditAccountLocked, user.ID, gin.H{"failures": failures, "duration_seconds": int(lockout.Seconds())})
+}
+
+// recordLoginSuccess clears the failure history of an account, including
+// failures counted against its username or email before the account was
+// known locally, as with a directory user's first login.
+func recordLoginSuccess(user models.User) {
+	keys := []string{accountLimitKey("", &user), accountLimitKey(user.Username, nil)}
+	if user.Email != "" {
+		keys = append(keys, accountLimitKey(user.Email, nil))
+	}
+	for _, key := range keys {
+		if err := loginLimits.byAccount.Reset(key); err != nil {
+			log.Printf("recordLoginSuccess: Rate limit store error for %s: %v", key, err)
+		}
+	}
+	if user.FailedLoginCount > 0 || user.LockedUntil != nil {
+		if err := database.ResetFailedLogins(user.ID); err != nil {
+			log.Printf("recordLoginSuccess: Failed to reset failed logins for user ID %d: %v", user.ID, err)
+		}
+	}
+}
+
+// lockoutDuration is zero below the threshold, then starts at the base
+// duration and doubles with every further failure up to the maximum.
+func lockoutDuration(failures int) time.Duration {
+	rl := cfg.RateLimit
+	if failures < rl.LockoutThreshold {
+		return 0
+	}
+	d := rl.LockoutDuration.Std()
+	for i := rl.LockoutThreshold; i < failures && d < rl.LockoutMaxDuration.Std(); i++ {
+		d *= 2
+	}
+	return min(d, rl.LockoutMaxDuration.Std())
+}
+
+const tooManyLoginsMessage = "Too many failed login attempts. Please try again later."
+
+// respondTooManyAttempts answers 429 with the time to wait in whole seconds.
+func respondTooManyAttempts(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       message,
+		"code":        "too_many_attempts",
+		"retry_after": seconds,
+	})
+}
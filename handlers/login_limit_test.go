@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupLoginTest opens a fresh database and returns a router serving
+// Login with the given login limits.
+func setupLoginTest(t *testing.T, ipAttempts, accountAttempts int) *gin.Engine {
+	t.Helper()
+	setupTest(t, func(c *config.Config) {
+		c.RateLimit.LoginIPAttempts = ipAttempts
+		c.RateLimit.LoginAccountAttempts = accountAttempts
+	})
+	r := gin.New()
+	r.POST("/api/login", Login)
+	return r
+}
+
+func postLogin(r *gin.Engine, ip, identifier, password string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"identifier": %q, "password": %q}`, identifier, password)
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":40000"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// assertTooManyAttempts checks for a 429 with a Retry-After within the
+// login window.
+func assertTooManyAttempts(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429; body %s", w.Code, w.Body)
+	}
+	seconds, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil {
+		t.Fatalf("Retry-After = %q: %v", w.Header().Get("Retry-After"), err)
+	}
+	if window := int(cfg.RateLimit.LoginWindow.Std().Seconds()); seconds < 1 || seconds > window {
+		t.Errorf("Retry-After = %d, want between 1 and %d", seconds, window)
+	}
+}
+
+// A password spray from one address across many usernames is cut off by
+// the per-IP limit, whether the usernames exist or not.
+func TestLoginLimitsOneIPAcrossUsernames(t *testing.T) {
+	r := setupLoginTest(t, 5, 100)
+	if _, err := database.CreateUser(models.RegisterInput{Username: "alice", Email: "alice@example.com", Password: "correct horse battery"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		w := postLogin(r, "203.0.113.7", fmt.Sprintf("user%d", i), "guess")
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, w.Code)
+		}
+	}
+	assertTooManyAttempts(t, postLogin(r, "203.0.113.7", "alice", "correct horse battery"))
+
+	// Other addresses are not affected
+	if w := postLogin(r, "203.0.113.8", "user0", "guess"); w.Code != http.StatusUnauthorized {
+		t.Errorf("other IP: status = %d, want 401", w.Code)
+	}
+}
+
+// Guessing one account's password from many addresses is cut off by the
+// per-account limit, and logging in by email shares the username's bucket.
+func TestLoginLimitsOneUsernameAcrossIPs(t *testing.T) {
+	r := setupLoginTest(t, 100, 4)
+	if _, err := database.CreateUser(models.RegisterInput{Username: "bob", Email: "bob@example.com", Password: "correct horse battery"}); err != nil {
+		t.Fatal(err)
+	}
+
+	identifiers := []string{"bob", "bob@example.com", "BOB", "Bob@Example.com"}
+	for i, identifier := range identifiers {
+		w := postLogin(r, fmt.Sprintf("198.51.100.%d", i+1), identifier, "guess")
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, w.Code)
+		}
+	}
+	// Even the right password waits for the window
+	assertTooManyAttempts(t, postLogin(r, "198.51.100.99", "bob", "correct horse battery"))
+	assertTooManyAttempts(t, postLogin(r, "198.51.100.100", "bob@example.com", "guess"))
+
+	// Unknown usernames have buckets of their own
+	if w := postLogin(r, "198.51.100.101", "carol", "guess"); w.Code != http.StatusUnauthorized {
+		t.Errorf("other username: status = %d, want 401", w.Code)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	c := config.Default()
+	c.RateLimit.LockoutThreshold = 3
+	c.RateLimit.LockoutDuration = config.Duration(time.Minute)
+	c.RateLimit.LockoutMaxDuration = config.Duration(10 * time.Minute)
+	cfg = c
+
+	for _, tc := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	} {
+		if got := lockoutDuration(tc.failures); got != tc.want {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", tc.failures, got, tc.want)
+		}
+	}
+}
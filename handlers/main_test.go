@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/keyring"
+	"todo-app/passwords"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// setupTest initializes the package with the default config, adjusted by
+// configure, a fresh database and a key ring. The previous settings are
+// restored when the test ends.
+func setupTest(t *testing.T, configure func(*config.Config)) {
+	t.Helper()
+	c := config.Default()
+	c.Database.Path = filepath.Join(t.TempDir(), "todo.db")
+	if configure != nil {
+		configure(c)
+	}
+	if err := database.InitDB(c.Database); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := passwords.NewPolicy(c.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := keyring.New(c.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, previousMailer, previousPolicy, previousRing := cfg, mailer, passwordPolicy, keyRing
+	Init(c)
+	SetPasswordPolicy(policy)
+	SetKeyRing(ring)
+	t.Cleanup(func() {
+		database.Close()
+		Init(previous)
+		mailer = previousMailer
+		passwordPolicy = previousPolicy
+		keyRing = previousRing
+	})
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo-app/database"
+	"todo-app/models"
+	"todo-app/oidc"
+	"todo-app/tokens"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcFlowCookie carries the state, nonce and PKCE verifier of a sign-in
+	// from OIDCLogin to OIDCCallback. It is a signed token, so it cannot be
+	// tampered with, and is only sent to the OIDC routes.
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowPath   = "/auth/oidc"
+	oidcFlowTTL    = 10 * time.Minute
+
+	oidcFlowPurpose = "oidc"
+)
+
+// Reasons for a failed single sign-on, passed to the login page as
+// ?sso_error=.
+const (
+	ssoErrorUnavailable     = "unavailable"
+	ssoErrorExpired         = "expired"
+	ssoErrorDenied          = "denied"
+	ssoErrorFailed          = "failed"
+	ssoErrorEmailUnverified = "email_unverified"
+	// ssoErrorAccountUnverified means an account with the provider's email
+	// exists but never verified it, so it is not linked automatically.
+	ssoErrorAccountUnverified = "account_unverified"
+	ssoErrorNoAccount         = "no_account"
+	ssoErrorAccountDisabled   = "account_disabled"
+)
+
+var (
+	ssoProviders     = map[string]*oidc.Provider{}
+	ssoProviderOrder []*oidc.Provider
+)
+
+func initSSOProviders() {
+	ssoProviders = map[string]*oidc.Provider{}
+	ssoProviderOrder = nil
+	for _, providerCfg := range cfg.OIDC.Providers {
+		provider := oidc.NewProvider(providerCfg)
+		ssoProviders[provider.ID] = provider
+		ssoProviderOrder = append(ssoProviderOrder, provider)
+	}
+}
+
+// SSOProvider is a configured identity provider as shown on the login page.
+type SSOProvider struct {
+	ID   string
+	Name string
+}
+
+// SSOProviders lists the configured identity providers in config order.
+func SSOProviders() []SSOProvider {
+	list := make([]SSOProvider, 0, len(ssoProviderOrder))
+	for _, provider := range ssoProviderOrder {
+		list = append(list, SSOProvider{ID: provider.ID, Name: provider.Name})
+	}
+	return list
+}
+
+func oidcRedirectURI(provider *oidc.Provider) string {
+	return strings.TrimSuffix(cfg.Server.BaseURL, "/") + oidcFlowPath + "/" + provider.ID + "/callback"
+}
+
+// oidcAudience keeps sign-in flow tokens apart from all other tokens.
+func oidcAudience() string {
+	return cfg.Auth.Audience + ":oidc"
+}
+
+func redirectSSOError(c *gin.Context, reason string) {
+	c.Redirect(http.StatusFound, "/login?sso_error="+url.QueryEscape(reason))
+}
+
+// OIDCLogin starts an authorization code flow with PKCE by sending the
+// browser to the identity provider.
+func OIDCLogin(c *gin.Context) {
+	provider, ok := ssoProviders[c.Param("provider")]
+	if !ok {
+		log.Printf("OIDCLogin: Unknown provider %q", c.Param("provider"))
+		redirectSSOError(c, ssoErrorUnavailable)
+		return
+	}
+
+	state, err := tokens.Generate(16)
+	if err != nil {
+		log.Printf("OIDCLogin: Failed to generate state: %v", err)
+		redirectSSOError(c, ssoErrorFailed)
+		return
+	}
+	nonce, err := tokens.Generate(16)
+	if err != nil {
+		log.Printf("OIDCLogin: Failed to generate nonce: %v", err)
+		redirectSSOError(c, ssoErrorFailed)
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		log.Printf("OIDCLogin: Failed to generate PKCE verifier: %v", err)
+		redirectSSOError(c, ssoErrorFailed)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), oidcRedirectURI(provider), state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		log.Printf("OIDCLogin: Provider %s unavailable: %v", provider.ID, err)
+		redirectSSOError(c, ssoErrorUnavailable)
+		return
+	}
+
+	now := time.Now()
+	flow, err := keyRing.Sign(jwt.MapClaims{
+		"purpose":  oidcFlowPurpose,
+		"provider": provider.ID,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"aud":      oidcAudience(),
+		"iat":      now.Unix(),
+		"exp":      now.Add(oidcFlowTTL).Unix(),
+	})
+	if err != nil {
+		log.Printf("OIDCLogin: Failed to sign flow cookie: %v", err)
+		redirectSSOError(c, ssoErrorFailed)
+		return
+	}
+
+	// Lax still sends the cookie on the provider's top-level redirect back
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, flow, int(oidcFlowTTL.Seconds()), oidcFlowPath, "", cfg.Auth.SecureCookies, true)
+	log.Printf("OIDCLogin: Redirecting to provider %s", provider.ID)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes the flow started by OIDCLogin: it checks the state,
+// exchanges the code, verifies the ID token and signs the linked user in.
+func OIDCCallback(c *gin.Context) {
+	provider, ok := ssoProviders[c.Param("provider")]
+	if !ok {
+		log.Printf("OIDCCallback: Unknown provider %q", c.Param("provider"))
+		redirectSSOError(c, ssoErrorUnavailable)
+		return
+	}
+
+	// The flow cookie is single-use whatever the outcome
+	flowToken, _ := c.Cookie(oidcFlowCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, "", -1, oidcFlowPath, "", cfg.Auth.SecureCookies, true)
+
+	flow, err := keyRing.Parse(flowToken, oidcAudience())
+	if err != nil {
+		log.Printf("OIDCCallback: Invalid or missing flow cookie: %v", err)
+		redirectSSOError(c, ssoErrorExpired)
+		return
+	}
+	purpose, _ := flow["purpose"].(string)
+	flowProvider, _ := flow["provider"].(string)
+	state, _ := flow["state"].(string)
+	nonce, _ := flow["nonce"].(string)
+	verifier, _ := flow["verifier"].(string)
+	if purpose != oidcFlowPurpose || flowProvider != provider.ID || state == "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		log.Printf("OIDCCallback: State mismatch for provider %s", provider.ID)
+		redirectSSOError(c, ssoErrorExpired)
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		log.Printf("OIDCCallback: Provider %s returned error %q: %s", provider.ID, errCode, c.Query("error_description"))
+		redirectSSOError(c, ssoErrorDenied)
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		log.Printf("OIDCCallback: No authorization code from provider %s", provider.ID)
+		redirectSSOError(c, ssoErrorFailed)
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), oidcRedirectURI(provider), code, verifier, nonce)
+	if err != nil {
+		log.Printf("OIDCCallback: Code exchange with provider %s failed: %v", provider.ID, err)
+		redirectSSOError(c, ssoErrorFailed)
+		return
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		log.Printf("OIDCCallback: Provider %s did not report a verified email for subject %s", provider.ID, claims.Subject)
+		redirectSSOError(c, ssoErrorEmailUnverified)
+		return
+	}
+
+	user, reason := resolveSSOUser(provider, claims)
+	if reason != "" {
+		redirectSSOError(c, reason)
+		return
+	}
+	if user.DisabledAt != nil {
+		log.Printf("OIDCCallback: User ID %d is disabled", user.ID)
+		recordAudit(c, models.AuditLoginFailed, user.ID, gin.H{"provider": provider.ID, "reason": "account_disabled"})
+		redirectSSOError(c, ssoErrorAccountDisabled)
+		return
+	}
+
+	// The provider replaces the password, not the second factor
+	if user.TwoFactorEnabledAt != nil {
+		mfaToken, err := generateMFAToken(user.ID)
+		if err != nil {
+			log.Printf("OIDCCallback: Failed to generate MFA token: %v", err)
+			redirectSSOError(c, ssoErrorFailed)
+			return
+		}
+		log.Printf("OIDCCallback: Second factor required for user ID: %d", user.ID)
+		c.Redirect(http.StatusFound, "/login#mfa_token="+url.QueryEscape(mfaToken))
+		return
+	}
+
+	recordLoginSuccess(user)
+	if _, err := restoreAccount(c, &user); err != nil {
+		log.Printf("OIDCCallback: Failed to restore user ID %d: %v", user.ID, err)
+		redirectSSOError(c, ssoErrorFailed)
+		return
+	}
+	if _, err := issueSession(c, user); err != nil {
+		log.Printf("OIDCCallback: Failed to issue session: %v", err)
+		redirectSSOError(c, ssoErrorFailed)
+		return
+	}
+	log.Printf("OIDCCallback: Signed in user ID %d through provider %s", user.ID, provider.ID)
+	recordAudit(c, models.AuditLoginSucceeded, user.ID, gin.H{"provider": provider.ID})
+
+	// The login page picks the new session up and continues to the app
+	c.Redirect(http.StatusFound, "/login")
+}
+
+// resolveSSOUser finds the account for a verified provider identity. An
+// identity seen before maps to its linked account; otherwise an account with
+// the same verified email is linked, or a new one is created if the provider
+// allows sign-ups. On failure it returns an sso_error reason.
+func resolveSSOUser(provider *oidc.Provider, claims *oidc.Claims) (models.User, string) {
+	user, err := database.GetUserByIdentity(provider.ID, claims.Subject)
+	if err == nil {
+		if err := database.TouchUserIdentity(provider.ID, claims.Subject, claims.Email); err != nil {
+			log.Printf("resolveSSOUser: Failed to update identity for user ID %d: %v", user.ID, err)
+		}
+		return user, ""
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("resolveSSOUser: Failed to look up identity: %v", err)
+		return models.User{}, ssoErrorFailed
+	}
+
+	user, err = database.GetUserByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// Only link accounts that proved they own the address, or whoever
+		// registered it first could take over the provider's sign-ins
+		if user.EmailVerifiedAt == nil {
+			log.Printf("resolveSSOUser: Not linking unverified account, user ID %d", user.ID)
+			return models.User{}, ssoErrorAccountUnverified
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if !provider.AllowSignup() {
+			log.Printf("resolveSSOUser: No account for provider %s subject %s and sign-up is disabled", provider.ID, claims.Subject)
+			return models.User{}, ssoErrorNoAccount
+		}
+		user, err = createSSOUser(claims)
+		if err != nil {
+			log.Printf("resolveSSOUser: Failed to create user: %v", err)
+			return models.User{}, ssoErrorFailed
+		}
+		log.Printf("resolveSSOUser: Created user ID %d for provider %s", user.ID, provider.ID)
+	default:
+		log.Printf("resolveSSOUser: Failed to look up user by email: %v", err)
+		return models.User{}, ssoErrorFailed
+	}
+
+	err = database.CreateUserIdentity(models.UserIdentity{
+		UserID:    user.ID,
+		Provider:  provider.ID,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("resolveSSOUser: Failed to link user ID %d: %v", user.ID, err)
+		return models.User{}, ssoErrorFailed
+	}
+	return user, ""
+}
+
+// createSSOUser provisions an account for a provider identity. It gets an
+// unguessable random password; the user can set a real one with the
+// password reset flow.
+func createSSOUser(claims *oidc.Claims) (models.User, error) {
+	password, err := tokens.Generate(32)
+	if err != nil {
+		return models.User{}, err
+	}
+	username, err := availableUsername(claims)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := database.CreateUser(models.RegisterInput{
+		Username: username,
+		Email:    claims.Email,
+		Password: password,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	// The provider already verified the address
+	if err := database.MarkEmailVerified(user.ID); err != nil {
+		return models.User{}, err
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	return user, nil
+}
+
+// availableUsername derives an unused username from the preferred username
+// or the local part of the email address.
+func availableUsername(claims *oidc.Claims) (string, error) {
+	base := sanitizeUsername(claims.PreferredUsername)
+	if len(base) < 3 {
+		base = sanitizeUsername(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+	if len(base) > 28 {
+		base = base[:28]
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate += strconv.Itoa(i)
+		}
+		_, err := database.GetUserByUsername(candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New("no free username")
+}
+
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/models"
+	"todo-app/oidc"
+	"todo-app/oidc/oidctest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// setupOIDCTest starts a mock identity provider configured as provider
+// "mock" and returns it with a router serving the OIDC routes.
+func setupOIDCTest(t *testing.T, allowSignup bool) (*oidctest.Provider, *gin.Engine) {
+	t.Helper()
+	idp, err := oidctest.NewProvider("todo-app", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+	setupTest(t, func(c *config.Config) {
+		c.OIDC.Providers = []config.OIDCProvider{{
+			ID:           "mock",
+			Name:         "Mock",
+			Issuer:       idp.Issuer(),
+			ClientID:     "todo-app",
+			ClientSecret: "secret",
+			AllowSignup:  allowSignup,
+		}}
+	})
+	r := gin.New()
+	r.GET("/auth/oidc/:provider", OIDCLogin)
+	r.GET("/auth/oidc/:provider/callback", OIDCCallback)
+	return idp, r
+}
+
+// startSSO requests the login route and returns the provider's
+// authorization URL and the flow cookie.
+func startSSO(t *testing.T, r *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, want 302", w.Code)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcFlowCookie {
+			return w.Header().Get("Location"), cookie
+		}
+	}
+	t.Fatal("login set no flow cookie")
+	return "", nil
+}
+
+// ssoSignIn runs the whole sign-in as identity. modify, if not nil, can
+// tamper with the callback URL the provider redirects to.
+func ssoSignIn(t *testing.T, r *gin.Engine, idp *oidctest.Provider, identity oidctest.Identity, modify func(*url.URL)) *httptest.ResponseRecorder {
+	t.Helper()
+	authURL, flow := startSSO(t, r)
+	callback, err := idp.Authorize(authURL, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modify != nil {
+		modify(u)
+	}
+	req := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+	req.AddCookie(flow)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// assertSSOError checks for a redirect to the login page with the reason.
+func assertSSOError(t *testing.T, w *httptest.ResponseRecorder, reason string) {
+	t.Helper()
+	if want := "/login?sso_error=" + reason; w.Code != http.StatusFound || w.Header().Get("Location") != want {
+		t.Fatalf("status = %d, Location %q; want 302 to %s", w.Code, w.Header().Get("Location"), want)
+	}
+	assertNoSession(t, w)
+}
+
+func assertNoSession(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == accessCookieName && cookie.Value != "" {
+			t.Fatal("session cookie set")
+		}
+	}
+}
+
+// assertSignedIn checks that the callback signed in a user and returns it.
+func assertSignedIn(t *testing.T, w *httptest.ResponseRecorder, subject string) models.User {
+	t.Helper()
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Fatalf("status = %d, Location %q; want 302 to /login", w.Code, w.Header().Get("Location"))
+	}
+	signedIn := false
+	for _, cookie := range w.Result().Cookies() {
+		signedIn = signedIn || cookie.Name == accessCookieName && cookie.Value != ""
+	}
+	if !signedIn {
+		t.Fatal("no session cookie set")
+	}
+	user, err := database.GetUserByIdentity("mock", subject)
+	if err != nil {
+		t.Fatalf("identity %s not linked: %v", subject, err)
+	}
+	return user
+}
+
+func assertNotLinked(t *testing.T, subject string) {
+	t.Helper()
+	if _, err := database.GetUserByIdentity("mock", subject); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("identity %s: err = %v, want sql.ErrNoRows", subject, err)
+	}
+}
+
+var ssoIdentity = oidctest.Identity{Subject: "sub-1", Email: "sso@example.com", EmailVerified: true, Name: "SSO User"}
+
+func TestOIDCLoginSendsPKCEChallenge(t *testing.T) {
+	idp, r := setupOIDCTest(t, true)
+	authURL, cookie := startSSO(t, r)
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.Issuer()+"/authorize?") {
+		t.Fatalf("redirected to %s", authURL)
+	}
+	flow, err := keyRing.Parse(cookie.Value, oidcAudience())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	verifier, _ := flow["verifier"].(string)
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != oidc.Challenge(verifier) {
+		t.Errorf("code_challenge = %q (%s), want the S256 challenge of the flow's verifier",
+			q.Get("code_challenge"), q.Get("code_challenge_method"))
+	}
+	if q.Get("state") != flow["state"] || q.Get("nonce") != flow["nonce"] {
+		t.Error("state or nonce differs from the flow cookie")
+	}
+	if q.Get("redirect_uri") != "http://localhost:8080/auth/oidc/mock/callback" {
+		t.Errorf("redirect_uri = %s", q.Get("redirect_uri"))
+	}
+}
+
+func TestOIDCProvisionsAccount(t *testing.T) {
+	idp, r := setupOIDCTest(t, true)
+
+	user := assertSignedIn(t, ssoSignIn(t, r, idp, ssoIdentity, nil), "sub-1")
+	if user.Email != "sso@example.com" || user.EmailVerifiedAt == nil {
+		t.Errorf("created user %q, email %q verified at %v", user.Username, user.Email, user.EmailVerifiedAt)
+	}
+
+	// The next sign-in finds the same account through the identity
+	again := assertSignedIn(t, ssoSignIn(t, r, idp, ssoIdentity, nil), "sub-1")
+	if again.ID != user.ID {
+		t.Errorf("second sign-in: user ID %d, want %d", again.ID, user.ID)
+	}
+}
+
+func TestOIDCRequiresSignup(t *testing.T) {
+	idp, r := setupOIDCTest(t, false)
+
+	assertSSOError(t, ssoSignIn(t, r, idp, ssoIdentity, nil), ssoErrorNoAccount)
+	if _, err := database.GetUserByEmail(ssoIdentity.Email); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("account created without sign-up: %v", err)
+	}
+}
+
+func TestOIDCLinksVerifiedEmail(t *testing.T) {
+	idp, r := setupOIDCTest(t, false)
+	existing, err := database.CreateUser(models.RegisterInput{Username: "sso", Email: "sso@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.MarkEmailVerified(existing.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if user := assertSignedIn(t, ssoSignIn(t, r, idp, ssoIdentity, nil), "sub-1"); user.ID != existing.ID {
+		t.Errorf("linked user ID %d, want %d", user.ID, existing.ID)
+	}
+}
+
+func TestOIDCDoesNotLinkUnverifiedAccount(t *testing.T) {
+	idp, r := setupOIDCTest(t, true)
+	if _, err := database.CreateUser(models.RegisterInput{Username: "sso", Email: "sso@example.com", Password: "correct horse battery"}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertSSOError(t, ssoSignIn(t, r, idp, ssoIdentity, nil), ssoErrorAccountUnverified)
+	assertNotLinked(t, "sub-1")
+}
+
+func TestOIDCRequiresVerifiedProviderEmail(t *testing.T) {
+	idp, r := setupOIDCTest(t, true)
+	identity := ssoIdentity
+	identity.EmailVerified = false
+
+	assertSSOError(t, ssoSignIn(t, r, idp, identity, nil), ssoErrorEmailUnverified)
+	if _, err := database.GetUserByEmail(identity.Email); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("account created for an unverified email: %v", err)
+	}
+}
+
+func TestOIDCRejectsStateMismatch(t *testing.T) {
+	idp, r := setupOIDCTest(t, true)
+
+	w := ssoSignIn(t, r, idp, ssoIdentity, func(u *url.URL) {
+		q := u.Query()
+		q.Set("state", "forged")
+		u.RawQuery = q.Encode()
+	})
+	assertSSOError(t, w, ssoErrorExpired)
+	assertNotLinked(t, "sub-1")
+
+	// A callback without the flow cookie, as from a login started elsewhere
+	authURL, _ := startSSO(t, r)
+	callback, err := idp.Authorize(authURL, ssoIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(callback)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	assertSSOError(t, w, ssoErrorExpired)
+}
+
+func TestOIDCRejectsIDToken(t *testing.T) {
+	otherKey, err := oidctest.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		modify func(idp *oidctest.Provider)
+	}{
+		{"nonce mismatch", func(idp *oidctest.Provider) {
+			idp.ModifyIDToken = func(c jwt.MapClaims) { c["nonce"] = "forged" }
+		}},
+		{"wrong signature", func(idp *oidctest.Provider) { idp.SigningKey = otherKey }},
+		{"wrong audience", func(idp *oidctest.Provider) {
+			idp.ModifyIDToken = func(c jwt.MapClaims) { c["aud"] = "other-app" }
+		}},
+		{"wrong issuer", func(idp *oidctest.Provider) {
+			idp.ModifyIDToken = func(c jwt.MapClaims) { c["iss"] = "https://idp.example.com" }
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idp, r := setupOIDCTest(t, true)
+			tc.modify(idp)
+
+			assertSSOError(t, ssoSignIn(t, r, idp, ssoIdentity, nil), ssoErrorFailed)
+			assertNotLinked(t, "sub-1")
+		})
+	}
+}
+
+// The provider stands in for the password, not the second factor.
+func TestOIDCRequiresSecondFactor(t *testing.T) {
+	idp, r := setupOIDCTest(t, false)
+	user, err := database.CreateUser(models.RegisterInput{Username: "sso", Email: "sso@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.MarkEmailVerified(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	enableTestTwoFactor(t, user.ID)
+
+	w := ssoSignIn(t, r, idp, ssoIdentity, nil)
+	location := w.Header().Get("Location")
+	mfaToken, ok := strings.CutPrefix(location, "/login#mfa_token=")
+	if w.Code != http.StatusFound || !ok {
+		t.Fatalf("status = %d, Location %q; want 302 to the second factor prompt", w.Code, location)
+	}
+	assertNoSession(t, w)
+	mfaToken, err = url.QueryUnescape(mfaToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, _, err := parseMFAToken(mfaToken); err != nil || userID != user.ID {
+		t.Errorf("MFA token for user ID %d (%v), want %d", userID, err, user.ID)
+	}
+}
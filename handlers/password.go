@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"todo-app/authn"
+	"todo-app/database"
+	"todo-app/mail"
+	"todo-app/models"
+	"todo-app/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+const forgotPasswordMessage = "If an account exists for that email, a password reset link has been sent."
+
+// ForgotPassword emails a single-use password reset link. The response is
+// the same whether or not the email belongs to an account, and the email is
+// sent in the background so response times do not give it away either.
+// Accounts sent a link less than VerificationResendInterval ago are silently
+// skipped, and each client IP may only ask for a few links per window.
+func ForgotPassword(c *gin.Context) {
+	log.Printf("ForgotPassword: Processing request")
+
+	key := "password-reset:ip:" + c.ClientIP()
+	ok, retryAfter, err := loginLimits.resetByIP.Allow(key)
+	if err != nil {
+		// Fail open like the login limits
+		log.Printf("ForgotPassword: Rate limit store error for %s: %v", key, err)
+	} else if !ok {
+		log.Printf("ForgotPassword: Rate limit exceeded for %s, retry after %s", key, retryAfter)
+		respondTooManyAttempts(c, retryAfter, "Too many password reset requests. Please try again later.")
+		return
+	}
+	if _, _, err := loginLimits.resetByIP.Record(key); err != nil {
+		log.Printf("ForgotPassword: Rate limit store error for %s: %v", key, err)
+	}
+
+	var input models.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("ForgotPassword: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := database.GetUserByEmail(input.Email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("ForgotPassword: Database error: %v", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+
+	lastSent, err := database.LastUserTokenCreatedAt(user.ID, database.TokenPurposePasswordReset)
+	if err != nil {
+		log.Printf("ForgotPassword: Database error: %v", err)
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+	if time.Since(lastSent) < cfg.Auth.VerificationResendInterval.Std() {
+		log.Printf("ForgotPassword: Throttled reset link for user ID: %d", user.ID)
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+	// Directory users reset their password in the directory
+	directory, err := authn.IsDirectoryUser(user.ID)
+	if err != nil || directory {
+		if err != nil {
+			log.Printf("ForgotPassword: Failed to check identities of user ID %d: %v", user.ID, err)
+		} else {
+			log.Printf("ForgotPassword: No reset link for directory user ID: %d", user.ID)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+
+	if err := sendPasswordResetEmail(user, false); err != nil {
+		log.Printf("ForgotPassword: Failed to issue reset link for user ID %d: %v", user.ID, err)
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+	log.Printf("ForgotPassword: Reset link issued for user ID: %d", user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and
+// signs the account out of every session.
+func ResetPassword(c *gin.Context) {
+	log.Printf("ResetPassword: Processing request")
+
+	var input models.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("ResetPassword: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check the new password before using up the link, so the user can try
+	// another one
+	tokenHash := tokens.Hash(input.Token)
+	userID, err := database.PeekUserToken(database.TokenPurposePasswordReset, tokenHash)
+	if err != nil {
+		resetTokenError(c, err)
+		return
+	}
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		resetTokenError(c, err)
+		return
+	}
+	// Links sent before the account was linked to the directory stop working
+	if refuseDirectoryAccount(c, userID, "Failed to reset password") {
+		return
+	}
+	if !checkPasswordPolicy(c, input.Password, user.Username, user.Email) {
+		return
+	}
+	if _, err := database.ConsumeUserToken(database.TokenPurposePasswordReset, tokenHash); err != nil {
+		resetTokenError(c, err)
+		return
+	}
+
+	if err := database.UpdateUserPassword(userID, input.Password); err != nil {
+		log.Printf("ResetPassword: Failed to update password for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Older reset links and existing logins must not outlive the reset
+	if err := database.InvalidateUserTokens(userID, database.TokenPurposePasswordReset); err != nil {
+		log.Printf("ResetPassword: Failed to invalidate reset tokens for user ID %d: %v", userID, err)
+	}
+	if _, err := database.RevokeOtherSessions(userID, ""); err != nil {
+		log.Printf("ResetPassword: Failed to revoke sessions for user ID %d: %v", userID, err)
+	}
+	if _, err := database.DeleteUserAccessTokens(userID); err != nil {
+		log.Printf("ResetPassword: Failed to revoke access tokens for user ID %d: %v", userID, err)
+	}
+	// Proving control of the email address lifts a lockout
+	if err := database.ResetFailedLogins(userID); err != nil {
+		log.Printf("ResetPassword: Failed to clear lockout for user ID %d: %v", userID, err)
+	}
+	log.Printf("ResetPassword: Password reset for user ID: %d", userID)
+	recordAudit(c, models.AuditPasswordReset, userID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset. You can now log in."})
+}
+
+// resetTokenError answers a reset with a token that could not be used.
+func resetTokenError(c *gin.Context, err error) {
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("ResetPassword: Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	log.Printf("ResetPassword: Invalid, expired or used reset token")
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+}
+
+// sendPasswordResetEmail stores a single-use reset token for the user and
+// emails them the link. forced words the email for a reset an administrator
+// started, after which the old password no longer works.
+func sendPasswordResetEmail(user models.User, forced bool) error {
+	token, err := tokens.Generate(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(cfg.Auth.PasswordResetTTL.Std())
+	if err := database.CreateUserToken(user.ID, database.TokenPurposePasswordReset, tokens.Hash(token), expiresAt); err != nil {
+		return err
+	}
+
+	intro := "Someone asked to reset the password for your Todo List account.\n" +
+		"If it was you, open the link below to choose a new password:"
+	outro := "If you did not ask for this, you can ignore this email."
+	if forced {
+		intro = "An administrator has reset the password for your Todo List account.\n" +
+			"Your old password no longer works. Open the link below to choose a new one:"
+		outro = "If the link expires, use \"Forgot password\" on the login page to get a new one."
+	}
+	link := cfg.Server.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Todo List password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\n%s\n\n%s\n\nThe link can be used once and expires at %s.\n%s\n",
+			user.Username, intro, link, expiresAt.UTC().Format("2006-01-02 15:04 MST"), outro,
+		),
+	})
+	return nil
+}
+
+// sendMailAsync delivers msg in the background, logging any failure.
+func sendMailAsync(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mailer.Send(ctx, msg); err != nil {
+			log.Printf("sendMailAsync: Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
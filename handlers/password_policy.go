@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"todo-app/passwords"
+
+	"github.com/gin-gonic/gin"
+)
+
+var passwordPolicy *passwords.Policy
+
+// SetPasswordPolicy hands the handlers the policy new passwords must meet.
+// It must be called before the router starts serving requests.
+func SetPasswordPolicy(p *passwords.Policy) {
+	passwordPolicy = p
+}
+
+// GetPasswordPolicy returns the rules new passwords must meet, so forms can
+// show them up front.
+func GetPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, passwordPolicy.Requirements())
+}
+
+// checkPasswordPolicy answers 400 with the rules the password breaks and
+// returns false when it is not acceptable for the account. Clients show the
+// violations by their code.
+func checkPasswordPolicy(c *gin.Context, password, username, email string) bool {
+	violations := passwordPolicy.Check(password, username, email)
+	if len(violations) == 0 {
+		return true
+	}
+	codes := make([]string, len(violations))
+	for i, v := range violations {
+		codes[i] = v.Code
+	}
+	log.Printf("checkPasswordPolicy: Rejected password for %s: %v", username, codes)
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet the requirements",
+		"code":       "weak_password",
+		"violations": violations,
+	})
+	return false
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	netmail "net/mail"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/mail"
+	"todo-app/models"
+	"todo-app/passwords"
+	"todo-app/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chanMailer hands every message it is asked to send to a channel.
+type chanMailer chan mail.Message
+
+func (m chanMailer) Send(ctx context.Context, msg mail.Message) error {
+	m <- msg
+	return nil
+}
+
+func postForgotPassword(r *gin.Engine, ip, email string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"email": %q}`, email)
+	req := httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":40000"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestForgotPasswordThrottle(t *testing.T) {
+	setupTest(t, func(c *config.Config) {
+		c.RateLimit.PasswordResetIPAttempts = 3
+	})
+	sent := make(chanMailer, 10)
+	SetMailer(sent)
+	r := gin.New()
+	r.POST("/api/password/forgot", ForgotPassword)
+	if _, err := database.CreateUser(models.RegisterInput{Username: "dave", Email: "dave@example.com", Password: "correct horse battery"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := postForgotPassword(r, "192.0.2.1", "dave@example.com"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", w.Code)
+	}
+	select {
+	case msg := <-sent:
+		if msg.To != "dave@example.com" {
+			t.Errorf("sent to %q, want dave@example.com", msg.To)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reset email sent")
+	}
+
+	// A second request for the same account, even from elsewhere, gets the
+	// same answer but no email until the resend interval has passed
+	w := postForgotPassword(r, "192.0.2.2", "dave@example.com")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), forgotPasswordMessage) {
+		t.Fatalf("repeated request: status = %d, body %s", w.Code, w.Body)
+	}
+	select {
+	case msg := <-sent:
+		t.Fatalf("throttled request sent %q to %s", msg.Subject, msg.To)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Every request counts against the client IP, whatever the address
+	for i := 0; i < 2; i++ {
+		if w := postForgotPassword(r, "192.0.2.1", fmt.Sprintf("nobody%d@example.com", i)); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+2, w.Code)
+		}
+	}
+	w = postForgotPassword(r, "192.0.2.1", "dave@example.com")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: status = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+}
+
+// smtpDelivery is a message received by the test SMTP server.
+type smtpDelivery struct {
+	from, to string
+	data     string
+}
+
+// startSMTPServer listens on a local port and accepts mail for anyone,
+// handing each message to the returned channel. It speaks just enough SMTP
+// for net/smtp.SendMail without STARTTLS or AUTH.
+func startSMTPServer(t *testing.T) (string, int, <-chan smtpDelivery) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	deliveries := make(chan smtpDelivery, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, deliveries)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, deliveries
+}
+
+func serveSMTP(conn net.Conn, deliveries chan<- smtpDelivery) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost test SMTP")
+
+	var msg smtpDelivery
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			deliveries <- msg
+			msg = smtpDelivery{}
+			tp.PrintfLine("250 OK")
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+var resetLinkPattern = regexp.MustCompile(`https://todo\.example\.com/reset-password\?token=\S+`)
+
+func TestForgotPasswordSendsResetLinkBySMTP(t *testing.T) {
+	setupTest(t, func(c *config.Config) {
+		c.Server.BaseURL = "https://todo.example.com"
+	})
+	host, port, deliveries := startSMTPServer(t)
+	SetMailer(&mail.SMTPMailer{Host: host, Port: port, From: "Todo List <noreply@example.com>"})
+	r := gin.New()
+	r.POST("/api/password/forgot", ForgotPassword)
+	user, err := database.CreateUser(models.RegisterInput{Username: "frank", Email: "frank@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := postForgotPassword(r, "192.0.2.1", "frank@example.com"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var got smtpDelivery
+	select {
+	case got = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+	}
+	if got.from != "noreply@example.com" || got.to != "frank@example.com" {
+		t.Errorf("envelope from %q to %q, want noreply@example.com to frank@example.com", got.from, got.to)
+	}
+
+	msg, err := netmail.ReadMessage(bufio.NewReader(strings.NewReader(got.data)))
+	if err != nil {
+		t.Fatalf("parsing delivered message: %v", err)
+	}
+	if to := msg.Header.Get("To"); to != "frank@example.com" {
+		t.Errorf("To = %q, want frank@example.com", to)
+	}
+	if subject := msg.Header.Get("Subject"); subject != "Reset your Todo List password" {
+		t.Errorf("Subject = %q", subject)
+	}
+	body := new(strings.Builder)
+	if _, err := bufio.NewReader(msg.Body).WriteTo(body); err != nil {
+		t.Fatal(err)
+	}
+
+	link := resetLinkPattern.FindString(body.String())
+	if link == "" {
+		t.Fatalf("no reset link in body:\n%s", body)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := parsed.Query().Get("token")
+	if len(token) < 32 {
+		t.Fatalf("token %q is too short", token)
+	}
+
+	// The emailed token is the one stored, hashed, for the account
+	userID, err := database.PeekUserToken(database.TokenPurposePasswordReset, tokens.Hash(token))
+	if err != nil {
+		t.Fatalf("emailed token not found: %v", err)
+	}
+	if userID != user.ID {
+		t.Errorf("token belongs to user %d, want %d", userID, user.ID)
+	}
+	if strings.Contains(body.String(), tokens.Hash(token)) {
+		t.Error("body contains the token hash")
+	}
+}
+
+func TestDirectoryUsersCannotResetPassword(t *testing.T) {
+	setupTest(t, nil)
+	sent := make(chanMailer, 10)
+	SetMailer(sent)
+	user := createDirectoryUser(t, "jdoe")
+	r := gin.New()
+	r.POST("/api/password/forgot", ForgotPassword)
+	r.POST("/api/password/reset", ResetPassword)
+	r.POST("/api/admin/users/:id/password-reset", func(c *gin.Context) {
+		c.Set("user_id", int64(0))
+		AdminForcePasswordReset(c)
+	})
+
+	// No link is sent, but the answer is the same as for anyone else
+	w := postForgotPassword(r, "192.0.2.1", user.Email)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), forgotPasswordMessage) {
+		t.Fatalf("forgot password: status = %d, body %s", w.Code, w.Body)
+	}
+	select {
+	case msg := <-sent:
+		t.Fatalf("sent %q to directory user %s", msg.Subject, msg.To)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// A link from before the account was linked to the directory
+	token, err := tokens.Generate(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateUserToken(user.ID, database.TokenPurposePasswordReset, tokens.Hash(token), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`{"token": %q, "password": "staple battery horse"}`, token)
+	req := httptest.NewRequest(http.MethodPost, "/api/password/reset", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"directory_account"`) {
+		t.Fatalf("reset: status = %d, body %s; want 409 directory_account", w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/admin/users/%d/password-reset", user.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("admin reset: status = %d, body %s; want 409", w.Code, w.Body)
+	}
+
+	stored, err := database.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := passwords.Verify("staple battery horse", stored.Password); ok {
+		t.Error("directory user got the new local password")
+	}
+	if ok, _ := passwords.Verify("correct horse battery", stored.Password); !ok {
+		t.Error("local password hash was replaced")
+	}
+}
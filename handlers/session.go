@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetSessions(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	currentID := c.GetString("session_id")
+	log.Printf("GetSessions: Processing request for user ID: %d", userID)
+
+	sessions, err := database.GetActiveSessions(userID)
+	if err != nil {
+		log.Printf("GetSessions: Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		return
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+	for i := range sessions {
+		sessions[i].Device = describeUserAgent(sessions[i].UserAgent)
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	log.Printf("GetSessions: Returning %d sessions", len(sessions))
+	c.JSON(http.StatusOK, sessions)
+}
+
+func DeleteSession(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	sessionID := c.Param("id")
+	log.Printf("DeleteSession: Revoking session %s for user ID: %d", sessionID, userID)
+
+	revoked, err := database.RevokeUserSession(userID, sessionID)
+	if err != nil {
+		log.Printf("DeleteSession: Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	// Revoking the session in use is the same as logging out
+	if sessionID == c.GetString("session_id") {
+		clearAuthCookies(c)
+	}
+	recordAudit(c, models.AuditSessionRevoked, userID, gin.H{"session_id": sessionID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// DeleteOtherSessions signs the user out everywhere except the session
+// making the request.
+func DeleteOtherSessions(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("DeleteOtherSessions: Processing request for user ID: %d", userID)
+
+	count, err := database.RevokeOtherSessions(userID, c.GetString("session_id"))
+	if err != nil {
+		log.Printf("DeleteOtherSessions: Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	log.Printf("DeleteOtherSessions: Revoked %d sessions", count)
+	recordAudit(c, models.AuditSessionRevoked, userID, gin.H{"count": count, "reason": "other_sessions"})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Other sessions revoked successfully",
+		"revoked": count,
+	})
+}
+
+// describeUserAgent turns a User-Agent header into a short label such as
+// "Firefox on Linux". It only needs to be good enough for a person to
+// recognise their own devices.
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		browser = "curl"
+	}
+
+	os := ""
+	switch {
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		os = "iOS"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+
+	if os == "" {
+		return browser
+	}
+	return browser + " on " + os
+}
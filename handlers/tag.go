@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTags returns the user's tags with how many todos carry each.
+func GetTags(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("GetTags: Processing request for user ID: %d", userID)
+
+	tags, err := database.ListTags(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+func CreateTag(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("CreateTag: Processing request for user ID: %d", userID)
+
+	var input models.CreateTagInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("CreateTag: Invalid input format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tag name is required"})
+		return
+	}
+
+	tag, err := database.CreateTag(userID, input)
+	if !applyTagChange(c, err, "Failed to create tag") {
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTag renames or recolors a tag. The todos carrying it keep it.
+func UpdateTag(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	tagID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+	log.Printf("UpdateTag: Processing request for tag ID %d of user ID: %d", tagID, userID)
+
+	var input models.UpdateTagInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("UpdateTag: Invalid input format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+
+	tag, err := database.UpdateTag(userID, tagID, input)
+	if !applyTagChange(c, err, "Failed to update tag") {
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag deletes a tag and takes it off every todo; the todos stay.
+func DeleteTag(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	tagID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+	log.Printf("DeleteTag: Processing request for tag ID %d of user ID: %d", tagID, userID)
+
+	if !applyTagChange(c, database.DeleteTag(userID, tagID), "Failed to delete tag") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted"})
+}
+
+// applyTagChange writes the error response for a failed change to a tag
+// and reports whether it succeeded.
+func applyTagChange(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	case errors.Is(err, database.ErrTagExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "A tag with that name already exists"})
+	default:
+		log.Printf("applyTagChange: %s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -17,7 +19,14 @@ func GetTodos(c *gin.Context) {
 	userID := c.GetInt64("user_id")
 	log.Printf("GetTodos: User ID: %d", userID)
 
-	todos, err := database.GetTodos(userID)
+	var query models.TodoQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Printf("GetTodos: Invalid query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	todos, err := database.GetTodos(userID, query)
 	if err != nil {
 		log.Printf("GetTodos: Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -33,6 +42,30 @@ func GetTodos(c *gin.Context) {
 	c.JSON(http.StatusOK, todos)
 }
 
+// GetTodo returns a todo with its subtasks nested under it.
+func GetTodo(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Printf("GetTodo: Invalid ID format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	log.Printf("GetTodo: Processing request for todo ID %d of user ID: %d", id, userID)
+
+	todo, err := database.GetTodoTree(userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get todo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, todo)
+}
+
 func CreateTodo(c *gin.Context) {
 	log.Printf("CreateTodo: Processing request")
 	userID := c.GetInt64("user_id")
@@ -56,9 +89,7 @@ func CreateTodo(c *gin.Context) {
 	log.Printf("CreateTodo: Input received: %+v", input)
 
 	todo, err := database.CreateTodo(userID, input)
-	if err != nil {
-		log.Printf("CreateTodo: Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !applyTodoChange(c, err, "Failed to create todo") {
 		return
 	}
 	log.Printf("CreateTodo: Todo created successfully: %+v", todo)
@@ -87,9 +118,7 @@ func UpdateTodo(c *gin.Context) {
 	}
 	log.Printf("UpdateTodo: Input received: %+v", input)
 
-	if err := database.UpdateTodo(userID, id, input); err != nil {
-		log.Printf("UpdateTodo: Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !applyTodoChange(c, database.UpdateTodo(userID, id, input), "Failed to update todo") {
 		return
 	}
 	log.Printf("UpdateTodo: Todo updated successfully")
@@ -125,9 +154,7 @@ func ToggleTodo(c *gin.Context) {
 		Completed:   !todo.Completed,
 	}
 
-	if err := database.UpdateTodo(userID, id, updateInput); err != nil {
-		log.Printf("ToggleTodo: Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !applyTodoChange(c, database.UpdateTodo(userID, id, updateInput), "Failed to toggle todo") {
 		return
 	}
 	log.Printf("ToggleTodo: Todo status toggled successfully")
@@ -143,6 +170,55 @@ func ToggleTodo(c *gin.Context) {
 	c.JSON(http.StatusOK, updatedTodo)
 }
 
+// MoveTodo changes the manual position of a todo, placing it next to the
+// todos named in the body. Other todos keep their positions.
+func MoveTodo(c *gin.Context) {
+	log.Printf("MoveTodo: Processing request")
+	userID := c.GetInt64("user_id")
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Printf("MoveTodo: Invalid ID format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var input models.MoveTodoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("MoveTodo: Invalid input format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.AfterID == 0 && input.BeforeID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after_id or before_id is required"})
+		return
+	}
+	log.Printf("MoveTodo: Moving todo %d of user %d: %+v", id, userID, input)
+
+	err = database.MoveTodo(userID, id, input.AfterID, input.BeforeID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	case errors.Is(err, database.ErrInvalidMove):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after_id and before_id must be other todos of yours, in that order"})
+		return
+	case err != nil:
+		log.Printf("MoveTodo: Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move todo"})
+		return
+	}
+
+	todo, err := database.GetTodoByID(userID, id)
+	if err != nil {
+		log.Printf("MoveTodo: Error getting moved todo: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get moved todo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, todo)
+}
+
 func DeleteTodo(c *gin.Context) {
 	log.Printf("DeleteTodo: Processing request")
 	userID := c.GetInt64("user_id")
@@ -165,3 +241,30 @@ func DeleteTodo(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Todo deleted successfully"})
 }
+
+// applyTodoChange writes the error response for a failed change to a todo
+// and reports whether it succeeded.
+func applyTodoChange(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+	case errors.Is(err, database.ErrListNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "List not found"})
+	case errors.Is(err, database.ErrParentNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent todo not found"})
+	case errors.Is(err, database.ErrSubtaskCycle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A todo cannot be a subtask of itself or of its own subtasks"})
+	case errors.Is(err, database.ErrSubtaskDepth):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subtasks cannot be nested that deep"})
+	case errors.Is(err, database.ErrSubtaskList):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subtasks stay on the list of their parent"})
+	case errors.Is(err, database.ErrOpenSubtasks):
+		c.JSON(http.StatusConflict, gin.H{"error": "Complete the subtasks first"})
+	default:
+		log.Printf("applyTodoChange: %s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"todo-app/database"
+)
+
+// sealedTOTPPrefix marks a TOTP secret encrypted by sealTOTPSecret. Secrets
+// stored before encryption was introduced are plain base32, which never
+// contains a colon.
+const sealedTOTPPrefix = "sealed:"
+
+// sealTOTPSecret encrypts a TOTP secret with AES-GCM under a key derived
+// from the JWT secret, so a copy of the database or a backup alone does not
+// reveal it. The ciphertext is bound to the user and cannot be moved to
+// another account.
+func sealTOTPSecret(userID int64, secret string) (string, error) {
+	gcm, err := newTOTPCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), totpAdditionalData(userID))
+	return sealedTOTPPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openTOTPSecret(userID int64, data string) (string, error) {
+	encoded, ok := strings.CutPrefix(data, sealedTOTPPrefix)
+	if !ok {
+		return "", errors.New("TOTP secret is not sealed")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newTOTPCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("sealed TOTP secret too short")
+	}
+	secret, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], totpAdditionalData(userID))
+	if err != nil {
+		return "", errors.New("cannot decrypt TOTP secret, was the JWT secret changed?")
+	}
+	return string(secret), nil
+}
+
+func newTOTPCipher() (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte("totp|" + cfg.Auth.JWTSecret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func totpAdditionalData(userID int64) []byte {
+	return []byte("user|" + strconv.FormatInt(userID, 10))
+}
+
+// SealTOTPSecrets encrypts the TOTP secrets still stored in plain text and
+// returns how many it sealed. It must be called after Init.
+func SealTOTPSecrets() (int, error) {
+	secrets, err := database.GetTOTPSecrets()
+	if err != nil {
+		return 0, err
+	}
+	sealed := 0
+	for userID, secret := range secrets {
+		if strings.HasPrefix(secret, sealedTOTPPrefix) {
+			continue
+		}
+		replacement, err := sealTOTPSecret(userID, secret)
+		if err != nil {
+			return sealed, err
+		}
+		replaced, err := database.ReplaceTOTPSecret(userID, secret, replacement)
+		if err != nil {
+			return sealed, err
+		}
+		if replaced {
+			sealed++
+		}
+	}
+	if sealed > 0 {
+		log.Printf("SealTOTPSecrets: Encrypted %d plain text TOTP secrets", sealed)
+	}
+	return sealed, nil
+}
@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"todo-app/database"
+	"todo-app/models"
+	"todo-app/tokens"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	totpPeriod = 30
+	// totpSkew accepts codes from one step either side of now to allow for
+	// clock drift between the server and the phone.
+	totpSkew = 1
+
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 16
+
+	// maxMFAAttempts bounds how many codes can be guessed with a single
+	// pending login before the password has to be entered again.
+	maxMFAAttempts = 5
+
+	mfaTokenPurpose = "mfa"
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// GetTwoFactorStatus reports whether two-factor authentication is enabled and
+// how many recovery codes are left.
+func GetTwoFactorStatus(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("GetTwoFactorStatus: Failed to get user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+		return
+	}
+	remaining, err := database.CountRecoveryCodes(userID)
+	if err != nil {
+		log.Printf("GetTwoFactorStatus: Failed to count recovery codes for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TwoFactorEnabledAt != nil,
+		"enabled_at":               user.TwoFactorEnabledAt,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor generates a new TOTP secret for the user. It is not used for
+// logins until EnableTwoFactor confirms the user can produce codes for it.
+func SetupTwoFactor(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("SetupTwoFactor: Processing request for user ID: %d", userID)
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("SetupTwoFactor: Failed to get user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		return
+	}
+	if user.TwoFactorEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      cfg.Auth.TOTPIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		log.Printf("SetupTwoFactor: Failed to generate TOTP key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+
+	img, err := key.Image(200, 200)
+	if err != nil {
+		log.Printf("SetupTwoFactor: Failed to render QR code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+	var qr bytes.Buffer
+	if err := png.Encode(&qr, img); err != nil {
+		log.Printf("SetupTwoFactor: Failed to encode QR code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+
+	sealed, err := sealTOTPSecret(userID, key.Secret())
+	if err != nil {
+		log.Printf("SetupTwoFactor: Failed to encrypt TOTP secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+	if err := database.SetPendingTOTPSecret(userID, sealed); err != nil {
+		log.Printf("SetupTwoFactor: Failed to store TOTP secret for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+	log.Printf("SetupTwoFactor: Generated pending TOTP secret for user ID: %d", userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      key.Secret(),
+		"otpauth_url": key.URL(),
+		"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr.Bytes()),
+	})
+}
+
+// EnableTwoFactor turns on two-factor authentication once the user proves
+// their authenticator app produces valid codes, and returns a fresh set of
+// recovery codes. The codes are only ever shown in this response.
+func EnableTwoFactor(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("EnableTwoFactor: Processing request for user ID: %d", userID)
+
+	var input models.TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("EnableTwoFactor: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("EnableTwoFactor: Failed to get user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		return
+	}
+	if user.TwoFactorEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	ok, err := checkTOTPCode(userID, input.Code)
+	if err != nil {
+		log.Printf("EnableTwoFactor: Failed to check code for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if !ok {
+		log.Printf("EnableTwoFactor: Invalid code for user ID %d", userID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Printf("EnableTwoFactor: Failed to generate recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if err := database.EnableTwoFactor(userID, hashes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor setup has not been started"})
+			return
+		}
+		log.Printf("EnableTwoFactor: Failed to enable two-factor for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	log.Printf("EnableTwoFactor: Two-factor authentication enabled for user ID: %d", userID)
+	recordAudit(c, models.AuditTwoFactorEnabled, userID, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off. It asks for both the
+// password and a current code (or recovery code) so a hijacked session alone
+// cannot weaken the account.
+func DisableTwoFactor(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("DisableTwoFactor: Processing request for user ID: %d", userID)
+
+	var input models.DisableTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("DisableTwoFactor: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("DisableTwoFactor: Failed to get user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		return
+	}
+	if user.TwoFactorEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !checkLoginAllowed(c, user.Username, &user) || checkAccountLocked(c, user) {
+		return
+	}
+	confirmed, err := confirmPassword(c.Request.Context(), user, input.Password)
+	if err != nil {
+		log.Printf("DisableTwoFactor: Failed to check password for user ID %d: %v", userID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication service unavailable"})
+		return
+	}
+	if !confirmed {
+		log.Printf("DisableTwoFactor: Invalid password for user ID %d", userID)
+		recordLoginFailure(c, user.Username, &user)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	ok, err := checkSecondFactor(userID, input.Code)
+	if err != nil {
+		log.Printf("DisableTwoFactor: Failed to check code for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	if !ok {
+		log.Printf("DisableTwoFactor: Invalid code for user ID %d", userID)
+		recordLoginFailure(c, user.Username, &user)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	if err := database.DisableTwoFactor(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	log.Printf("DisableTwoFactor: Two-factor authentication disabled for user ID: %d", userID)
+	recordAudit(c, models.AuditTwoFactorDisabled, userID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not, with a new
+// set after checking a current TOTP code.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	log.Printf("RegenerateRecoveryCodes: Processing request for user ID: %d", userID)
+
+	var input models.TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("RegenerateRecoveryCodes: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("RegenerateRecoveryCodes: Failed to get user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		return
+	}
+	if user.TwoFactorEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	ok, err := checkTOTPCode(userID, input.Code)
+	if err != nil {
+		log.Printf("RegenerateRecoveryCodes: Failed to check code for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Printf("RegenerateRecoveryCodes: Failed to generate recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	if err := database.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	recordAudit(c, models.AuditRecoveryCodesChanged, userID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// LoginTwoFactor finishes a login that Login left waiting for a second
+// factor, exchanging the pending MFA token and a valid code for a session.
+func LoginTwoFactor(c *gin.Context) {
+	log.Printf("LoginTwoFactor: Processing request")
+
+	var input models.TwoFactorLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("LoginTwoFactor: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, jti, err := parseMFAToken(input.MFAToken)
+	if err != nil {
+		log.Printf("LoginTwoFactor: Invalid MFA token: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+	if !mfaAttempts.allow(jti) {
+		log.Printf("LoginTwoFactor: Too many attempts for pending login of user ID %d", userID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many attempts, please sign in again"})
+		return
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("LoginTwoFactor: User not found for ID %d: %v", userID, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+	if !checkLoginAllowed(c, user.Username, &user) || checkAccountLocked(c, user) {
+		return
+	}
+
+	ok, err := checkSecondFactor(userID, input.Code)
+	if err != nil {
+		log.Printf("LoginTwoFactor: Failed to check code for user ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		log.Printf("LoginTwoFactor: Invalid code for user ID %d", userID)
+		recordLoginFailure(c, user.Username, &user)
+		recordAudit(c, models.AuditLoginFailed, userID, gin.H{"reason": "invalid_second_factor"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+	mfaAttempts.done(jti)
+	if checkAccountDisabled(c, user) {
+		return
+	}
+	log.Printf("LoginTwoFactor: Second factor verified for user ID: %d", userID)
+
+	completeLogin(c, user)
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+func checkSecondFactor(userID int64, code string) (bool, error) {
+	ok, err := checkTOTPCode(userID, code)
+	if err != nil || ok {
+		return ok, err
+	}
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != recoveryCodeLength {
+		return false, nil
+	}
+	used, err := database.ConsumeRecoveryCode(userID, tokens.Hash(normalized))
+	if used {
+		log.Printf("checkSecondFactor: Recovery code used for user ID %d", userID)
+	}
+	return used, err
+}
+
+// checkTOTPCode validates a code against the user's secret. Each time step
+// can only be used once, so a code seen over the user's shoulder cannot be
+// replayed.
+func checkTOTPCode(userID int64, code string) (bool, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpOpts.Digits.Length() {
+		return false, nil
+	}
+
+	sealed, lastStep, err := database.GetTOTPSecret(userID)
+	if err != nil || sealed == "" {
+		return false, err
+	}
+	secret, err := openTOTPSecret(userID, sealed)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		t := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		step := t.Unix() / totpPeriod
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(secret, t, totpOpts)
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return database.RecordTOTPStep(userID, step)
+		}
+	}
+	return false, nil
+}
+
+// generateRecoveryCodes returns codes formatted for display together with the
+// hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeCount; i++ {
+		var b strings.Builder
+		for j := 0; j < recoveryCodeLength; j++ {
+			n, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+		raw := b.String()
+		codes = append(codes, raw[:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:])
+		hashes = append(hashes, tokens.Hash(raw))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// generateMFAToken issues the short-lived token that stands for "password
+// verified, second factor outstanding". It carries no session ID, so
+// AuthMiddleware never accepts it as an access token.
+func generateMFAToken(userID int64) (string, error) {
+	jti, err := tokens.Generate(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": mfaTokenPurpose,
+		"jti":     jti,
+		"aud":     mfaAudience(),
+		"iat":     now.Unix(),
+		"nbf":     now.Unix(),
+		"exp":     now.Add(cfg.Auth.MFATokenTTL.Std()).Unix(),
+	}
+	return keyRing.Sign(claims)
+}
+
+func parseMFAToken(tokenString string) (int64, string, error) {
+	claims, err := keyRing.Parse(tokenString, mfaAudience())
+	if err != nil {
+		return 0, "", err
+	}
+	purpose, _ := claims["purpose"].(string)
+	rawUserID, _ := claims["user_id"].(float64)
+	jti, _ := claims["jti"].(string)
+	if purpose != mfaTokenPurpose || rawUserID == 0 || jti == "" {
+		return 0, "", errors.New("not an MFA token")
+	}
+	return int64(rawUserID), jti, nil
+}
+
+// mfaAudience keeps pending-login tokens apart from access tokens.
+func mfaAudience() string {
+	return cfg.Auth.Audience + ":mfa"
+}
+
+// mfaAttemptCounter counts code attempts per pending login. Entries are
+// dropped once the token they belong to can no longer be used.
+type mfaAttemptCounter struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	expires  map[string]time.Time
+}
+
+var mfaAttempts = &mfaAttemptCounter{
+	attempts: make(map[string]int),
+	expires:  make(map[string]time.Time),
+}
+
+func (m *mfaAttemptCounter) allow(jti string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range m.expires {
+		if now.After(exp) {
+			delete(m.attempts, id)
+			delete(m.expires, id)
+		}
+	}
+
+	if m.attempts[jti] >= maxMFAAttempts {
+		return false
+	}
+	m.attempts[jti]++
+	if _, ok := m.expires[jti]; !ok {
+		m.expires[jti] = now.Add(cfg.Auth.MFATokenTTL.Std())
+	}
+	return true
+}
+
+// done retires a pending login once it has been completed so its token
+// cannot start a second session.
+func (m *mfaAttemptCounter) done(jti string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts[jti] = maxMFAAttempts
+}
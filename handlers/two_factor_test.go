@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// enableTestTwoFactor turns on two-factor authentication for the user with
+// testTOTPSecret.
+func enableTestTwoFactor(t *testing.T, userID int64) {
+	t.Helper()
+	sealed, err := sealTOTPSecret(userID, testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetPendingTOTPSecret(userID, sealed); err != nil {
+		t.Fatal(err)
+	}
+	_, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.EnableTwoFactor(userID, hashes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func currentTOTPCode(t *testing.T) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(testTOTPSecret, time.Now(), totpOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func postDisableTwoFactor(r *gin.Engine, password, code string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"password": %q, "code": %q}`, password, code)
+	req := httptest.NewRequest(http.MethodPost, "/api/2fa/disable", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Wrong passwords and codes when disabling two-factor authentication count
+// as failed logins, so a stolen session cannot be used to guess either.
+func TestDisableTwoFactorLimitsGuesses(t *testing.T) {
+	setupTest(t, func(c *config.Config) {
+		c.RateLimit.LoginAccountAttempts = 3
+		c.RateLimit.LockoutThreshold = 100
+	})
+	user, err := database.CreateUser(models.RegisterInput{Username: "mallory", Email: "mallory@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enableTestTwoFactor(t, user.ID)
+	r := gin.New()
+	r.POST("/api/2fa/disable", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		DisableTwoFactor(c)
+	})
+
+	for i := range 2 {
+		if w := postDisableTwoFactor(r, fmt.Sprintf("guess %d", i), "123456"); w.Code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: status = %d, want 400", i+1, w.Code)
+		}
+	}
+	if w := postDisableTwoFactor(r, "correct horse battery", "not a code"); w.Code != http.StatusBadRequest {
+		t.Fatalf("wrong code: status = %d, want 400", w.Code)
+	}
+	assertTooManyAttempts(t, postDisableTwoFactor(r, "correct horse battery", currentTOTPCode(t)))
+
+	stored, err := database.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.TwoFactorEnabledAt == nil {
+		t.Error("two-factor authentication was disabled")
+	}
+}
+
+func TestSetupTwoFactorSealsSecret(t *testing.T) {
+	setupTest(t, nil)
+	user, err := database.CreateUser(models.RegisterInput{Username: "niaj", Email: "niaj@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/api/2fa/setup", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		SetupTwoFactor(c)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/2fa/setup", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", w.Code, w.Body)
+	}
+	var body struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Secret == "" {
+		t.Fatalf("no secret in %s: %v", w.Body, err)
+	}
+
+	stored, _, err := database.GetTOTPSecret(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, sealedTOTPPrefix) || strings.Contains(stored, body.Secret) {
+		t.Fatalf("stored secret %q is not sealed", stored)
+	}
+	code, err := totp.GenerateCodeCustom(body.Secret, time.Now(), totpOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := checkTOTPCode(user.ID, code); err != nil || !ok {
+		t.Errorf("code for the new secret: %v, %v", ok, err)
+	}
+}
+
+func TestSealedTOTPSecretIsBound(t *testing.T) {
+	setupTest(t, nil)
+	sealed, err := sealTOTPSecret(1, testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := openTOTPSecret(1, sealed); err != nil || secret != testTOTPSecret {
+		t.Fatalf("openTOTPSecret = %q, %v", secret, err)
+	}
+	if _, err := openTOTPSecret(2, sealed); err == nil {
+		t.Error("secret opened for another user")
+	}
+	if _, err := openTOTPSecret(1, testTOTPSecret); err == nil {
+		t.Error("plain text secret accepted")
+	}
+	cfg.Auth.JWTSecret = "another secret"
+	if _, err := openTOTPSecret(1, sealed); err == nil {
+		t.Error("secret opened with another JWT secret")
+	}
+}
+
+// Secrets stored in plain text before encryption was added are sealed at
+// startup and keep working.
+func TestSealTOTPSecrets(t *testing.T) {
+	setupTest(t, nil)
+	var userIDs []int64
+	for _, name := range []string{"olivia", "peggy"} {
+		user, err := database.CreateUser(models.RegisterInput{Username: name, Email: name + "@example.com", Password: "correct horse battery"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userIDs = append(userIDs, user.ID)
+	}
+	if err := database.SetPendingTOTPSecret(userIDs[0], testTOTPSecret); err != nil {
+		t.Fatal(err)
+	}
+	enableTestTwoFactor(t, userIDs[1])
+
+	if sealed, err := SealTOTPSecrets(); err != nil || sealed != 1 {
+		t.Fatalf("SealTOTPSecrets = %d, %v; want 1", sealed, err)
+	}
+	for _, userID := range userIDs {
+		stored, _, err := database.GetTOTPSecret(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret, err := openTOTPSecret(userID, stored); err != nil || secret != testTOTPSecret {
+			t.Errorf("user ID %d: secret %q, %v", userID, secret, err)
+		}
+	}
+	if ok, err := checkTOTPCode(userIDs[0], currentTOTPCode(t)); err != nil || !ok {
+		t.Errorf("code for the sealed secret: %v, %v", ok, err)
+	}
+	if sealed, err := SealTOTPSecrets(); err != nil || sealed != 0 {
+		t.Errorf("second SealTOTPSecrets = %d, %v; want 0", sealed, err)
+	}
+}
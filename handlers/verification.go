@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/mail"
+	"todo-app/models"
+	"todo-app/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+const resendVerificationMessage = "If an unverified account exists for that email, a new verification link has been sent."
+
+// VerifyEmail confirms the address a verification link was sent to. Browsers
+// following the link from the email are redirected to the login page; API
+// clients get JSON.
+func VerifyEmail(c *gin.Context) {
+	log.Printf("VerifyEmail: Processing request")
+	wantsHTML := c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+
+	token := c.Query("token")
+	if token == "" {
+		respondVerification(c, wantsHTML, false)
+		return
+	}
+
+	userID, err := database.ConsumeUserToken(database.TokenPurposeEmailVerification, tokens.Hash(token))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("VerifyEmail: Database error: %v", err)
+		}
+		respondVerification(c, wantsHTML, false)
+		return
+	}
+
+	if err := database.MarkEmailVerified(userID); err != nil {
+		log.Printf("VerifyEmail: Failed to mark user ID %d verified: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	if err := database.InvalidateUserTokens(userID, database.TokenPurposeEmailVerification); err != nil {
+		log.Printf("VerifyEmail: Failed to invalidate verification tokens for user ID %d: %v", userID, err)
+	}
+	log.Printf("VerifyEmail: Email verified for user ID: %d", userID)
+
+	respondVerification(c, wantsHTML, true)
+}
+
+func respondVerification(c *gin.Context, wantsHTML, verified bool) {
+	switch {
+	case wantsHTML && verified:
+		c.Redirect(http.StatusFound, "/login?verified=1")
+	case wantsHTML:
+		c.Redirect(http.StatusFound, "/login?verified=0")
+	case verified:
+		c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+	}
+}
+
+// ResendVerification sends a fresh verification link. Like ForgotPassword it
+// answers the same way for every address, and it silently skips accounts
+// that were sent a link less than VerificationResendInterval ago.
+func ResendVerification(c *gin.Context) {
+	log.Printf("ResendVerification: Processing request")
+
+	var input models.ResendVerificationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Printf("ResendVerification: Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := database.GetUserByEmail(input.Email)
+	if err != nil || user.EmailVerifiedAt != nil || cfg.Auth.EmailVerification == config.EmailVerificationOff {
+		c.JSON(http.StatusOK, gin.H{"message": resendVerificationMessage})
+		return
+	}
+
+	lastSent, err := database.LastUserTokenCreatedAt(user.ID, database.TokenPurposeEmailVerification)
+	if err != nil {
+		log.Printf("ResendVerification: Database error: %v", err)
+		c.JSON(http.StatusOK, gin.H{"message": resendVerificationMessage})
+		return
+	}
+	if time.Since(lastSent) < cfg.Auth.VerificationResendInterval.Std() {
+		log.Printf("ResendVerification: Throttled resend for user ID: %d", user.ID)
+		c.JSON(http.StatusOK, gin.H{"message": resendVerificationMessage})
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("ResendVerification: Failed to send verification email to user ID %d: %v", user.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": resendVerificationMessage})
+}
+
+// sendVerificationEmail issues a verification token for the user and emails
+// the link in the background.
+func sendVerificationEmail(user models.User) error {
+	token, err := tokens.Generate(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(cfg.Auth.EmailVerificationTTL.Std())
+	if err := database.CreateUserToken(user.ID, database.TokenPurposeEmailVerification, tokens.Hash(token), expiresAt); err != nil {
+		return err
+	}
+
+	link := cfg.Server.BaseURL + "/api/verify-email?token=" + url.QueryEscape(token)
+	sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your Todo List email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+				"The link expires at %s.\n"+
+				"If you did not create a Todo List account, you can ignore this email.\n",
+			user.Username, link, expiresAt.UTC().Format("2006-01-02 15:04 MST"),
+		),
+	})
+	log.Printf("sendVerificationEmail: Verification link issued for user ID: %d", user.ID)
+	return nil
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"todo-app/keyring"
+)
+
+// StartKeyRotation checks every interval whether the signing key is due for
+// rotation, until ctx is done.
+func StartKeyRotation(ctx context.Context, ring *keyring.Ring, interval time.Duration) {
+	log.Printf("KeyRotation: Starting, checking every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("KeyRotation: Stopping")
+				return
+			case <-ticker.C:
+				if err := ring.RotateIfDue(); err != nil {
+					log.Printf("KeyRotation: Failed to rotate signing key: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"todo-app/database"
+)
+
+// StartAccountPurger hard-deletes accounts whose deletion grace period has
+// run out, once at startup and then every interval until ctx is done.
+func StartAccountPurger(ctx context.Context, interval time.Duration) {
+	log.Printf("AccountPurger: Starting, checking every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purgeAccounts()
+			select {
+			case <-ctx.Done():
+				log.Printf("AccountPurger: Stopping")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func purgeAccounts() {
+	purged, err := database.PurgeDeletedUsers()
+	if err != nil {
+		log.Printf("AccountPurger: Failed to purge deleted accounts: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("AccountPurger: Purged %d deleted accounts", purged)
+	}
+}
+
+// StartAuditPurger deletes security log entries older than retention, once
+// at startup and then every interval until ctx is done.
+func StartAuditPurger(ctx context.Context, interval, retention time.Duration) {
+	log.Printf("AuditPurger: Starting, keeping events for %s", retention)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purgeAuditEvents(retention)
+			select {
+			case <-ctx.Done():
+				log.Printf("AuditPurger: Stopping")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func purgeAuditEvents(retention time.Duration) {
+	purged, err := database.PurgeAuditEvents(time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("AuditPurger: Failed to purge audit events: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("AuditPurger: Purged %d audit events", purged)
+	}
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"todo-app/database"
+	"todo-app/notify"
+)
+
+// reminderBatchSize bounds how many reminders are loaded at once.
+const reminderBatchSize = 100
+
+// StartReminderScheduler sends the reminders that have come due through
+// notifier, once at startup and then every interval until ctx is done.
+func StartReminderScheduler(ctx context.Context, interval time.Duration, notifier notify.Notifier) {
+	log.Printf("ReminderScheduler: Starting, checking every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sendReminders(ctx, notifier)
+			select {
+			case <-ctx.Done():
+				log.Printf("ReminderScheduler: Stopping")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func sendReminders(ctx context.Context, notifier notify.Notifier) {
+	for {
+		now := time.Now()
+		reminders, err := database.DueReminders(now, reminderBatchSize)
+		if err != nil {
+			log.Printf("ReminderScheduler: Failed to load due reminders: %v", err)
+			return
+		}
+		for _, r := range reminders {
+			// Mark before sending: a reminder that fails to send is not
+			// retried every interval for ever
+			claimed, err := database.MarkReminded(r.Todo.ID, now)
+			if err != nil {
+				log.Printf("ReminderScheduler: Failed to mark todo %d reminded: %v", r.Todo.ID, err)
+				return
+			}
+			if !claimed {
+				continue
+			}
+			sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := notifier.Notify(sendCtx, r); err != nil {
+				log.Printf("ReminderScheduler: Failed to send reminder for todo %d to %s: %v", r.Todo.ID, r.Username, err)
+			}
+			cancel()
+		}
+		if len(reminders) < reminderBatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
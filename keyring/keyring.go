@@ -0,0 +1,206 @@
+// Package keyring manages the keys access tokens are signed with. Several
+// keys can be valid at once: the current one signs, and keys it replaced
+// keep verifying tokens for a grace period. Every token names its key in
+// the kid header.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// leeway absorbs small clock differences when checking exp, nbf and iat.
+const leeway = 30 * time.Second
+
+type Ring struct {
+	mu      sync.RWMutex
+	keys    []*Key
+	current *Key
+
+	secret           string
+	algorithm        string
+	issuer           string
+	rotationInterval time.Duration
+	gracePeriod      time.Duration
+}
+
+// New loads the stored keys and makes sure there is a current key for the
+// configured algorithm, generating one if needed.
+func New(cfg config.AuthConfig) (*Ring, error) {
+	r := &Ring{
+		secret:           cfg.JWTSecret,
+		algorithm:        cfg.SigningAlgorithm,
+		issuer:           cfg.Issuer,
+		rotationInterval: cfg.KeyRotationInterval.Std(),
+		gracePeriod:      cfg.KeyGracePeriod.Std(),
+	}
+
+	records, err := database.GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		key, err := loadKey(r.secret, record)
+		if err != nil {
+			// Tokens signed with this key will simply fail to verify
+			log.Printf("Keyring: Skipping key %s: %v", record.ID, err)
+			continue
+		}
+		r.keys = append(r.keys, key)
+		if key.RetiredAt == nil {
+			r.current = key
+		}
+	}
+	log.Printf("Keyring: Loaded %d signing keys", len(r.keys))
+
+	if err := r.RotateIfDue(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RotateIfDue replaces the current key when it is older than the rotation
+// interval or no longer uses the configured algorithm.
+func (r *Ring) RotateIfDue() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case r.current == nil:
+		log.Printf("Keyring: No current signing key")
+	case r.current.Algorithm != r.algorithm:
+		log.Printf("Keyring: Signing algorithm changed from %s to %s", r.current.Algorithm, r.algorithm)
+	case r.rotationInterval > 0 && time.Since(r.current.CreatedAt) >= r.rotationInterval:
+		log.Printf("Keyring: Signing key %s is due for rotation", r.current.ID)
+	default:
+		r.pruneExpired()
+		return nil
+	}
+	return r.rotate()
+}
+
+// Rotate replaces the current key right away, e.g. after a suspected leak.
+func (r *Ring) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate()
+}
+
+func (r *Ring) rotate() error {
+	key, record, err := generateKey(r.secret, r.algorithm)
+	if err != nil {
+		return fmt.Errorf("keyring: generating %s key: %w", r.algorithm, err)
+	}
+	if err := database.CreateSigningKey(record); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(r.gracePeriod)
+	for _, old := range r.keys {
+		if old.RetiredAt != nil {
+			continue
+		}
+		if err := database.RetireSigningKey(old.ID, now, expiresAt); err != nil {
+			return err
+		}
+		old.RetiredAt, old.ExpiresAt = &now, &expiresAt
+	}
+
+	r.keys = append(r.keys, key)
+	r.current = key
+	log.Printf("Keyring: Now signing with %s key %s", key.Algorithm, key.ID)
+
+	r.pruneExpired()
+	return nil
+}
+
+// pruneExpired drops keys whose grace period is over.
+func (r *Ring) pruneExpired() {
+	now := time.Now()
+	kept := r.keys[:0]
+	for _, key := range r.keys {
+		if key.ExpiresAt == nil || key.ExpiresAt.After(now) {
+			kept = append(kept, key)
+		}
+	}
+	if len(kept) == len(r.keys) {
+		return
+	}
+	r.keys = kept
+	if deleted, err := database.DeleteExpiredSigningKeys(); err != nil {
+		log.Printf("Keyring: Failed to delete expired keys: %v", err)
+	} else if deleted > 0 {
+		log.Printf("Keyring: Deleted %d expired signing keys", deleted)
+	}
+}
+
+// Sign signs the claims with the current key, adding the issuer claim.
+func (r *Ring) Sign(claims jwt.MapClaims) (string, error) {
+	r.mu.RLock()
+	key := r.current
+	r.mu.RUnlock()
+	if key == nil {
+		return "", errors.New("keyring: no signing key")
+	}
+
+	claims["iss"] = r.issuer
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signingKey)
+}
+
+// Parse verifies a token signed by one of the ring's keys and checks its
+// exp, nbf, iat, iss and aud claims.
+func (r *Ring) Parse(tokenString, audience string) (jwt.MapClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{config.AlgorithmHS256, config.AlgorithmRS256, config.AlgorithmEdDSA}),
+		jwt.WithIssuer(r.issuer),
+		jwt.WithAudience(audience),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := r.lookup(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// A key only verifies tokens of its own algorithm, so an RS256
+		// public key can never be abused as an HS256 secret
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("token algorithm %s does not match key %s (%s)", token.Method.Alg(), key.ID, key.Algorithm)
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	return claims, nil
+}
+
+func (r *Ring) lookup(kid string) *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range r.keys {
+		if key.ID == kid && (key.ExpiresAt == nil || key.ExpiresAt.After(now)) {
+			return key
+		}
+	}
+	return nil
+}
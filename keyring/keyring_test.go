@@ -0,0 +1,290 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://todo.example.com"
+	testAudience = "todo-app"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testAuthConfig returns the auth settings rings in these tests use.
+func testAuthConfig(algorithm string) config.AuthConfig {
+	auth := config.Default().Auth
+	auth.JWTSecret = "keyring test secret"
+	auth.SigningAlgorithm = algorithm
+	auth.Issuer = testIssuer
+	return auth
+}
+
+// setupRing opens a fresh database and returns a ring using the given
+// algorithm.
+func setupRing(t *testing.T, algorithm string) *Ring {
+	t.Helper()
+	if err := database.InitDB(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "todo.db")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	r, err := New(testAuthConfig(algorithm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub": "1",
+		"aud": testAudience,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+// signWith signs claims as they are, naming kid in the header.
+func signWith(t *testing.T, method jwt.SigningMethod, signingKey any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRotationGracePeriod(t *testing.T) {
+	for _, algorithm := range []string{config.AlgorithmHS256, config.AlgorithmRS256, config.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			r := setupRing(t, algorithm)
+			old := r.current
+			oldToken, err := r.Sign(validClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := r.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+			if r.current == old {
+				t.Fatal("Rotate kept the current key")
+			}
+			if old.RetiredAt == nil || old.ExpiresAt == nil {
+				t.Fatal("old key not retired")
+			}
+			newToken, err := r.Sign(validClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+				if _, err := r.Parse(token, testAudience); err != nil {
+					t.Errorf("%s key inside the grace period: %v", name, err)
+				}
+			}
+
+			// A restarted server still knows the retired key
+			reloaded, err := New(testAuthConfig(algorithm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := reloaded.Parse(oldToken, testAudience); err != nil {
+				t.Errorf("old key after reload: %v", err)
+			}
+
+			past := time.Now().Add(-time.Second)
+			old.ExpiresAt = &past
+			if _, err := r.Parse(oldToken, testAudience); err == nil {
+				t.Error("old key accepted after the grace period")
+			}
+			if _, err := r.Parse(newToken, testAudience); err != nil {
+				t.Errorf("new key: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRejectsUnknownKeyID(t *testing.T) {
+	r := setupRing(t, config.AlgorithmHS256)
+	claims := validClaims()
+	claims["iss"] = testIssuer
+
+	for _, kid := range []string{"", "unknown"} {
+		token := signWith(t, r.current.method, r.current.signingKey, kid, claims)
+		if _, err := r.Parse(token, testAudience); err == nil {
+			t.Errorf("kid %q accepted", kid)
+		}
+	}
+}
+
+func TestParseRejectsAlgorithmMismatch(t *testing.T) {
+	r := setupRing(t, config.AlgorithmRS256)
+	rsaKey := r.current
+	claims := validClaims()
+	claims["iss"] = testIssuer
+
+	// The classic confusion attack: HS256 with the published public key as
+	// the HMAC secret
+	der, err := x509.MarshalPKIXPublicKey(rsaKey.verifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	for name, secret := range map[string][]byte{"DER": der, "PEM": publicPEM} {
+		token := signWith(t, jwt.SigningMethodHS256, secret, rsaKey.ID, claims)
+		if _, err := r.Parse(token, testAudience); err == nil {
+			t.Errorf("HS256 signed with the %s public key accepted", name)
+		}
+	}
+
+	// An EdDSA token naming the RSA key
+	_, edPrivate, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Parse(signWith(t, jwt.SigningMethodEdDSA, edPrivate, rsaKey.ID, claims), testAudience); err == nil {
+		t.Error("EdDSA token for an RS256 key accepted")
+	}
+
+	// Unsigned tokens
+	unsigned := signWith(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, rsaKey.ID, claims)
+	if _, err := r.Parse(unsigned, testAudience); err == nil {
+		t.Error("alg none accepted")
+	}
+}
+
+func TestParseRejectsClaims(t *testing.T) {
+	r := setupRing(t, config.AlgorithmEdDSA)
+	future := time.Now().Add(10 * time.Minute).Unix()
+
+	for _, tc := range []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"no issuer", func(c jwt.MapClaims) { delete(c, "iss") }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "todo-app-mfa" }},
+		{"no audience", func(c jwt.MapClaims) { delete(c, "aud") }},
+		{"not yet valid", func(c jwt.MapClaims) { c["nbf"] = future }},
+		{"issued in the future", func(c jwt.MapClaims) { c["iat"] = future }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := validClaims()
+			claims["iss"] = testIssuer
+			tc.modify(claims)
+			token := signWith(t, r.current.method, r.current.signingKey, r.current.ID, claims)
+			if _, err := r.Parse(token, testAudience); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+
+	// Small clock differences are tolerated
+	claims := validClaims()
+	claims["iss"] = testIssuer
+	claims["nbf"] = time.Now().Add(leeway / 2).Unix()
+	claims["iat"] = time.Now().Add(leeway / 2).Unix()
+	token := signWith(t, r.current.method, r.current.signingKey, r.current.ID, claims)
+	if _, err := r.Parse(token, testAudience); err != nil {
+		t.Errorf("token within the leeway: %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	r := setupRing(t, config.AlgorithmHS256)
+	hsKey := r.current
+
+	// Switching algorithms retires the previous key into its grace period
+	r.algorithm = config.AlgorithmRS256
+	if err := r.RotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	rsToken, err := r.Sign(validClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.algorithm = config.AlgorithmEdDSA
+	if err := r.RotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	edToken, err := r.Sign(validClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := r.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2: %+v", len(set.Keys), set.Keys)
+	}
+	published := map[string]JWK{}
+	for _, jwk := range set.Keys {
+		if jwk.KeyID == hsKey.ID {
+			t.Fatal("JWKS publishes the HS256 key")
+		}
+		if jwk.Use != "sig" {
+			t.Errorf("key %s: use = %q, want sig", jwk.KeyID, jwk.Use)
+		}
+		published[jwk.Algorithm] = jwk
+	}
+
+	// Tokens verify against the published keys alone
+	rsJWK := published[config.AlgorithmRS256]
+	if rsJWK.KeyType != "RSA" {
+		t.Errorf("RS256 key type = %q, want RSA", rsJWK.KeyType)
+	}
+	n, e := decodeJWKField(t, rsJWK.N), decodeJWKField(t, rsJWK.E)
+	rsPublic := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	verifyWithPublicKey(t, rsToken, rsJWK.KeyID, rsPublic)
+
+	edJWK := published[config.AlgorithmEdDSA]
+	if edJWK.KeyType != "OKP" || edJWK.Curve != "Ed25519" {
+		t.Errorf("EdDSA key type = %q, curve %q; want OKP Ed25519", edJWK.KeyType, edJWK.Curve)
+	}
+	verifyWithPublicKey(t, edToken, edJWK.KeyID, ed25519.PublicKey(decodeJWKField(t, edJWK.X)))
+}
+
+func decodeJWKField(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func verifyWithPublicKey(t *testing.T, tokenString, kid string, public any) {
+	t.Helper()
+	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != kid {
+			t.Errorf("token kid = %v, want %s", token.Header["kid"], kid)
+		}
+		return public, nil
+	}, jwt.WithValidMethods([]string{config.AlgorithmRS256, config.AlgorithmEdDSA}))
+	if err != nil {
+		t.Errorf("token does not verify with published key %s: %v", kid, err)
+	}
+}
@@ -0,0 +1,174 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"todo-app/config"
+	"todo-app/models"
+	"todo-app/tokens"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const rsaKeyBits = 2048
+
+// Key is a signing key ready for use.
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	RetiredAt *time.Time
+	ExpiresAt *time.Time
+
+	method     jwt.SigningMethod
+	signingKey any
+	verifyKey  any
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case config.AlgorithmHS256:
+		return jwt.SigningMethodHS256, nil
+	case config.AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case config.AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("keyring: unsupported algorithm %q", algorithm)
+}
+
+// generateKey creates a new key of the given algorithm and the record to
+// store for it.
+func generateKey(secret, algorithm string) (*Key, models.SigningKey, error) {
+	kid, err := tokens.Generate(12)
+	if err != nil {
+		return nil, models.SigningKey{}, err
+	}
+	record := models.SigningKey{
+		ID:        kid,
+		Algorithm: algorithm,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	switch algorithm {
+	case config.AlgorithmRS256:
+		private, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, models.SigningKey{}, err
+		}
+		if record.KeyData, err = sealPrivateKey(secret, kid, private); err != nil {
+			return nil, models.SigningKey{}, err
+		}
+	case config.AlgorithmEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, models.SigningKey{}, err
+		}
+		if record.KeyData, err = sealPrivateKey(secret, kid, private); err != nil {
+			return nil, models.SigningKey{}, err
+		}
+	}
+
+	key, err := loadKey(secret, record)
+	return key, record, err
+}
+
+// loadKey turns a stored record back into a usable key.
+func loadKey(secret string, record models.SigningKey) (*Key, error) {
+	method, err := signingMethod(record.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{
+		ID:        record.ID,
+		Algorithm: record.Algorithm,
+		CreatedAt: record.CreatedAt,
+		RetiredAt: record.RetiredAt,
+		ExpiresAt: record.ExpiresAt,
+		method:    method,
+	}
+
+	if record.Algorithm == config.AlgorithmHS256 {
+		// HS256 keys are never stored; each is derived from the master
+		// secret and its ID.
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("hs256|" + record.ID))
+		key.signingKey = mac.Sum(nil)
+		key.verifyKey = key.signingKey
+		return key, nil
+	}
+
+	private, err := openPrivateKey(secret, record.ID, record.KeyData)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: key %s: %w", record.ID, err)
+	}
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		key.signingKey, key.verifyKey = private, &private.PublicKey
+	case ed25519.PrivateKey:
+		key.signingKey, key.verifyKey = private, private.Public()
+	default:
+		return nil, fmt.Errorf("keyring: key %s: unexpected key type %T", record.ID, private)
+	}
+	return key, nil
+}
+
+// sealPrivateKey encrypts a private key with AES-GCM under a key derived
+// from the master secret, so a copy of the database alone cannot forge
+// tokens.
+func sealPrivateKey(secret, kid string, private any) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, der, []byte(kid))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openPrivateKey(secret, kid, data string) (any, error) {
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("key data too short")
+	}
+	der, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(kid))
+	if err != nil {
+		return nil, errors.New("cannot decrypt key, was the JWT secret changed?")
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+func newCipher(secret string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte("keyring|" + secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,229 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxPacketSize bounds how much a single message may make us allocate.
+const maxPacketSize = 1 << 20
+
+// BER identifier octets used by LDAP (RFC 4511). Only low tag numbers occur,
+// so every identifier fits in one octet.
+const (
+	TagBoolean     byte = 0x01
+	TagInteger     byte = 0x02
+	TagOctetString byte = 0x04
+	TagEnumerated  byte = 0x0a
+	TagSequence    byte = 0x30
+	TagSet         byte = 0x31
+
+	TagBindRequest           byte = 0x60
+	TagBindResponse          byte = 0x61
+	TagUnbindRequest         byte = 0x42
+	TagSearchRequest         byte = 0x63
+	TagSearchResultEntry     byte = 0x64
+	TagSearchResultDone      byte = 0x65
+	TagSearchResultReference byte = 0x73
+	TagExtendedRequest       byte = 0x77
+	TagExtendedResponse      byte = 0x78
+
+	// Context-specific tags inside the operations above
+	TagSimpleAuth    byte = 0x80
+	TagFilterAnd     byte = 0xa0
+	TagFilterOr      byte = 0xa1
+	TagFilterNot     byte = 0xa2
+	TagFilterEqual   byte = 0xa3
+	TagFilterPresent byte = 0x87
+	TagExtendedName  byte = 0x80
+)
+
+const constructedBit = 0x20
+
+// Packet is a BER element. Constructed elements have Children, primitive
+// ones a Value.
+type Packet struct {
+	Tag      byte
+	Value    []byte
+	Children []*Packet
+}
+
+func (p *Packet) constructed() bool {
+	return p.Tag&constructedBit != 0
+}
+
+func NewSequence(tag byte, children ...*Packet) *Packet {
+	return &Packet{Tag: tag, Children: children}
+}
+
+func NewString(tag byte, s string) *Packet {
+	return &Packet{Tag: tag, Value: []byte(s)}
+}
+
+func NewInt(tag byte, n int64) *Packet {
+	// Minimal two's complement, big-endian
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		if (n == 0 && b[0]&0x80 == 0) || (n == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return &Packet{Tag: tag, Value: b}
+}
+
+func NewBool(tag byte, v bool) *Packet {
+	if v {
+		return &Packet{Tag: tag, Value: []byte{0xff}}
+	}
+	return &Packet{Tag: tag, Value: []byte{0x00}}
+}
+
+// Int decodes an INTEGER or ENUMERATED value.
+func (p *Packet) Int() (int64, error) {
+	if len(p.Value) == 0 || len(p.Value) > 8 {
+		return 0, errors.New("ldap: invalid integer")
+	}
+	n := int64(int8(p.Value[0]))
+	for _, b := range p.Value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+func (p *Packet) Bool() bool {
+	return len(p.Value) > 0 && p.Value[0] != 0
+}
+
+func (p *Packet) String() string {
+	return string(p.Value)
+}
+
+// Child returns the i-th child, or an empty packet if there is none, so
+// decoding code can index into malformed messages without panicking.
+func (p *Packet) Child(i int) *Packet {
+	if i < 0 || i >= len(p.Children) {
+		return &Packet{}
+	}
+	return p.Children[i]
+}
+
+// Bytes encodes the packet.
+func (p *Packet) Bytes() []byte {
+	content := p.Value
+	if p.constructed() {
+		content = nil
+		for _, child := range p.Children {
+			content = append(content, child.Bytes()...)
+		}
+	}
+	out := []byte{p.Tag}
+	out = append(out, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// ReadPacket reads one element from r.
+func ReadPacket(r *bufio.Reader) (*Packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, errors.New("ldap: multi-octet tags are not supported")
+	}
+	length, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parsePacket(tag, content)
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if first < 0x80 {
+		return int(first), nil
+	}
+	count := int(first & 0x7f)
+	if count == 0 || count > 4 {
+		return 0, errors.New("ldap: unsupported length encoding")
+	}
+	n := 0
+	for i := 0; i < count; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<8 | int(b)
+	}
+	if n > maxPacketSize {
+		return 0, fmt.Errorf("ldap: message of %d bytes is too large", n)
+	}
+	return n, nil
+}
+
+func parsePacket(tag byte, content []byte) (*Packet, error) {
+	p := &Packet{Tag: tag}
+	if !p.constructed() {
+		p.Value = content
+		return p, nil
+	}
+	for len(content) > 0 {
+		if len(content) < 2 {
+			return nil, errors.New("ldap: truncated element")
+		}
+		childTag := content[0]
+		length, header, err := parseLength(content[1:])
+		if err != nil {
+			return nil, err
+		}
+		start := 1 + header
+		if length > len(content)-start {
+			return nil, errors.New("ldap: truncated element")
+		}
+		child, err := parsePacket(childTag, content[start:start+length])
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, child)
+		content = content[start+length:]
+	}
+	return p, nil
+}
+
+// parseLength decodes a length from b and returns it with the number of
+// octets it took.
+func parseLength(b []byte) (int, int, error) {
+	if b[0] < 0x80 {
+		return int(b[0]), 1, nil
+	}
+	count := int(b[0] & 0x7f)
+	if count == 0 || count > 4 || len(b) < 1+count {
+		return 0, 0, errors.New("ldap: unsupported length encoding")
+	}
+	n := 0
+	for _, octet := range b[1 : 1+count] {
+		n = n<<8 | int(octet)
+	}
+	return n, 1 + count, nil
+}
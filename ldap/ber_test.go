@@ -0,0 +1,210 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func readBytes(b []byte) (*Packet, error) {
+	return ReadPacket(bufio.NewReader(bytes.NewReader(b)))
+}
+
+// equalPackets compares packets by tag, value and children.
+func equalPackets(a, b *Packet) bool {
+	if a.Tag != b.Tag || !bytes.Equal(a.Value, b.Value) || len(a.Children) != len(b.Children) {
+		return false
+	}
+	for i := range a.Children {
+		if !equalPackets(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewInt(t *testing.T) {
+	for _, tc := range []struct {
+		n    int64
+		want string
+	}{
+		{0, "00"},
+		{1, "01"},
+		{127, "7f"},
+		{128, "0080"},
+		{256, "0100"},
+		{-1, "ff"},
+		{-128, "80"},
+		{-129, "ff7f"},
+		{1<<63 - 1, "7fffffffffffffff"},
+		{-1 << 63, "8000000000000000"},
+	} {
+		p := NewInt(TagInteger, tc.n)
+		if got := hex.EncodeToString(p.Value); got != tc.want {
+			t.Errorf("NewInt(%d) = %s, want %s", tc.n, got, tc.want)
+		}
+		if n, err := p.Int(); err != nil || n != tc.n {
+			t.Errorf("Int() of %s = %d, %v, want %d", tc.want, n, err, tc.n)
+		}
+	}
+}
+
+func TestIntInvalid(t *testing.T) {
+	for _, value := range [][]byte{nil, make([]byte, 9)} {
+		if _, err := (&Packet{Tag: TagInteger, Value: value}).Int(); err == nil {
+			t.Errorf("Int() of %d bytes succeeded", len(value))
+		}
+	}
+}
+
+func TestEncodeLength(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{0, "00"},
+		{127, "7f"},
+		{128, "8180"},
+		{255, "81ff"},
+		{256, "820100"},
+		{70000, "83011170"},
+	} {
+		if got := hex.EncodeToString(encodeLength(tc.n)); got != tc.want {
+			t.Errorf("encodeLength(%d) = %s, want %s", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	// A bind request as RFC 4511 lays it out
+	bind := NewSequence(TagSequence,
+		NewInt(TagInteger, 1),
+		NewSequence(TagBindRequest,
+			NewInt(TagInteger, 3),
+			NewString(TagOctetString, "cn=a"),
+			NewString(TagSimpleAuth, "pw"),
+		),
+	)
+	want := "3012" + "020101" + "600d" + "020103" + "0404636e3d61" + "80027077"
+	if got := hex.EncodeToString(bind.Bytes()); got != want {
+		t.Errorf("Bytes() = %s, want %s", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	packet := NewSequence(TagSequence,
+		NewInt(TagInteger, 42),
+		NewSequence(TagSearchResultEntry,
+			NewString(TagOctetString, "uid=jdoe,ou=people,dc=example,dc=com"),
+			NewSequence(TagSequence,
+				NewSequence(TagSequence,
+					NewString(TagOctetString, "description"),
+					NewSequence(TagSet, NewString(TagOctetString, long), NewString(TagOctetString, "")),
+				),
+			),
+		),
+		NewBool(TagBoolean, true),
+		NewInt(TagEnumerated, -5),
+		NewSequence(TagFilterAnd),
+	)
+
+	got, err := readBytes(packet.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalPackets(got, packet) {
+		t.Fatalf("decoded packet differs:\n got %x\nwant %x", got.Bytes(), packet.Bytes())
+	}
+	if s := got.Child(1).Child(1).Child(0).Child(1).Child(0).String(); s != long {
+		t.Errorf("long value has %d bytes, want %d", len(s), len(long))
+	}
+	if !got.Child(2).Bool() {
+		t.Error("Bool() = false, want true")
+	}
+	if n, _ := got.Child(3).Int(); n != -5 {
+		t.Errorf("Int() = %d, want -5", n)
+	}
+}
+
+func TestReadPacketAcceptsNonMinimalLength(t *testing.T) {
+	// Lengths may use more octets than needed
+	p, err := readBytes([]byte{TagOctetString, 0x82, 0x00, 0x02, 'h', 'i'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "hi" {
+		t.Errorf("value = %q, want hi", p.String())
+	}
+}
+
+func TestReadPacketRejectsMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"tag only", "04"},
+		{"multi-octet tag", "1f0100"},
+		{"indefinite length", "3080"},
+		{"five length octets", "04850000000001"},
+		{"missing length octets", "048201"},
+		{"truncated content", "04056869"},
+		{"oversized length", "0484" + "00200001"},
+		{"largest length", "0484ffffffff"},
+		{"truncated child", "300304056869"},
+		{"child longer than parent", "30040405686969"},
+		{"child without length", "300104"},
+		{"child with bad length", "30020480"},
+		{"child with missing length octets", "3003048201"},
+		{"bad grandchild", "3004300204ff"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			input, err := hex.DecodeString(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p, err := readBytes(input); err == nil {
+				t.Errorf("decoded %x as %+v, want an error", input, p)
+			}
+		})
+	}
+}
+
+func TestChildOutOfRange(t *testing.T) {
+	p := NewSequence(TagSequence, NewInt(TagInteger, 1))
+	for _, i := range []int{-1, 1, 5} {
+		if c := p.Child(i); c == nil || c.Tag != 0 || c.Value != nil {
+			t.Errorf("Child(%d) = %+v, want an empty packet", i, c)
+		}
+	}
+	// Decoding code chains Child calls on malformed input
+	if s := p.Child(3).Child(0).String(); s != "" {
+		t.Errorf("String() = %q, want empty", s)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(NewSequence(TagSequence, NewInt(TagInteger, 1), NewString(TagOctetString, "x")).Bytes())
+	f.Add(NewString(TagOctetString, strings.Repeat("y", 200)).Bytes())
+	f.Add([]byte{TagSequence, 0x84, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{TagSequence, 0x03, TagOctetString, 0x05, 'h'})
+	f.Add([]byte{TagSequence, 0x02, TagOctetString, 0x80})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := readBytes(data)
+		if err != nil {
+			return
+		}
+		// Whatever decodes must encode to something that decodes the same
+		again, err := readBytes(p.Bytes())
+		if err != nil {
+			t.Fatalf("re-decoding %x: %v", p.Bytes(), err)
+		}
+		if !equalPackets(p, again) {
+			t.Fatalf("round trip changed %x into %x", p.Bytes(), again.Bytes())
+		}
+	})
+}
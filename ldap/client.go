@@ -0,0 +1,306 @@
+// Package ldap is a minimal LDAPv3 client (RFC 4511) covering what password
+// authentication against a directory needs: simple bind, StartTLS and
+// search.
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP result codes the client acts on.
+const (
+	ResultSuccess            = 0
+	ResultSizeLimitExceeded  = 4
+	ResultInvalidCredentials = 49
+	ResultUnwillingToPerform = 53
+)
+
+const (
+	protocolVersion = 3
+	startTLSOID     = "1.3.6.1.4.1.1466.20037"
+
+	searchScopeWholeSubtree = 2
+	searchDerefAliasesNever = 0
+	searchTimeLimitSeconds  = 10
+
+	defaultPort    = "389"
+	defaultTLSPort = "636"
+)
+
+// ResultError is a non-success result returned by the server.
+type ResultError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.Code)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// IsInvalidCredentials reports whether err is a failed bind.
+func IsInvalidCredentials(err error) bool {
+	var resultErr *ResultError
+	return errors.As(err, &resultErr) && resultErr.Code == ResultInvalidCredentials
+}
+
+type Conn struct {
+	host    string
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	lastID  int64
+}
+
+// Dial connects to an ldap:// or ldaps:// URL. Every operation on the
+// connection, including the TLS handshake, must finish within timeout.
+func Dial(ctx context.Context, rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+	host := u.Host
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), defaultPort)
+		}
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), defaultTLSPort)
+		}
+	default:
+		return nil, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{host: u.Hostname(), conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+	if u.Scheme == "ldaps" {
+		if err := c.upgradeTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// StartTLS switches the connection to TLS before any credentials are sent.
+func (c *Conn) StartTLS(tlsConfig *tls.Config) error {
+	op := NewSequence(TagExtendedRequest, NewString(TagExtendedName, startTLSOID))
+	response, err := c.roundTrip(op, TagExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if err := resultError(response); err != nil {
+		return err
+	}
+	return c.upgradeTLS(tlsConfig)
+}
+
+func (c *Conn) upgradeTLS(tlsConfig *tls.Config) error {
+	cfg := &tls.Config{}
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = c.host
+	}
+	tlsConn := tls.Client(c.conn, cfg)
+	tlsConn.SetDeadline(time.Now().Add(c.timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("ldap: TLS handshake: %w", err)
+	}
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Bind authenticates the connection with a simple bind. An empty password
+// is refused: servers treat it as an unauthenticated bind that succeeds for
+// any DN.
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return &ResultError{Code: ResultUnwillingToPerform, Message: "empty password"}
+	}
+	op := NewSequence(TagBindRequest,
+		NewInt(TagInteger, protocolVersion),
+		NewString(TagOctetString, dn),
+		NewString(TagSimpleAuth, password),
+	)
+	response, err := c.roundTrip(op, TagBindResponse)
+	if err != nil {
+		return err
+	}
+	return resultError(response)
+}
+
+// Entry is a search result.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the first value of an attribute, matching its name without
+// regard to case as LDAP does.
+func (e Entry) Get(name string) string {
+	for attr, values := range e.Attributes {
+		if strings.EqualFold(attr, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// Search runs a subtree search below baseDN and returns at most sizeLimit
+// entries; zero means no limit. Hitting the limit is not an error.
+func (c *Conn) Search(baseDN string, filter *Packet, attributes []string, sizeLimit int) ([]Entry, error) {
+	attrs := NewSequence(TagSequence)
+	for _, attr := range attributes {
+		attrs.Children = append(attrs.Children, NewString(TagOctetString, attr))
+	}
+	op := NewSequence(TagSearchRequest,
+		NewString(TagOctetString, baseDN),
+		NewInt(TagEnumerated, searchScopeWholeSubtree),
+		NewInt(TagEnumerated, searchDerefAliasesNever),
+		NewInt(TagInteger, int64(sizeLimit)),
+		NewInt(TagInteger, searchTimeLimitSeconds),
+		NewBool(TagBoolean, false),
+		filter,
+		attrs,
+	)
+
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		response, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch response.Tag {
+		case TagSearchResultEntry:
+			entries = append(entries, parseEntry(response))
+		case TagSearchResultReference:
+			// Referrals to other servers are not followed
+		case TagSearchResultDone:
+			err := resultError(response)
+			var resultErr *ResultError
+			if errors.As(err, &resultErr) && resultErr.Code == ResultSizeLimitExceeded {
+				err = nil
+			}
+			return entries, err
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response tag 0x%02x", response.Tag)
+		}
+	}
+}
+
+func parseEntry(p *Packet) Entry {
+	entry := Entry{DN: p.Child(0).String(), Attributes: make(map[string][]string)}
+	for _, attr := range p.Child(1).Children {
+		name := attr.Child(0).String()
+		for _, value := range attr.Child(1).Children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.String())
+		}
+	}
+	return entry
+}
+
+// Close sends an unbind request and closes the connection.
+func (c *Conn) Close() error {
+	c.send(&Packet{Tag: TagUnbindRequest})
+	return c.conn.Close()
+}
+
+func (c *Conn) roundTrip(op *Packet, responseTag byte) (*Packet, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.receive(id)
+	if err != nil {
+		return nil, err
+	}
+	if response.Tag != responseTag {
+		return nil, fmt.Errorf("ldap: unexpected response tag 0x%02x", response.Tag)
+	}
+	return response, nil
+}
+
+func (c *Conn) send(op *Packet) (int64, error) {
+	c.lastID++
+	message := NewSequence(TagSequence, NewInt(TagInteger, c.lastID), op)
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(message.Bytes()); err != nil {
+		return 0, err
+	}
+	return c.lastID, nil
+}
+
+// receive returns the protocol operation of the next response to message
+// id, skipping unsolicited notifications.
+func (c *Conn) receive(id int64) (*Packet, error) {
+	for {
+		message, err := ReadPacket(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		if message.Tag != TagSequence || len(message.Children) < 2 {
+			return nil, errors.New("ldap: malformed message")
+		}
+		messageID, err := message.Children[0].Int()
+		if err != nil {
+			return nil, err
+		}
+		if messageID == id {
+			return message.Children[1], nil
+		}
+		if messageID == 0 {
+			return nil, errors.New("ldap: server sent a notice of disconnection")
+		}
+	}
+}
+
+// resultError decodes the LDAPResult at the start of a response.
+func resultError(response *Packet) error {
+	code, err := response.Child(0).Int()
+	if err != nil {
+		return err
+	}
+	if code == ResultSuccess {
+		return nil
+	}
+	return &ResultError{Code: int(code), Message: response.Child(2).String()}
+}
+
+// Equal returns an equality filter, (attr=value). The value is sent as is,
+// so unlike a filter string it needs no escaping.
+func Equal(attr, value string) *Packet {
+	return NewSequence(TagFilterEqual, NewString(TagOctetString, attr), NewString(TagOctetString, value))
+}
+
+// And combines filters, (&...).
+func And(filters ...*Packet) *Packet {
+	return NewSequence(TagFilterAnd, filters...)
+}
+
+// Or matches any of the filters, (|...).
+func Or(filters ...*Packet) *Packet {
+	return NewSequence(TagFilterOr, filters...)
+}
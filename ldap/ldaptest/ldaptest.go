@@ -0,0 +1,241 @@
+// Package ldaptest is a tiny in-memory LDAP server for tests and local
+// development. It supports simple bind and search, without TLS, so it must
+// never be exposed to a network.
+package ldaptest
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"todo-app/ldap"
+)
+
+// LDAP result codes
+const (
+	resultSuccess            = 0
+	resultOperationsError    = 1
+	resultProtocolError      = 2
+	resultSizeLimitExceeded  = 4
+	resultInvalidCredentials = 49
+	resultInsufficientAccess = 50
+	resultUnwillingToPerform = 53
+)
+
+// PeopleDN is where user entries live, as uid=<uid>,ou=people,dc=example,dc=com.
+const PeopleDN = "ou=people,dc=example,dc=com"
+
+// User is a person entry in the directory.
+type User struct {
+	UID      string
+	Password string
+	Email    string
+}
+
+type entry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// Directory holds the entries and answers requests. Only the service
+// account may search; anyone may bind.
+type Directory struct {
+	bindDN       string
+	bindPassword string
+	entries      []entry
+}
+
+// NewDirectory returns a directory with a service account and users.
+func NewDirectory(bindDN, bindPassword string, users ...User) *Directory {
+	d := &Directory{bindDN: bindDN, bindPassword: bindPassword}
+	for _, u := range users {
+		d.entries = append(d.entries, entry{
+			dn:       fmt.Sprintf("uid=%s,%s", u.UID, PeopleDN),
+			password: u.Password,
+			attributes: map[string][]string{
+				"objectClass": {"top", "person", "inetOrgPerson"},
+				"uid":         {u.UID},
+				"cn":          {u.UID},
+				"mail":        {u.Email},
+			},
+		})
+	}
+	return d
+}
+
+// Len returns the number of user entries.
+func (d *Directory) Len() int {
+	return len(d.entries)
+}
+
+// Serve accepts connections on l and serves each in its own goroutine. It
+// returns when Accept fails, e.g. because l was closed.
+func (d *Directory) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go d.ServeConn(conn)
+	}
+}
+
+// ServeConn answers the LDAP requests on conn until the client unbinds or
+// the connection fails.
+func (d *Directory) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	bound := false
+
+	for {
+		message, err := ldap.ReadPacket(reader)
+		if err != nil {
+			return
+		}
+		if len(message.Children) < 2 {
+			return
+		}
+		id, _ := message.Child(0).Int()
+		op := message.Child(1)
+
+		reply := func(p *ldap.Packet) {
+			conn.Write(ldap.NewSequence(ldap.TagSequence, ldap.NewInt(ldap.TagInteger, id), p).Bytes())
+		}
+
+		switch op.Tag {
+		case ldap.TagBindRequest:
+			dn, password := op.Child(1).String(), op.Child(2).String()
+			code := d.bind(dn, password)
+			bound = code == resultSuccess
+			log.Printf("MockLDAP: Bind as %q: result %d", dn, code)
+			reply(result(ldap.TagBindResponse, code, ""))
+		case ldap.TagSearchRequest:
+			if !bound {
+				reply(result(ldap.TagSearchResultDone, resultInsufficientAccess, "anonymous search is not allowed"))
+				continue
+			}
+			d.search(op, reply)
+		case ldap.TagUnbindRequest:
+			return
+		case ldap.TagExtendedRequest:
+			reply(result(ldap.TagExtendedResponse, resultProtocolError, "extended operations are not supported"))
+		default:
+			reply(result(ldap.TagExtendedResponse, resultOperationsError, "unsupported operation"))
+		}
+	}
+}
+
+func (d *Directory) bind(dn, password string) int {
+	if password == "" {
+		return resultUnwillingToPerform
+	}
+	if strings.EqualFold(dn, d.bindDN) && password == d.bindPassword {
+		return resultSuccess
+	}
+	for _, e := range d.entries {
+		if strings.EqualFold(dn, e.dn) && password == e.password {
+			return resultSuccess
+		}
+	}
+	return resultInvalidCredentials
+}
+
+func (d *Directory) search(op *ldap.Packet, reply func(*ldap.Packet)) {
+	baseDN := strings.ToLower(op.Child(0).String())
+	sizeLimit, _ := op.Child(3).Int()
+	filter := op.Child(6)
+	var wanted []string
+	for _, attr := range op.Child(7).Children {
+		wanted = append(wanted, attr.String())
+	}
+
+	sent := 0
+	for _, e := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(e.dn), baseDN) || !matches(e, filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(sent) == sizeLimit {
+			reply(result(ldap.TagSearchResultDone, resultSizeLimitExceeded, ""))
+			return
+		}
+		reply(entryPacket(e, wanted))
+		sent++
+	}
+	log.Printf("MockLDAP: Search below %q returned %d entries", baseDN, sent)
+	reply(result(ldap.TagSearchResultDone, resultSuccess, ""))
+}
+
+func matches(e entry, filter *ldap.Packet) bool {
+	switch filter.Tag {
+	case ldap.TagFilterAnd:
+		for _, child := range filter.Children {
+			if !matches(e, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.TagFilterOr:
+		for _, child := range filter.Children {
+			if matches(e, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.TagFilterNot:
+		return !matches(e, filter.Child(0))
+	case ldap.TagFilterEqual:
+		for _, value := range values(e, filter.Child(0).String()) {
+			if strings.EqualFold(value, filter.Child(1).String()) {
+				return true
+			}
+		}
+		return false
+	case ldap.TagFilterPresent:
+		return len(values(e, filter.String())) > 0
+	}
+	return false
+}
+
+func values(e entry, attr string) []string {
+	for name, vals := range e.attributes {
+		if strings.EqualFold(name, attr) {
+			return vals
+		}
+	}
+	return nil
+}
+
+func entryPacket(e entry, wanted []string) *ldap.Packet {
+	attrs := ldap.NewSequence(ldap.TagSequence)
+	for name, vals := range e.attributes {
+		if len(wanted) > 0 && !containsFold(wanted, name) {
+			continue
+		}
+		set := ldap.NewSequence(ldap.TagSet)
+		for _, v := range vals {
+			set.Children = append(set.Children, ldap.NewString(ldap.TagOctetString, v))
+		}
+		attrs.Children = append(attrs.Children, ldap.NewSequence(ldap.TagSequence, ldap.NewString(ldap.TagOctetString, name), set))
+	}
+	return ldap.NewSequence(ldap.TagSearchResultEntry, ldap.NewString(ldap.TagOctetString, e.dn), attrs)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func result(tag byte, code int, message string) *ldap.Packet {
+	return ldap.NewSequence(tag,
+		ldap.NewInt(ldap.TagEnumerated, int64(code)),
+		ldap.NewString(ldap.TagOctetString, ""),
+		ldap.NewString(ldap.TagOctetString, message),
+	)
+}
@@ -0,0 +1,110 @@
+// Package lexorank generates string keys whose lexical order is a manual
+// ordering. A key can always be found between two others, so moving an
+// item rewrites only that item.
+package lexorank
+
+import (
+	"errors"
+	"strings"
+)
+
+// digits are the key alphabet in sort order. Keys never end in the lowest
+// digit, which leaves room for a key before any other.
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// ErrOrder is returned by Between when the bounds are not in order.
+var ErrOrder = errors.New("lexorank: keys out of order")
+
+// Between returns a key that sorts after a and before b. An empty a means
+// no lower bound and an empty b no upper bound.
+func Between(a, b string) (string, error) {
+	if !valid(a) || !valid(b) {
+		return "", errors.New("lexorank: invalid key")
+	}
+	if a != "" && b != "" && a >= b {
+		return "", ErrOrder
+	}
+	return midpoint(a, b), nil
+}
+
+// midpoint finds the shortest key between a and b, with b empty standing
+// for the end of the key space.
+func midpoint(a, b string) string {
+	if b != "" {
+		// Keep the prefix the bounds share, reading a as padded with the
+		// lowest digit
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+
+	lo := 0
+	if a != "" {
+		lo = strings.IndexByte(digits, a[0])
+	}
+	hi := len(digits)
+	if b != "" {
+		hi = strings.IndexByte(digits, b[0])
+	}
+	if hi-lo > 1 {
+		return string(digits[(lo+hi)/2])
+	}
+	// The first digits are adjacent: a longer b leaves room right below
+	// it, otherwise continue after a's first digit
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(digits[lo]) + midpoint(rest, "")
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return digits[0]
+}
+
+func valid(key string) bool {
+	if strings.HasSuffix(key, digits[:1]) {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Spread returns n keys in ascending order, evenly spaced and as short as
+// possible, for assigning positions to a whole list at once.
+func Spread(n int) []string {
+	width, space := 1, len(digits)
+	for space <= n {
+		width++
+		space *= len(digits)
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		v := (i + 1) * space / (n + 1)
+		key := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			key[j] = digits[v%len(digits)]
+			v /= len(digits)
+		}
+		keys[i] = strings.TrimRight(string(key), digits[:1])
+	}
+	return keys
+}
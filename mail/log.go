@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogMailer is meant for development: it writes every message to the log
+// and, when Dir is set, also saves it as an .eml file that can be opened
+// in a mail client.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("LogMailer: To: %s Subject: %s\n%s", msg.To, msg.Subject, msg.Body)
+
+	if m.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("mail: creating %s: %w", m.Dir, err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitizeFilename(msg.To))
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, buildMessage(m.From, msg), 0o600); err != nil {
+		return fmt.Errorf("mail: writing %s: %w", path, err)
+	}
+	log.Printf("LogMailer: Saved message to %s", path)
+	return nil
+}
+
+func sanitizeFilename(s string) string {
+	out := []rune(s)
+	for i, r := range out {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+		default:
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,72 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer sends mail through an SMTP relay. STARTTLS is used whenever the
+// server offers it, and credentials are only sent when Username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// The envelope sender must be a bare address even when From carries a
+	// display name.
+	envelopeFrom := m.From
+	if parsed, err := netmail.ParseAddress(m.From); err == nil {
+		envelopeFrom = parsed.Address
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, envelopeFrom, []string{msg.To}, buildMessage(m.From, msg))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Printf("SMTPMailer: Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+			return fmt.Errorf("mail: sending via %s: %w", addr, err)
+		}
+		log.Printf("SMTPMailer: Sent %q to %s", msg.Subject, msg.To)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMessage renders msg as an RFC 5322 plain-text email.
+func buildMessage(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes()
+}
@@ -1,89 +1,171 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
-	"net/http"
+	"os"
 
+	"todo-app/config"
 	"todo-app/database"
-	"todo-app/handlers"
-	"todo-app/middleware"
-
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
+	"todo-app/passwords"
 )
 
+const usageText = `Usage: todo [-config path] [-verbose] <command> [arguments]
+
+Commands:
+  serve                       run the web application (the default)
+  migrate                     create or update the database schema
+  user create                 create an account
+  user reset-password <name>  set a new password and sign the user out
+  user disable <name>         block logins and sign the user out
+  user enable <name>          undo user disable
+  user list                   list accounts
+  backup <file>               write a consistent copy of the database
+  restore <file>              replace the database with a backup
+
+Run "todo <command> -help" for the options of a command.
+`
+
 func main() {
-	// Initialize database
-	if err := database.InitDB(); err != nil {
-		log.Fatal("Failed to initialize database:", err)
-	}
-
-	// Initialize Gin router
-	r := gin.Default()
-
-	// Configure CORS
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:8080"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * 60 * 60, // 12 hours
-	}))
-
-	// Serve static files
-	r.Static("/static", "./static")
-	r.LoadHTMLGlob("templates/*")
-
-	// Public routes
-	r.GET("/", func(c *gin.Context) {
-		c.Redirect(http.StatusFound, "/login")
-	})
-	r.GET("/login", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "login.html", gin.H{
-			"title": "Login - To-Do List",
-		})
-	})
-	r.GET("/register", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "register.html", gin.H{
-			"title": "Register - To-Do List",
-		})
-	})
-
-	// Public API routes
-	r.POST("/api/register", handlers.Register)
-	r.POST("/api/login", handlers.Login)
-
-	// Protected API routes
-	api := r.Group("/api")
-	api.Use(middleware.AuthMiddleware())
-	{
-		api.GET("/profile", handlers.GetProfile)
-		api.GET("/todos", handlers.GetTodos)
-		api.POST("/todos", handlers.CreateTodo)
-		api.PUT("/todos/:id", handlers.UpdateTodo)
-		api.PUT("/todos/:id/toggle", handlers.ToggleTodo)
-		api.DELETE("/todos/:id", handlers.DeleteTodo)
-	}
-
-	// Protected pages
-	protected := r.Group("")
-	protected.Use(middleware.AuthMiddleware())
-	{
-		protected.GET("/profile", func(c *gin.Context) {
-			c.HTML(http.StatusOK, "profile.html", gin.H{
-				"title": "Profile - To-Do List",
-			})
-		})
-		protected.GET("/todos", func(c *gin.Context) {
-			c.HTML(http.StatusOK, "index.html", gin.H{
-				"title": "My Todos",
-			})
-		})
-	}
-
-	// Start server
-	if err := r.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	configPath := flag.String("config", os.Getenv("TODO_CONFIG"), "path to a YAML or TOML config file")
+	verbose := flag.Bool("verbose", false, "log database activity of commands other than serve")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usageText)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command, args := "serve", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	// Commands print their own results; the application's logging would
+	// drown them out
+	if command != "serve" && !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	// Load configuration
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		exitf("Failed to load configuration: %v", err)
+	}
+
+	switch command {
+	case "serve":
+		serve(cfg)
+		return
+	case "migrate":
+		err = runMigrate(cfg, args)
+	case "user":
+		err = runUser(cfg, args)
+	case "backup":
+		err = runBackup(cfg, args)
+	case "restore":
+		err = runRestore(cfg, args)
+	default:
+		fmt.Fprintf(os.Stderr, "todo: unknown command %q\n\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		exitf("%v", err)
+	}
+}
+
+// runMigrate applies the schema and exits, so upgrades can be run ahead of
+// starting the new version.
+func runMigrate(cfg *config.Config, args []string) error {
+	fs := newFlagSet("migrate", "")
+	fs.Parse(args)
+
+	if err := openDatabase(cfg); err != nil {
+		return err
+	}
+	defer database.Close()
+	fmt.Printf("Database %s is up to date\n", cfg.Database.Path)
+
+	conflicts, err := database.NormalizationConflicts()
+	if err != nil {
+		return fmt.Errorf("failed to check for conflicting accounts: %w", err)
+	}
+	if len(conflicts) > 0 {
+		fmt.Printf("\n%d accounts clash with another once case and Unicode width are ignored.\n", len(conflicts))
+		fmt.Println("They can only log in with the exact spelling until one of the two is renamed:")
+		for _, conflict := range conflicts {
+			fmt.Printf("  user %d: %s %q, same as user %d\n", conflict.UserID, conflict.Field, conflict.Value, conflict.ConflictsWith)
+		}
+	}
+	return nil
+}
+
+// runBackup copies the database while it stays in use.
+func runBackup(cfg *config.Config, args []string) error {
+	fs := newFlagSet("backup", "<file>")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := openDatabase(cfg); err != nil {
+		return err
+	}
+	defer database.Close()
+	if err := database.Backup(fs.Arg(0)); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	fmt.Printf("Backed up %s to %s\n", cfg.Database.Path, fs.Arg(0))
+	return nil
+}
+
+// runRestore overwrites the database with a backup. The server must be
+// stopped first.
+func runRestore(cfg *config.Config, args []string) error {
+	fs := newFlagSet("restore", "<file>")
+	confirmed := fs.Bool("yes", false, "confirm that the current database is to be replaced")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !*confirmed {
+		return fmt.Errorf("restore replaces %s and everything in it; stop the server and run again with -yes", cfg.Database.Path)
+	}
+
+	if err := database.Restore(fs.Arg(0), cfg.Database.Path); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+	// Bring a backup taken by an older version up to the current schema
+	if err := openDatabase(cfg); err != nil {
+		return err
+	}
+	defer database.Close()
+	fmt.Printf("Restored %s from %s\n", cfg.Database.Path, fs.Arg(0))
+	return nil
+}
+
+func openDatabase(cfg *config.Config) error {
+	if err := database.InitDB(cfg.Database); err != nil {
+		return fmt.Errorf("failed to open database %s: %w", cfg.Database.Path, err)
 	}
+	database.SetPasswordHasher(passwords.NewHasher(cfg.Password.Hash))
+	return nil
+}
+
+// newFlagSet returns the flag set of a command that exits on bad flags.
+func newFlagSet(name, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: todo %s [options] %s\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func exitf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "todo: "+format+"\n", args...)
+	os.Exit(1)
 }
@@ -1,38 +1,48 @@
 package middleware
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
+	"todo-app/config"
 	"todo-app/database"
+	"todo-app/keyring"
+	"todo-app/tokens"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("your-secret-key") // In production, use environment variable
+// sessionTouchInterval bounds how often a session's last-seen time, or an
+// access token's last-used time, is written back to the database.
+const sessionTouchInterval = time.Minute
 
-func AuthMiddleware() gin.HandlerFunc {
+// How a request was authenticated, stored under "auth_method".
+const (
+	authMethodSession     = "session"
+	authMethodAccessToken = "token"
+)
+
+// AuthMiddleware authenticates requests by the access token in the token
+// cookie or the Authorization header, or by a personal access token in the
+// Authorization header.
+func AuthMiddleware(cfg *config.Config, ring *keyring.Ring) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Printf("AuthMiddleware: Processing request for path: %s", c.Request.URL.Path)
-		log.Printf("AuthMiddleware: Request headers: %v", c.Request.Header)
-		log.Printf("AuthMiddleware: Cookies: %v", c.Request.Cookies())
 
 		// First try to get token from cookie
 		tokenString, err := c.Cookie("token")
+		viaCookie := err == nil
 		if err != nil {
 			log.Printf("AuthMiddleware: No token cookie found: %v", err)
 			// If no cookie, try Authorization header
 			authHeader := c.GetHeader("Authorization")
 			if authHeader == "" {
 				log.Printf("AuthMiddleware: No Authorization header found")
-				if strings.HasPrefix(c.Request.URL.Path, "/api/") {
-					c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-				} else {
-					c.Redirect(http.StatusFound, "/login")
-				}
-				c.Abort()
+				abortUnauthorized(c, "Authorization header is required")
 				return
 			}
 			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
@@ -41,56 +51,173 @@ func AuthMiddleware() gin.HandlerFunc {
 			log.Printf("AuthMiddleware: Found token in cookie")
 		}
 
-		log.Printf("AuthMiddleware: Token string: %s", tokenString)
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				log.Printf("AuthMiddleware: Unexpected signing method: %v", token.Header["alg"])
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		if strings.HasPrefix(tokenString, tokens.PersonalAccessTokenPrefix) {
+			// The token cookie only ever holds a session JWT. A personal
+			// access token planted there would ride along on cross-site
+			// requests without the CSRF check, which covers sessions only
+			if viaCookie {
+				log.Printf("AuthMiddleware: Rejecting personal access token sent in the token cookie")
+				abortUnauthorized(c, "Invalid token")
+				return
 			}
-			return []byte("your-secret-key"), nil
-		})
+			authenticateAccessToken(c, tokenString)
+			return
+		}
 
+		claims, err := ring.Parse(tokenString, cfg.Auth.Audience)
 		if err != nil {
 			log.Printf("AuthMiddleware: Error parsing token: %v", err)
-			if strings.HasPrefix(c.Request.URL.Path, "/api/") {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			} else {
-				c.Redirect(http.StatusFound, "/login")
-			}
-			c.Abort()
+			abortUnauthorized(c, "Invalid token")
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userID := int64(claims["user_id"].(float64))
-			log.Printf("AuthMiddleware: Valid token for user ID: %d", userID)
-			log.Printf("AuthMiddleware: Token claims: %v", claims)
-
-			// Verify user exists
-			user, err := database.GetUserByID(userID)
-			if err != nil {
-				log.Printf("AuthMiddleware: User not found for ID %d: %v", userID, err)
-				if strings.HasPrefix(c.Request.URL.Path, "/api/") {
-					c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-				} else {
-					c.Redirect(http.StatusFound, "/login")
-				}
-				c.Abort()
-				return
-			}
-			log.Printf("AuthMiddleware: Verified user: %s (ID: %d)", user.Username, user.ID)
+		rawUserID, _ := claims["user_id"].(float64)
+		sessionID, _ := claims["sid"].(string)
+		if rawUserID == 0 || sessionID == "" {
+			log.Printf("AuthMiddleware: Token is missing user_id or sid claim")
+			abortUnauthorized(c, "Invalid token")
+			return
+		}
+		userID := int64(rawUserID)
+		log.Printf("AuthMiddleware: Valid token for user ID: %d", userID)
+
+		// Verify user exists
+		user, err := database.GetUserByID(userID)
+		if err != nil {
+			log.Printf("AuthMiddleware: User not found for ID %d: %v", userID, err)
+			abortUnauthorized(c, "User not found")
+			return
+		}
+		log.Printf("AuthMiddleware: Verified user: %s (ID: %d)", user.Username, user.ID)
+		if user.DisabledAt != nil {
+			log.Printf("AuthMiddleware: User ID %d is disabled", user.ID)
+			abortUnauthorized(c, "Account has been disabled")
+			return
+		}
+
+		// Reject tokens whose session was logged out or revoked
+		active, err := database.IsSessionActive(sessionID, userID)
+		if err != nil {
+			log.Printf("AuthMiddleware: Error checking session %s: %v", sessionID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			return
+		}
+		if !active {
+			log.Printf("AuthMiddleware: Session %s is revoked or expired", sessionID)
+			abortUnauthorized(c, "Session has been revoked")
+			return
+		}
+		if err := database.TouchSession(sessionID, c.ClientIP(), sessionTouchInterval); err != nil {
+			log.Printf("AuthMiddleware: Error updating last seen for session %s: %v", sessionID, err)
+		}
+
+		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
+		c.Set("auth_method", authMethodSession)
+		c.Set("auth_via_cookie", viaCookie)
+		// The role comes from the database rather than the token claim, so
+		// a demotion takes effect without waiting for the token to expire
+		c.Set("role", user.Role)
+		c.Next()
+	}
+}
+
+// authenticateAccessToken handles requests that carry a personal access
+// token instead of a session JWT.
+func authenticateAccessToken(c *gin.Context, tokenString string) {
+	token, err := database.GetAccessTokenByHash(tokens.Hash(tokenString))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("AuthMiddleware: Error looking up access token: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+			return
+		}
+		log.Printf("AuthMiddleware: Unknown, revoked or expired access token")
+		abortUnauthorized(c, "Invalid token")
+		return
+	}
+
+	user, err := database.GetUserByID(token.UserID)
+	if err != nil {
+		log.Printf("AuthMiddleware: User not found for ID %d: %v", token.UserID, err)
+		abortUnauthorized(c, "User not found")
+		return
+	}
+	log.Printf("AuthMiddleware: Access token %s (ID: %d) used by user ID: %d", token.Prefix, token.ID, user.ID)
+	if user.DisabledAt != nil {
+		log.Printf("AuthMiddleware: User ID %d is disabled", user.ID)
+		abortUnauthorized(c, "Account has been disabled")
+		return
+	}
+	// Restoring an account takes a password login, not a token
+	if user.DeletionScheduledAt != nil {
+		log.Printf("AuthMiddleware: User ID %d is scheduled for deletion", user.ID)
+		abortUnauthorized(c, "Account is scheduled for deletion")
+		return
+	}
+
+	if err := database.TouchAccessToken(token.ID, sessionTouchInterval); err != nil {
+		log.Printf("AuthMiddleware: Error updating last use of access token %d: %v", token.ID, err)
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("auth_method", authMethodAccessToken)
+	c.Set("token_scopes", token.Scopes)
+	c.Set("role", user.Role)
+	c.Next()
+}
 
-			c.Set("user_id", userID)
+// RequireScope lets personal access tokens through only if they were granted
+// the scope. Session logins have every scope. It must run after
+// AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") != authMethodAccessToken || slices.Contains(c.GetStringSlice("token_scopes"), scope) {
 			c.Next()
-		} else {
-			log.Printf("AuthMiddleware: Invalid token claims or token not valid")
-			if strings.HasPrefix(c.Request.URL.Path, "/api/") {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			} else {
-				c.Redirect(http.StatusFound, "/login")
-			}
-			c.Abort()
+			return
 		}
+		log.Printf("RequireScope: Access token lacks scope %s for path: %s", scope, c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":          "Token does not have the required scope",
+			"required_scope": scope,
+		})
+	}
+}
+
+// RequireSession keeps personal access tokens away from account management,
+// so a leaked token cannot be used to change the password or mint more
+// tokens. It must run after AuthMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") == authMethodSession {
+			c.Next()
+			return
+		}
+		log.Printf("RequireSession: Rejecting access token for path: %s", c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an access token"})
+	}
+}
+
+// RequireRole lets only users with one of the roles through. It must run
+// after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(roles, c.GetString("role")) {
+			c.Next()
+			return
+		}
+		log.Printf("RequireRole: User ID %d with role %q denied for path: %s", c.GetInt64("user_id"), c.GetString("role"), c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to access this resource"})
+	}
+}
+
+// abortUnauthorized answers API requests with a JSON 401 and sends page
+// requests back to the login form.
+func abortUnauthorized(c *gin.Context, message string) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	} else {
+		c.Redirect(http.StatusFound, "/login")
 	}
+	c.Abort()
 }
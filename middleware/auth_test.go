@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/keyring"
+	"todo-app/models"
+	"todo-app/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// setupAuthTest returns a router serving POST /api/todos behind
+// AuthMiddleware and CSRF, and a personal access token for a new user.
+func setupAuthTest(t *testing.T) (*gin.Engine, string) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "todo.db")
+	if err := database.InitDB(cfg.Database); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	ring, err := keyring.New(cfg.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := database.CreateUser(models.RegisterInput{Username: "alice", Email: "alice@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, prefix, err := tokens.GeneratePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = database.CreateAccessToken(models.PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      "test",
+		Prefix:    prefix,
+		TokenHash: tokens.Hash(token),
+		Scopes:    []string{models.ScopeTodosWrite},
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/api/todos", AuthMiddleware(cfg, ring), CSRF(cfg), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	return r, token
+}
+
+func TestAccessTokenInAuthorizationHeader(t *testing.T) {
+	r, token := setupAuthTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/todos", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201; body %s", w.Code, w.Body)
+	}
+}
+
+// A token planted in the cookie would be sent along on cross-site
+// requests, which the CSRF check only covers for sessions.
+func TestAccessTokenInCookieRejected(t *testing.T) {
+	r, token := setupAuthTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/todos", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401; body %s", w.Code, w.Body)
+	}
+}
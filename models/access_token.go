@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Scopes a personal access token can be granted.
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+// PersonalAccessToken is a long-lived credential for scripts and
+// integrations. Only its hash is stored; Prefix is kept so users can tell
+// their tokens apart.
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// HasScope reports whether the token was granted the scope.
+func (t PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAccessTokenInput struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=todos:read todos:write"`
+	// ExpiresInDays of zero creates a token that never expires.
+	ExpiresInDays int `json:"expires_in_days" binding:"min=0,max=365"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// SystemStats is the overview shown to admins.
+type SystemStats struct {
+	Users            int `json:"users"`
+	Admins           int `json:"admins"`
+	DisabledUsers    int `json:"disabled_users"`
+	VerifiedUsers    int `json:"verified_users"`
+	TwoFactorUsers   int `json:"two_factor_users"`
+	PendingDeletions int `json:"pending_deletions"`
+	Todos            int `json:"todos"`
+	CompletedTodos   int `json:"completed_todos"`
+	ActiveSessions   int `json:"active_sessions"`
+	AccessTokens     int `json:"access_tokens"`
+}
+
+type ListUsersQuery struct {
+	Limit  int `form:"limit" binding:"omitempty,min=1,max=200"`
+	Offset int `form:"offset" binding:"omitempty,min=0"`
+}
+
+type SetRoleInput struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Security events recorded in the audit log.
+const (
+	AuditLoginSucceeded       = "login.succeeded"
+	AuditLoginFailed          = "login.failed"
+	AuditAccountLocked        = "account.locked"
+	AuditAccountRegistered    = "account.registered"
+	AuditAccountDeleted       = "account.deleted"
+	AuditAccountRestored      = "account.restored"
+	AuditPasswordChanged      = "password.changed"
+	AuditPasswordReset        = "password.reset"
+	AuditSessionRevoked       = "session.revoked"
+	AuditRefreshTokenReused   = "session.refresh_token_reused"
+	AuditTokenCreated         = "token.created"
+	AuditTokenRevoked         = "token.revoked"
+	AuditTwoFactorEnabled     = "2fa.enabled"
+	AuditTwoFactorDisabled    = "2fa.disabled"
+	AuditRecoveryCodesChanged = "2fa.recovery_codes_regenerated"
+	AuditUserDisabled         = "admin.user_disabled"
+	AuditUserEnabled          = "admin.user_enabled"
+	AuditUserRoleChanged      = "admin.role_changed"
+	AuditPasswordResetForced  = "admin.password_reset"
+)
+
+// AuditEvent is one entry of the security log. UserID is the account the
+// event is about and ActorID the signed-in user who caused it, which is an
+// admin for admin.* events. Either is nil once the account is purged.
+type AuditEvent struct {
+	ID        int64          `json:"id"`
+	UserID    *int64         `json:"user_id,omitempty"`
+	ActorID   *int64         `json:"actor_id,omitempty"`
+	Event     string         `json:"event"`
+	IPAddress string         `json:"ip_address"`
+	UserAgent string         `json:"user_agent"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// AuditQuery filters the security log. Event matches a full event name or
+// a prefix such as "login" for all login.* events.
+type AuditQuery struct {
+	UserID    int64      `form:"user_id" binding:"omitempty,min=1"`
+	Event     string     `form:"event"`
+	IPAddress string     `form:"ip"`
+	Since     *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until     *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit     int        `form:"limit" binding:"omitempty,min=1,max=200"`
+	Offset    int        `form:"offset" binding:"omitempty,min=0"`
+}
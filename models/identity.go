@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserIdentity links an account to the subject an OpenID Connect provider
+// knows it by.
+type UserIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Defaults for lists created without a color or icon. Icons are Font
+// Awesome names without the "fa-" prefix.
+const (
+	DefaultListColor = "#4f46e5"
+	DefaultListIcon  = "list"
+	InboxName        = "Inbox"
+	InboxIcon        = "inbox"
+)
+
+// List groups todos, like a project. Every user has one Inbox, which takes
+// todos created without a list and those of deleted lists; it cannot be
+// archived or deleted.
+type List struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Color      string     `json:"color"`
+	Icon       string     `json:"icon"`
+	Inbox      bool       `json:"inbox"`
+	Archived   bool       `json:"archived"`
+	ArchivedAt *time.Time `json:"archived_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// ListStats is a list with the counts shown next to it in the sidebar.
+type ListStats struct {
+	List
+	TodoCount    int `json:"todo_count"`
+	OpenCount    int `json:"open_count"`
+	OverdueCount int `json:"overdue_count"`
+}
+
+type CreateListInput struct {
+	Name  string `json:"name" binding:"required,max=100"`
+	Color string `json:"color" binding:"omitempty,hexcolor"`
+	Icon  string `json:"icon" binding:"omitempty,max=40"`
+}
+
+// UpdateListInput changes a list; empty fields and a missing Archived are
+// kept.
+type UpdateListInput struct {
+	Name     string `json:"name" binding:"omitempty,max=100"`
+	Color    string `json:"color" binding:"omitempty,hexcolor"`
+	Icon     string `json:"icon" binding:"omitempty,max=40"`
+	Archived *bool  `json:"archived"`
+}
+
+// ListQuery filters the list of lists.
+type ListQuery struct {
+	Archived bool `form:"archived"`
+}
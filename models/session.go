@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID               string     `json:"id"`
+	UserID           int64      `json:"user_id"`
+	RefreshTokenHash string     `json:"-"`
+	UserAgent        string     `json:"user_agent"`
+	Device           string     `json:"device"`
+	IPAddress        string     `json:"ip_address"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastSeenAt       time.Time  `json:"last_seen_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	Current          bool       `json:"current"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
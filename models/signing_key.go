@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SigningKey is a stored access token signing key. KeyData holds the
+// encrypted private key of asymmetric keys and is empty for HS256 keys,
+// which are derived from the configured secret.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	KeyData   string
+	CreatedAt time.Time
+	// RetiredAt is set once a newer key took over signing; the key keeps
+	// verifying tokens until ExpiresAt.
+	RetiredAt *time.Time
+	ExpiresAt *time.Time
+}
@@ -0,0 +1,30 @@
+package models
+
+// DefaultTagColor is given to tags created without a color, including
+// those created by naming them on a todo.
+const DefaultTagColor = "#6b7280"
+
+// Tag is a label a user puts on their todos. Names are unique per user,
+// ignoring ASCII case.
+type Tag struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// TagStats is a tag with the number of todos carrying it.
+type TagStats struct {
+	Tag
+	TodoCount int `json:"todo_count"`
+}
+
+type CreateTagInput struct {
+	Name  string `json:"name" binding:"required,max=50"`
+	Color string `json:"color" binding:"omitempty,hexcolor"`
+}
+
+// UpdateTagInput renames or recolors a tag; empty fields are kept.
+type UpdateTagInput struct {
+	Name  string `json:"name" binding:"omitempty,max=50"`
+	Color string `json:"color" binding:"omitempty,hexcolor"`
+}
@@ -1,24 +1,176 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// Todo due and reminder times are instants: clients send them in RFC 3339
+// with a UTC offset and get them back in UTC, to show in the user's zone.
 type Todo struct {
-	ID          int64     `json:"id"`
-	UserID      int64     `json:"user_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Completed   bool      `json:"completed"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	ListID int64 `json:"list_id"`
+	// ParentID is the todo this one is a subtask of, nil at the top level.
+	ParentID    *int64 `json:"parent_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Completed   bool   `json:"completed"`
+	Priority    string `json:"priority"`
+	// Position orders todos manually; it only means something compared to
+	// the positions of the user's other todos.
+	Position string     `json:"position"`
+	DueAt    *time.Time `json:"due_at"`
+	RemindAt *time.Time `json:"remind_at"`
+	// RemindedAt is when the reminder went out; it is cleared when
+	// RemindAt changes.
+	RemindedAt *time.Time `json:"reminded_at"`
+	Tags       []Tag      `json:"tags"`
+	Progress   Progress   `json:"progress"`
+	// Subtasks are only filled in when a single todo is fetched.
+	Subtasks  []Todo    `json:"subtasks,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Progress counts the direct subtasks of a todo and how many are done.
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
 }
 
 type CreateTodoInput struct {
-	Title       string `json:"title" binding:"required"`
-	Description string `json:"description"`
+	// ListID is the list to add the todo to, the Inbox when zero.
+	// Subtasks go on the list of their parent.
+	ListID int64 `json:"list_id" binding:"omitempty,min=1"`
+	// ParentID makes the todo a subtask of another one.
+	ParentID    int64      `json:"parent_id" binding:"omitempty,min=1"`
+	Title       string     `json:"title" binding:"required"`
+	Description string     `json:"description"`
+	Priority    string     `json:"priority" binding:"omitempty,oneof=none low medium high urgent"`
+	DueAt       *time.Time `json:"due_at"`
+	RemindAt    *time.Time `json:"remind_at"`
+	// Tags are tag names; missing tags are created.
+	Tags []string `json:"tags" binding:"max=20,dive,required,max=50"`
 }
 
 type UpdateTodoInput struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Completed   bool   `json:"completed"`
+	// ListID moves the todo and its subtasks to another list when set.
+	ListID int64 `json:"list_id" binding:"omitempty,min=1"`
+	// ParentID moves the todo under another one, or to the top level when
+	// sent as null.
+	ParentID    OptionalID   `json:"parent_id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Completed   bool         `json:"completed"`
+	Priority    string       `json:"priority" binding:"omitempty,oneof=none low medium high urgent"`
+	DueAt       OptionalTime `json:"due_at"`
+	RemindAt    OptionalTime `json:"remind_at"`
+	// Tags replaces the todo's tags when present; an empty list removes
+	// them all.
+	Tags *[]string `json:"tags" binding:"omitempty,max=20,dive,required,max=50"`
+}
+
+// MoveTodoInput places a todo directly after AfterID or directly before
+// BeforeID; giving both checks they are in that order.
+type MoveTodoInput struct {
+	AfterID  int64 `json:"after_id" binding:"omitempty,min=1"`
+	BeforeID int64 `json:"before_id" binding:"omitempty,min=1"`
+}
+
+// Todo priorities, lowest first.
+const (
+	PriorityNone   = "none"
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// Todo sort orders for TodoQuery.Sort.
+const (
+	// SortPriority puts the most urgent first.
+	SortPriority = "priority"
+	// SortDue puts the earliest due first and todos without one last.
+	SortDue = "due"
+	// SortPosition follows the manual order.
+	SortPosition = "position"
+	// SortCreated and SortUpdated put the newest first.
+	SortCreated = "created"
+	SortUpdated = "updated"
+)
+
+// Tag filter modes for TodoQuery.TagMatch.
+const (
+	TagMatchAll = "all"
+	TagMatchAny = "any"
+)
+
+// OptionalTime is a time in an update that tells a field left out (Set is
+// false) apart from one sent as null to clear it.
+type OptionalTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+func (t *OptionalTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if string(data) == "null" {
+		t.Time = nil
+		return nil
+	}
+	var v time.Time
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Time = &v
+	return nil
+}
+
+// OptionalID is an ID in an update that tells a field left out (Set is
+// false) apart from one sent as null to clear it.
+type OptionalID struct {
+	Set bool
+	ID  *int64
+}
+
+func (id *OptionalID) UnmarshalJSON(data []byte) error {
+	id.Set = true
+	if string(data) == "null" {
+		id.ID = nil
+		return nil
+	}
+	var v int64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	id.ID = &v
+	return nil
+}
+
+// TodoQuery filters the todo list. Todos of archived lists are left out
+// unless ListID names one or Archived is set. Overdue selects unfinished
+// todos whose due time has passed. Tags selects todos carrying all of the
+// named tags, or any of them when TagMatch is TagMatchAny. Only top-level
+// todos are listed unless ParentID asks for the subtasks of a todo or
+// Subtasks for todos at every level.
+type TodoQuery struct {
+	ListID    int64      `form:"list_id" binding:"omitempty,min=1"`
+	ParentID  int64      `form:"parent_id" binding:"omitempty,min=1"`
+	Subtasks  bool       `form:"subtasks"`
+	Archived  bool       `form:"archived"`
+	DueBefore *time.Time `form:"due_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Overdue   bool       `form:"overdue"`
+	Tags      []string   `form:"tag"`
+	TagMatch  string     `form:"tag_match" binding:"omitempty,oneof=all any"`
+	// Sort is one of the Sort* orders, SortCreated by default.
+	Sort string `form:"sort" binding:"omitempty,oneof=priority due position created updated"`
+}
+
+// Reminder is a todo whose reminder has come due, with the owner to tell.
+type Reminder struct {
+	Todo          Todo
+	Username      string
+	Email         string
+	EmailVerified bool
 }
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type User struct {
 	ID        int64     `json:"id"`
@@ -9,15 +12,92 @@ type User struct {
 	Password  string    `json:"-"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	EmailVerifiedAt     *time.Time `json:"email_verified_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	TwoFactorEnabledAt  *time.Time `json:"two_factor_enabled_at"`
+
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+
+	FailedLoginCount int        `json:"-"`
+	LockedUntil      *time.Time `json:"-"`
 }
 
+// Roles a user can have. Admins can use the /api/admin endpoints.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type RegisterInput struct {
-	Username string `json:"username" binding:"required,min=3,max=32"`
+	// Usernames cannot contain "@" so a login identifier is never ambiguous
+	Username string `json:"username" binding:"required,min=3,max=32,excludes=@"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	// Password is checked against the password policy by the handler
+	Password string `json:"password" binding:"required"`
 }
 
 type LoginInput struct {
-	Username string `json:"username" binding:"required,min=3"`
+	// Identifier is a username or an email address.
+	Identifier string `json:"identifier" binding:"required_without=Username"`
+	// Username is what older clients send instead of Identifier.
+	Username string `json:"username"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginIdentifier returns the username or email address the user entered.
+func (in LoginInput) LoginIdentifier() string {
+	if in.Identifier != "" {
+		return strings.TrimSpace(in.Identifier)
+	}
+	return strings.TrimSpace(in.Username)
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ResendVerificationInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorInput struct {
 	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginInput completes a login that is waiting for its second
+// factor. Code is either a current TOTP code or an unused recovery code.
+type TwoFactorLoginInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// NormalizationConflict is an account whose normalized username or email
+// address is already held by another account. It can still log in with the
+// exact spelling until one of the two is renamed.
+type NormalizationConflict struct {
+	UserID        int64  `json:"user_id"`
+	Field         string `json:"field"`
+	Value         string `json:"value"`
+	ConflictsWith int64  `json:"conflicts_with"`
 }
@@ -0,0 +1,45 @@
+// Package normalize maps usernames and email addresses to the canonical
+// form accounts are matched by, so that "Alice", "ALICE" and "ａｌｉｃｅ" all
+// name the same account.
+package normalize
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Username returns the canonical form of a username: Unicode NFKC with full
+// case folding, without surrounding whitespace.
+func Username(s string) string {
+	return fold(s)
+}
+
+// Email returns the canonical form of an email address. Both the local part
+// and the domain are folded; providers that treat the local part as case
+// sensitive are vanishingly rare.
+func Email(s string) string {
+	return fold(s)
+}
+
+// Identifier normalizes a login identifier as an email address or a
+// username, whichever it is.
+func Identifier(s string) string {
+	if IsEmail(s) {
+		return Email(s)
+	}
+	return Username(s)
+}
+
+// IsEmail reports whether a login identifier is an email address rather
+// than a username. Usernames cannot contain "@".
+func IsEmail(identifier string) bool {
+	return strings.Contains(identifier, "@")
+}
+
+func fold(s string) string {
+	// Case folding can produce unnormalized text, so normalize on both sides
+	s = norm.NFKC.String(strings.TrimSpace(s))
+	return norm.NFKC.String(cases.Fold().String(s))
+}
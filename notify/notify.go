@@ -0,0 +1,72 @@
+// Package notify tells users about todos whose reminder has come due.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"todo-app/config"
+	"todo-app/mail"
+	"todo-app/models"
+)
+
+// Notifier delivers a reminder to the owner of a todo.
+type Notifier interface {
+	Notify(ctx context.Context, r models.Reminder) error
+}
+
+// New returns the Notifier selected by cfg.Todos.ReminderNotifier. Mail
+// goes out through mailer.
+func New(cfg *config.Config, mailer mail.Mailer) (Notifier, error) {
+	switch cfg.Todos.ReminderNotifier {
+	case config.NotifierMail, "":
+		return &MailNotifier{
+			Mailer:  mailer,
+			BaseURL: cfg.Server.BaseURL,
+			// Reminders are notifications, which unverified addresses do
+			// not get unless verification is switched off
+			RequireVerified: cfg.Auth.EmailVerification != config.EmailVerificationOff,
+		}, nil
+	case config.NotifierLog:
+		return LogNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("notify: unknown notifier %q", cfg.Todos.ReminderNotifier)
+	}
+}
+
+// MailNotifier emails reminders. With RequireVerified set, owners whose
+// address is not verified are skipped.
+type MailNotifier struct {
+	Mailer          mail.Mailer
+	BaseURL         string
+	RequireVerified bool
+}
+
+func (n *MailNotifier) Notify(ctx context.Context, r models.Reminder) error {
+	if n.RequireVerified && !r.EmailVerified {
+		log.Printf("MailNotifier: Skipping reminder for todo %d, email of %s not verified", r.Todo.ID, r.Username)
+		return nil
+	}
+
+	due := ""
+	if r.Todo.DueAt != nil {
+		due = fmt.Sprintf("It is due at %s.\n", r.Todo.DueAt.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	return n.Mailer.Send(ctx, mail.Message{
+		To:      r.Email,
+		Subject: "Reminder: " + r.Todo.Title,
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThis is your reminder for \"%s\".\n%s\nSee your list at %s/todos\n",
+			r.Username, r.Todo.Title, due, n.BaseURL,
+		),
+	})
+}
+
+// LogNotifier only writes reminders to the log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, r models.Reminder) error {
+	log.Printf("LogNotifier: Reminder for %s: todo %d %q, due %v", r.Username, r.Todo.ID, r.Todo.Title, r.Todo.DueAt)
+	return nil
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"todo-app/config"
+	"todo-app/mail"
+	"todo-app/models"
+)
+
+type recordingMailer struct {
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Reminders are the notification feature that restricted email
+// verification keeps from unverified addresses.
+func TestMailNotifierVerification(t *testing.T) {
+	previous := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	for _, tc := range []struct {
+		policy   string
+		verified bool
+		wantSent bool
+	}{
+		{config.EmailVerificationRestricted, true, true},
+		{config.EmailVerificationRestricted, false, false},
+		{config.EmailVerificationRequired, false, false},
+		{config.EmailVerificationOff, false, true},
+	} {
+		cfg := config.Default()
+		cfg.Auth.EmailVerification = tc.policy
+		mailer := &recordingMailer{}
+		n, err := New(cfg, mailer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reminder := models.Reminder{
+			Todo:          models.Todo{ID: 1, Title: "Water the plants"},
+			Username:      "alice",
+			Email:         "alice@example.com",
+			EmailVerified: tc.verified,
+		}
+		if err := n.Notify(context.Background(), reminder); err != nil {
+			t.Fatal(err)
+		}
+		if sent := len(mailer.sent) > 0; sent != tc.wantSent {
+			t.Errorf("%s, verified %v: sent %v, want %v", tc.policy, tc.verified, sent, tc.wantSent)
+			continue
+		}
+		if tc.wantSent && !strings.Contains(mailer.sent[0].Subject, "Water the plants") {
+			t.Errorf("subject %q does not name the todo", mailer.sent[0].Subject)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package oidctest is an in-memory OpenID Connect provider for tests. It
+// serves discovery, keys and the token endpoint over httptest, and issues
+// authorization codes for whichever identity the test asks for, so it must
+// never be exposed to a network.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID names the provider's signing key.
+const KeyID = "test-key"
+
+// Identity is the user the provider signs in.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type authCode struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	identity    Identity
+}
+
+// Provider is a running mock identity provider.
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+
+	// ModifyDiscovery, if set, edits the discovery document before it is
+	// served.
+	ModifyDiscovery func(doc map[string]any)
+	// ModifyIDToken, if set, edits the ID token claims before they are
+	// signed.
+	ModifyIDToken func(claims jwt.MapClaims)
+	// SigningKey, if set, signs ID tokens instead of the published key,
+	// producing tokens with a bad signature.
+	SigningKey *rsa.PrivateKey
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+// NewProvider starts a provider that accepts the given client. An empty
+// secret makes it a public client. Close it when done.
+func NewProvider(clientID, clientSecret string) (*Provider, error) {
+	key, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		codes:        make(map[string]authCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("POST /token", p.token)
+	p.server = httptest.NewServer(mux)
+	return p, nil
+}
+
+// NewKey returns a fresh RSA key, e.g. for SigningKey.
+func NewKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// Issuer is the provider's issuer URL.
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// Close shuts the provider down.
+func (p *Provider) Close() {
+	p.server.Close()
+}
+
+// Authorize plays the user approving the sign-in: it checks the request
+// sent to the authorization endpoint and returns the redirect URI with a
+// new code and the request's state, as the provider would redirect to.
+func (p *Provider) Authorize(authURL string, identity Identity) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme+"://"+u.Host+u.Path != p.Issuer()+"/authorize" {
+		return "", errors.New("oidctest: not this provider's authorization endpoint")
+	}
+	q := u.Query()
+	if q.Get("client_id") != p.ClientID || q.Get("response_type") != "code" {
+		return "", errors.New("oidctest: invalid authorization request")
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		return "", errors.New("oidctest: PKCE with S256 is required")
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		return "", errors.New("oidctest: invalid redirect_uri")
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authCode{
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		identity:    identity,
+	}
+	p.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	return redirectURI.String(), nil
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	doc := map[string]any{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	}
+	if p.ModifyDiscovery != nil {
+		p.ModifyDiscovery(doc)
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	public := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.ClientSecret)) != 1 {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	// Codes are single-use
+	p.mu.Lock()
+	code, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !found || code.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"sub":            code.identity.Subject,
+		"aud":            p.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          code.nonce,
+		"email":          code.identity.Email,
+		"email_verified": code.identity.EmailVerified,
+		"name":           code.identity.Name,
+	}
+	if p.ModifyIDToken != nil {
+		p.ModifyIDToken(claims)
+	}
+	signingKey := p.key
+	if p.SigningKey != nil {
+		signingKey = p.SigningKey
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = KeyID
+	signed, err := idToken.SignedString(signingKey)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
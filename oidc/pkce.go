@@ -0,0 +1,19 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"todo-app/tokens"
+)
+
+// NewVerifier returns a random PKCE code verifier (RFC 7636).
+func NewVerifier() (string, error) {
+	return tokens.Generate(32)
+}
+
+// Challenge returns the S256 code challenge for a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,203 @@
+// Package oidc is a minimal OpenID Connect relying party: it discovers a
+// provider's endpoints, builds authorization code requests with PKCE,
+// exchanges codes for tokens and verifies ID tokens.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"todo-app/config"
+)
+
+// httpTimeout bounds every request to the provider.
+const httpTimeout = 10 * time.Second
+
+// Discovery is the part of a provider's discovery document the relying
+// party uses.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	ID   string
+	Name string
+
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	allowSignup  bool
+	client       *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      keySet
+}
+
+// NewProvider returns a provider for the configured issuer. The discovery
+// document is fetched on first use, so an unreachable provider does not
+// keep the application from starting.
+func NewProvider(cfg config.OIDCProvider) *Provider {
+	scopes := []string{"openid"}
+	extra := cfg.Scopes
+	if len(extra) == 0 {
+		extra = []string{"email", "profile"}
+	}
+	for _, scope := range extra {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &Provider{
+		ID:           cfg.ID,
+		Name:         cfg.Name,
+		issuer:       strings.TrimSuffix(cfg.Issuer, "/"),
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		scopes:       scopes,
+		allowSignup:  cfg.AllowSignup,
+		client:       &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// AllowSignup reports whether the provider may create new accounts.
+func (p *Provider) AllowSignup() bool {
+	return p.allowSignup
+}
+
+func (p *Provider) discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc Discovery
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("oidc: discovery for %s: %w", p.issuer, err)
+	}
+	// The issuer in the document must be exactly the configured one, or ID
+	// tokens could be accepted from a provider that merely shares the URL
+	if strings.TrimSuffix(doc.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", doc.Issuer, p.issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing endpoints")
+	}
+	log.Printf("OIDC: Discovered endpoints for provider %s", p.ID)
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// AuthCodeURL returns the URL to send the browser to. The challenge is the
+// S256 PKCE challenge of a verifier kept by the caller.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, challenge string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange trades an authorization code for tokens and returns the verified
+// ID token claims. The nonce must be the one sent with the authorization
+// request.
+func (p *Provider) Exchange(ctx context.Context, redirectURI, code, verifier, nonce string) (*Claims, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	if p.clientSecret == "" {
+		form.Set("client_id", p.clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("oidc: token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("oidc: token request failed with status %d: %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+
+	return p.verifyIDToken(ctx, doc, body.IDToken, nonce)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
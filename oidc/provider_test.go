@@ -0,0 +1,212 @@
+package oidc
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"todo-app/config"
+	"todo-app/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testRedirectURI = "https://todo.example.com/auth/oidc/mock/callback"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// setupProvider starts a mock identity provider and a relying party
+// configured for it.
+func setupProvider(t *testing.T, clientSecret string) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	idp, err := oidctest.NewProvider("todo-app", clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+	p := NewProvider(config.OIDCProvider{
+		ID:           "mock",
+		Name:         "Mock",
+		Issuer:       idp.Issuer() + "/",
+		ClientID:     "todo-app",
+		ClientSecret: clientSecret,
+	})
+	return idp, p
+}
+
+var testIdentity = oidctest.Identity{Subject: "sub-1", Email: "sso@example.com", EmailVerified: true, Name: "SSO User"}
+
+// signIn runs an authorization code flow up to the code exchange. The
+// exchange uses exchangeVerifier and exchangeNonce, which are the values
+// sent with the authorization request unless given.
+func signIn(t *testing.T, idp *oidctest.Provider, p *Provider, exchangeVerifier, exchangeNonce string) (*Claims, error) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, testRedirectURI, "state-1", "nonce-1", Challenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := idp.Authorize(authURL, testIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("state"); got != "state-1" {
+		t.Fatalf("state = %q, want state-1", got)
+	}
+
+	if exchangeVerifier == "" {
+		exchangeVerifier = verifier
+	}
+	if exchangeNonce == "" {
+		exchangeNonce = "nonce-1"
+	}
+	return p.Exchange(ctx, testRedirectURI, u.Query().Get("code"), exchangeVerifier, exchangeNonce)
+}
+
+func TestDiscovery(t *testing.T) {
+	idp, p := setupProvider(t, "secret")
+
+	authURL, err := p.AuthCodeURL(context.Background(), testRedirectURI, "state-1", "nonce-1", Challenge("verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint := u.Scheme + "://" + u.Host + u.Path; endpoint != idp.Issuer()+"/authorize" {
+		t.Errorf("authorization endpoint = %s", endpoint)
+	}
+	q := u.Query()
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "todo-app",
+		"redirect_uri":          testRedirectURI,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        Challenge("verifier"),
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDiscoveryRejectsOtherIssuer(t *testing.T) {
+	idp, p := setupProvider(t, "secret")
+	idp.ModifyDiscovery = func(doc map[string]any) { doc["issuer"] = "https://idp.example.com" }
+
+	if _, err := p.AuthCodeURL(context.Background(), testRedirectURI, "state-1", "nonce-1", Challenge("verifier")); err == nil {
+		t.Error("discovery document for another issuer accepted")
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	if got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Challenge = %s", got)
+	}
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 43 to 128 characters
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Errorf("verifier has %d characters", len(verifier))
+	}
+}
+
+func TestExchange(t *testing.T) {
+	for name, secret := range map[string]string{"confidential": "secret", "public": ""} {
+		t.Run(name, func(t *testing.T) {
+			idp, p := setupProvider(t, secret)
+			claims, err := signIn(t, idp, p, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Claims{Subject: "sub-1", Email: "sso@example.com", EmailVerified: true, Name: "SSO User"}
+			if *claims != want {
+				t.Errorf("claims = %+v, want %+v", *claims, want)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp, p := setupProvider(t, "secret")
+	other, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signIn(t, idp, p, other, ""); err == nil {
+		t.Error("code exchanged with the wrong PKCE verifier")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	idp, p := setupProvider(t, "secret")
+	if _, err := signIn(t, idp, p, "", "nonce-2"); err == nil {
+		t.Error("ID token for another nonce accepted")
+	}
+}
+
+func TestExchangeRejectsIDToken(t *testing.T) {
+	otherKey, err := oidctest.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		modify func(idp *oidctest.Provider)
+	}{
+		{"wrong signature", func(idp *oidctest.Provider) { idp.SigningKey = otherKey }},
+		{"wrong issuer", modifyClaims(func(c jwt.MapClaims) { c["iss"] = "https://idp.example.com" })},
+		{"wrong audience", modifyClaims(func(c jwt.MapClaims) { c["aud"] = "other-app" })},
+		{"several audiences without azp", modifyClaims(func(c jwt.MapClaims) { c["aud"] = []string{"todo-app", "other-app"} })},
+		{"expired", modifyClaims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() })},
+		{"issued in the future", modifyClaims(func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() })},
+		{"no nonce", modifyClaims(func(c jwt.MapClaims) { delete(c, "nonce") })},
+		{"no subject", modifyClaims(func(c jwt.MapClaims) { delete(c, "sub") })},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idp, p := setupProvider(t, "secret")
+			tc.modify(idp)
+			if _, err := signIn(t, idp, p, "", ""); err == nil {
+				t.Error("ID token accepted")
+			}
+		})
+	}
+}
+
+func modifyClaims(modify func(jwt.MapClaims)) func(*oidctest.Provider) {
+	return func(idp *oidctest.Provider) { idp.ModifyIDToken = modify }
+}
+
+func TestExchangeEmailVerifiedAsString(t *testing.T) {
+	idp, p := setupProvider(t, "secret")
+	idp.ModifyIDToken = func(c jwt.MapClaims) { c["email_verified"] = "true" }
+	claims, err := signIn(t, idp, p, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.EmailVerified {
+		t.Error(`email_verified "true" not accepted`)
+	}
+}
@@ -0,0 +1,218 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// leeway absorbs clock differences between us and the provider.
+const leeway = time.Minute
+
+// keyRefreshInterval limits how often an unknown kid makes us fetch the
+// provider's keys again.
+const keyRefreshInterval = time.Minute
+
+// signingAlgorithms are the ID token algorithms we accept. "none" and the
+// HMAC algorithms are deliberately missing.
+var signingAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Claims are the verified ID token claims the application uses.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type keySet struct {
+	keys      map[string]jwk
+	fetchedAt time.Time
+}
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, doc *Discovery, raw, nonce string) (*Claims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(signingAlgorithms),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.publicKey(ctx, doc, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm != "" && key.Algorithm != token.Method.Alg() {
+			return nil, fmt.Errorf("token algorithm %s does not match key %q (%s)", token.Method.Alg(), kid, key.Algorithm)
+		}
+		return key.publicKey()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oidc: invalid id_token: %w", err)
+	}
+
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return nil, errors.New("oidc: id_token has no expiry")
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("oidc: id_token nonce does not match")
+	}
+	// A token issued to several clients must name us as the authorized party
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.clientID {
+			return nil, errors.New("oidc: id_token azp does not match the client ID")
+		}
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, errors.New("oidc: id_token has no subject")
+	}
+	result := &Claims{Subject: subject}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	// Some providers send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		result.EmailVerified = v == "true"
+	}
+	return result, nil
+}
+
+// publicKey finds the provider's key by kid, fetching the key set again if
+// the kid is unknown, since that is how providers roll over their keys.
+func (p *Provider) publicKey(ctx context.Context, doc *Discovery, kid string) (jwk, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys.find(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keys.fetchedAt) < keyRefreshInterval {
+		return jwk{}, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	p.keys.fetchedAt = time.Now()
+	if err := p.getJSON(ctx, doc.JWKSURI, &set); err != nil {
+		return jwk{}, fmt.Errorf("fetching signing keys: %w", err)
+	}
+	p.keys.keys = make(map[string]jwk)
+	for _, key := range set.Keys {
+		if key.Use == "" || key.Use == "sig" {
+			p.keys.keys[key.KeyID] = key
+		}
+	}
+	log.Printf("OIDC: Loaded %d signing keys for provider %s", len(p.keys.keys), p.ID)
+
+	if key, ok := p.keys.find(kid); ok {
+		return key, nil
+	}
+	return jwk{}, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// find looks a key up by kid. A token without a kid is accepted only if the
+// provider has a single key.
+func (s keySet) find(kid string) (jwk, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC key is not on its curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,108 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	hashLength   = sha1.Size * 2
+	prefixLength = 5
+)
+
+// BreachedList holds SHA-1 hashes of passwords known from breaches. A list
+// loaded from a directory of range files only reads the one file for a
+// hash's prefix on each lookup, so it can be as large as the full Have I
+// Been Pwned corpus.
+type BreachedList struct {
+	dir    string
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreachedList opens a hash list file or a directory of range files;
+// see config.PasswordConfig.BreachedList for the formats.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("passwords: breached list: %w", err)
+	}
+	if info.IsDir() {
+		log.Printf("LoadBreachedList: Using range files in %s", path)
+		return &BreachedList{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("passwords: breached list: %w", err)
+	}
+	defer file.Close()
+
+	list := &BreachedList{hashes: make(map[[sha1.Size]byte]struct{})}
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		var sum [sha1.Size]byte
+		if len(hash) != hashLength {
+			return nil, fmt.Errorf("passwords: breached list %s line %d: not a SHA-1 hash", path, lineNo)
+		}
+		if _, err := hex.Decode(sum[:], []byte(hash)); err != nil {
+			return nil, fmt.Errorf("passwords: breached list %s line %d: %w", path, lineNo, err)
+		}
+		list.hashes[sum] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("passwords: breached list: %w", err)
+	}
+	log.Printf("LoadBreachedList: Loaded %d hashes from %s", len(list.hashes), path)
+	return list, nil
+}
+
+// Contains reports whether the password appears in the list.
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	if l.dir == "" {
+		_, found := l.hashes[sum]
+		return found, nil
+	}
+
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+	file, err := openRangeFile(l.dir, prefix)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		candidate, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(candidate, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// openRangeFile opens the range file for a prefix, named either PREFIX or
+// PREFIX.txt as the downloaders write them.
+func openRangeFile(dir, prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(dir, prefix))
+	}
+	return file, err
+}
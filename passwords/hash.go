@@ -0,0 +1,148 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"todo-app/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUnknownHash means a stored hash is in no format this package reads.
+	ErrUnknownHash = errors.New("passwords: unknown hash format")
+	// ErrMalformedHash means a stored hash names a known algorithm but cannot
+	// be parsed.
+	ErrMalformedHash = errors.New("passwords: malformed hash")
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Hasher hashes passwords with the configured algorithm. Argon2id hashes
+// are PHC strings:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+//
+// with salt and hash in unpadded base64. Bcrypt hashes keep their own
+// $2a$<cost>$ format, which is what older versions stored.
+type Hasher struct {
+	cfg config.PasswordHashConfig
+}
+
+// NewHasher returns a hasher for the configuration, which must be valid.
+func NewHasher(cfg config.PasswordHashConfig) *Hasher {
+	return &Hasher{cfg: cfg}
+}
+
+// Hash returns the encoded hash of a password.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == config.PasswordHashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	params := argon2Params{
+		version:     argon2.Version,
+		memory:      uint32(h.cfg.Argon2Memory),
+		iterations:  uint32(h.cfg.Argon2Iterations),
+		parallelism: uint8(h.cfg.Argon2Parallelism),
+	}
+	key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, argon2KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		config.PasswordHashArgon2id, params.version, params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// NeedsRehash reports whether a hash that just verified should be replaced
+// by a new one: it is bcrypt while the configuration asks for Argon2id, its
+// cost, memory or iterations are below the configured ones, or it was made
+// with another degree of parallelism. Argon2id hashes are kept when the
+// configuration asks for bcrypt.
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	if cost, err := bcrypt.Cost([]byte(encoded)); err == nil {
+		return h.cfg.Algorithm == config.PasswordHashArgon2id || cost < h.cfg.BcryptCost
+	}
+	params, _, _, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	if h.cfg.Algorithm != config.PasswordHashArgon2id {
+		return false
+	}
+	return params.version < argon2.Version ||
+		params.memory < uint32(h.cfg.Argon2Memory) ||
+		params.iterations < uint32(h.cfg.Argon2Iterations) ||
+		params.parallelism != uint8(h.cfg.Argon2Parallelism)
+}
+
+// Verify reports whether the password matches an encoded hash of any
+// supported algorithm and parameters.
+func Verify(password, encoded string) (bool, error) {
+	// No legitimate password is this long, and hashing it would be costly
+	if len(password) > config.PasswordMaxBytes {
+		return false, nil
+	}
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(encoded, "$"+config.PasswordHashArgon2id+"$"):
+		params, salt, key, err := parseArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+	}
+	return false, ErrUnknownHash
+}
+
+type argon2Params struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func parseArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	fields := strings.Split(encoded, "$")
+	if len(fields) != 6 || fields[0] != "" || fields[1] != config.PasswordHashArgon2id {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &params.version); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("%w: bad hash", ErrMalformedHash)
+	}
+	if params.iterations == 0 || params.parallelism == 0 {
+		return params, nil, nil, fmt.Errorf("%w: bad parameters", ErrMalformedHash)
+	}
+	return params, salt, key, nil
+}
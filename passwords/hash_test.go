@@ -0,0 +1,89 @@
+package passwords
+
+import (
+	"testing"
+
+	"todo-app/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHashConfig keeps Argon2id cheap enough for tests.
+func testHashConfig() config.PasswordHashConfig {
+	return config.PasswordHashConfig{
+		Algorithm:         config.PasswordHashArgon2id,
+		BcryptCost:        bcrypt.MinCost,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+}
+
+func TestHashVerify(t *testing.T) {
+	for _, algorithm := range []string{config.PasswordHashArgon2id, config.PasswordHashBcrypt} {
+		cfg := testHashConfig()
+		cfg.Algorithm = algorithm
+		hash, err := NewHasher(cfg).Hash("correct horse battery")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := Verify("correct horse battery", hash); !ok || err != nil {
+			t.Errorf("%s: Verify(right password) = %v, %v", algorithm, ok, err)
+		}
+		if ok, err := Verify("wrong", hash); ok || err != nil {
+			t.Errorf("%s: Verify(wrong password) = %v, %v", algorithm, ok, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	base := testHashConfig()
+	hash, err := NewHasher(base).Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptCfg := base
+	bcryptCfg.Algorithm = config.PasswordHashBcrypt
+	bcryptHash, err := NewHasher(bcryptCfg).Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		change func(*config.PasswordHashConfig)
+		hash   string
+		want   bool
+	}{
+		{"same parameters", func(*config.PasswordHashConfig) {}, hash, false},
+		{"more memory", func(c *config.PasswordHashConfig) { c.Argon2Memory *= 2 }, hash, true},
+		{"less memory", func(c *config.PasswordHashConfig) { c.Argon2Memory /= 2 }, hash, false},
+		{"more iterations", func(c *config.PasswordHashConfig) { c.Argon2Iterations++ }, hash, true},
+		{"more parallelism", func(c *config.PasswordHashConfig) { c.Argon2Parallelism = 4 }, hash, true},
+		{"switch to bcrypt", func(c *config.PasswordHashConfig) { c.Algorithm = config.PasswordHashBcrypt }, hash, false},
+		{"bcrypt to argon2id", func(*config.PasswordHashConfig) {}, bcryptHash, true},
+		{"same bcrypt cost", func(c *config.PasswordHashConfig) { c.Algorithm = config.PasswordHashBcrypt }, bcryptHash, false},
+		{"higher bcrypt cost", func(c *config.PasswordHashConfig) {
+			c.Algorithm = config.PasswordHashBcrypt
+			c.BcryptCost++
+		}, bcryptHash, true},
+		{"malformed", func(*config.PasswordHashConfig) {}, "$argon2id$v=19$m=64,t=1,p=0$c2FsdA$a2V5", true},
+	} {
+		cfg := base
+		tc.change(&cfg)
+		if got := NewHasher(cfg).NeedsRehash(tc.hash); got != tc.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Fewer threads than the hash was made with also means a new hash
+	parallel := base
+	parallel.Argon2Parallelism = 4
+	parallelHash, err := NewHasher(parallel).Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !NewHasher(base).NeedsRehash(parallelHash) {
+		t.Error("NeedsRehash = false for a hash with more parallelism than configured")
+	}
+}
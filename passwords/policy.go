@@ -0,0 +1,161 @@
+// Package passwords decides whether a new password is acceptable, and
+// hashes and verifies passwords for storage.
+package passwords
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"todo-app/config"
+	"todo-app/normalize"
+)
+
+// Violation codes. Clients translate them, filling in Params.
+const (
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeTooFewClasses = "too_few_classes"
+	CodePersonalInfo  = "personal_info"
+	CodeBreached      = "breached"
+)
+
+// personalInfoMinLength keeps very short usernames from ruling out every
+// password that happens to contain them.
+const personalInfoMinLength = 3
+
+// Violation is one rule a password breaks.
+type Violation struct {
+	Code   string         `json:"code"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// String describes the violation in English, for logs and the command line.
+func (v Violation) String() string {
+	switch v.Code {
+	case CodeTooShort:
+		return fmt.Sprintf("must be at least %v characters", v.Params["min"])
+	case CodeTooLong:
+		return fmt.Sprintf("must be at most %v bytes", v.Params["max"])
+	case CodeTooFewClasses:
+		return fmt.Sprintf("must mix at least %v of lowercase, uppercase, digits and symbols", v.Params["min"])
+	case CodePersonalInfo:
+		return "must not contain the username or email address"
+	case CodeBreached:
+		return "appears in a list of breached passwords"
+	}
+	return v.Code
+}
+
+// Policy checks passwords against the configured rules.
+type Policy struct {
+	cfg      config.PasswordConfig
+	breached *BreachedList
+}
+
+// NewPolicy builds the policy, loading the breached password list if one
+// is configured.
+func NewPolicy(cfg config.PasswordConfig) (*Policy, error) {
+	p := &Policy{cfg: cfg}
+	if cfg.BreachedList != "" {
+		list, err := LoadBreachedList(cfg.BreachedList)
+		if err != nil {
+			return nil, err
+		}
+		p.breached = list
+	}
+	return p, nil
+}
+
+// Requirements are the rules a client can show before a password is
+// entered.
+type Requirements struct {
+	MinLength          int  `json:"min_length"`
+	MaxBytes           int  `json:"max_bytes"`
+	MinClasses         int  `json:"min_classes"`
+	RejectPersonalInfo bool `json:"reject_personal_info"`
+	RejectBreached     bool `json:"reject_breached"`
+}
+
+// Requirements returns the rules of the policy.
+func (p *Policy) Requirements() Requirements {
+	return Requirements{
+		MinLength:          p.cfg.MinLength,
+		MaxBytes:           p.cfg.MaxBytes,
+		MinClasses:         p.cfg.MinClasses,
+		RejectPersonalInfo: p.cfg.RejectPersonalInfo,
+		RejectBreached:     p.breached != nil,
+	}
+}
+
+// Check returns every rule the password breaks for the account with the
+// given username and email, or nil if it is acceptable.
+func (p *Policy) Check(password, username, email string) []Violation {
+	var violations []Violation
+	if n := utf8.RuneCountInString(password); n < p.cfg.MinLength {
+		violations = append(violations, Violation{Code: CodeTooShort, Params: map[string]any{"min": p.cfg.MinLength}})
+	}
+	if len(password) > p.cfg.MaxBytes {
+		violations = append(violations, Violation{Code: CodeTooLong, Params: map[string]any{"max": p.cfg.MaxBytes}})
+	}
+	if classes := characterClasses(password); classes < p.cfg.MinClasses {
+		violations = append(violations, Violation{Code: CodeTooFewClasses, Params: map[string]any{"min": p.cfg.MinClasses}})
+	}
+	if p.cfg.RejectPersonalInfo && containsPersonalInfo(password, username, email) {
+		violations = append(violations, Violation{Code: CodePersonalInfo})
+	}
+	// Nothing is sent anywhere, but there is no point hashing a password
+	// that is rejected already
+	if len(violations) == 0 && p.breached != nil {
+		found, err := p.breached.Contains(password)
+		if err != nil {
+			// A damaged list must not stop everyone from choosing a password
+			log.Printf("Policy: Breached password lookup failed: %v", err)
+		}
+		if found {
+			violations = append(violations, Violation{Code: CodeBreached})
+		}
+	}
+	return violations
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, has := range []bool{lower, upper, digit, other} {
+		if has {
+			n++
+		}
+	}
+	return n
+}
+
+// containsPersonalInfo reports whether the password contains the username,
+// the email address or its local part, ignoring case.
+func containsPersonalInfo(password, username, email string) bool {
+	folded := normalize.Username(password)
+	candidates := []string{normalize.Username(username), normalize.Email(email)}
+	if local, _, ok := strings.Cut(normalize.Email(email), "@"); ok {
+		candidates = append(candidates, local)
+	}
+	for _, candidate := range candidates {
+		if utf8.RuneCountInString(candidate) >= personalInfoMinLength && strings.Contains(folded, candidate) {
+			return true
+		}
+	}
+	return false
+}
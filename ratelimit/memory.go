@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps events in process memory.
+type MemoryStore struct {
+	mu        sync.Mutex
+	events    map[string][]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{events: make(map[string][]time.Time)}
+}
+
+func (s *MemoryStore) Add(key string, at time.Time, window time.Duration) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(at, window)
+	events := append(prune(s.events[key], at, window), at)
+	s.events[key] = events
+	return append([]time.Time(nil), events...), nil
+}
+
+func (s *MemoryStore) Events(key string, now time.Time, window time.Duration) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := prune(s.events[key], now, window)
+	if len(events) == 0 {
+		delete(s.events, key)
+		return nil, nil
+	}
+	s.events[key] = events
+	return append([]time.Time(nil), events...), nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, key)
+	return nil
+}
+
+// sweep drops keys whose events have all expired so that one-off keys, such
+// as the IP addresses of a scan, do not accumulate. It runs at most once per
+// window.
+func (s *MemoryStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+	for key, events := range s.events {
+		if len(prune(events, now, window)) == 0 {
+			delete(s.events, key)
+		}
+	}
+}
+
+// prune removes the events that are older than the window.
+func prune(events []time.Time, now time.Time, window time.Duration) []time.Time {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	return events[i:]
+}
@@ -0,0 +1,66 @@
+// Package ratelimit counts events per key over a sliding window.
+package ratelimit
+
+import (
+	"time"
+)
+
+// Store keeps the event timestamps of each key. The in-memory store is
+// enough for a single server; several instances behind a load balancer need
+// a shared implementation.
+type Store interface {
+	// Add records an event for key at the given time and returns the events
+	// of key that are still inside the window, oldest first.
+	Add(key string, at time.Time, window time.Duration) ([]time.Time, error)
+	// Events returns the events of key inside the window, oldest first.
+	Events(key string, now time.Time, window time.Duration) ([]time.Time, error)
+	// Reset forgets every event of key.
+	Reset(key string) error
+}
+
+// Limiter allows at most Limit events per key within any Window.
+type Limiter struct {
+	Store  Store
+	Limit  int
+	Window time.Duration
+}
+
+func New(store Store, limit int, window time.Duration) *Limiter {
+	return &Limiter{Store: store, Limit: limit, Window: window}
+}
+
+// Allow reports whether another event for key is allowed now. If it is not,
+// it also returns how long to wait until the oldest event leaves the window.
+func (l *Limiter) Allow(key string) (bool, time.Duration, error) {
+	now := time.Now()
+	events, err := l.Store.Events(key, now, l.Window)
+	if err != nil {
+		return false, 0, err
+	}
+	return l.check(events, now)
+}
+
+// Record counts an event for key and reports whether the key is now over
+// its limit, with the time to wait if so.
+func (l *Limiter) Record(key string) (bool, time.Duration, error) {
+	now := time.Now()
+	events, err := l.Store.Add(key, now, l.Window)
+	if err != nil {
+		return false, 0, err
+	}
+	return l.check(events, now)
+}
+
+func (l *Limiter) Reset(key string) error {
+	return l.Store.Reset(key)
+}
+
+func (l *Limiter) check(events []time.Time, now time.Time) (bool, time.Duration, error) {
+	if len(events) < l.Limit {
+		return true, 0, nil
+	}
+	// The window frees up once enough old events have expired to leave
+	// room for one more.
+	oldest := events[len(events)-l.Limit]
+	return false, oldest.Add(l.Window).Sub(now), nil
+}
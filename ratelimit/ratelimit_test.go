@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	limiter := New(store, 3, time.Minute)
+	t0 := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := store.Add("k", t0.Add(time.Duration(i)*10*time.Second), limiter.Window); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		at      time.Duration
+		allowed bool
+	}{
+		{30 * time.Second, false},
+		{59 * time.Second, false},
+		{61 * time.Second, true},
+		{81 * time.Second, true},
+	} {
+		now := t0.Add(tc.at)
+		events, err := store.Events("k", now, limiter.Window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, _, _ := limiter.check(events, now)
+		if ok != tc.allowed {
+			t.Errorf("at +%s: allowed = %v, want %v", tc.at, ok, tc.allowed)
+		}
+	}
+
+	// Once every event has expired the key is forgotten
+	if _, found := store.events["k"]; found {
+		t.Errorf("expired key still stored")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	limiter := New(NewMemoryStore(), 2, time.Minute)
+	t0 := time.Now()
+	events := []time.Time{t0, t0.Add(5 * time.Second), t0.Add(40 * time.Second)}
+
+	// With three events and room for two, the second oldest has to leave
+	// the window before another attempt fits
+	ok, retryAfter, _ := limiter.check(events, t0.Add(45*time.Second))
+	if ok {
+		t.Fatal("allowed over the limit")
+	}
+	if want := 20 * time.Second; retryAfter != want {
+		t.Errorf("retry after = %s, want %s", retryAfter, want)
+	}
+}
+
+func TestRecordAllowReset(t *testing.T) {
+	limiter := New(NewMemoryStore(), 3, time.Minute)
+	for i := 1; i <= 3; i++ {
+		ok, _, err := limiter.Record("k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i < 3; ok != want {
+			t.Errorf("record %d: ok = %v, want %v", i, ok, want)
+		}
+	}
+
+	ok, retryAfter, err := limiter.Allow("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("allowed after reaching the limit")
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("retry after = %s, want within the window", retryAfter)
+	}
+	if ok, _, _ := limiter.Allow("other"); !ok {
+		t.Errorf("limit of one key applied to another")
+	}
+
+	if err := limiter.Reset("k"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, _ := limiter.Allow("k"); !ok {
+		t.Errorf("not allowed after reset")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	store := NewMemoryStore()
+	window := time.Minute
+	t0 := time.Now()
+
+	// One-off keys, like the addresses of a scan
+	for _, key := range []string{"a", "b", "c"} {
+		store.Add(key, t0, window)
+	}
+	// Within the window nothing is swept
+	store.Add("d", t0.Add(window/2), window)
+	if n := len(store.events); n != 4 {
+		t.Fatalf("%d keys before the window passed, want 4", n)
+	}
+
+	// The next write after a window drops every key that has expired
+	store.Add("e", t0.Add(window+time.Second), window)
+	if n := len(store.events); n != 2 {
+		t.Errorf("%d keys after sweep, want 2", n)
+	}
+	for _, key := range []string{"d", "e"} {
+		if _, found := store.events[key]; !found {
+			t.Errorf("key %s with live events was swept", key)
+		}
+	}
+}
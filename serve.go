@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"todo-app/config"
+	"todo-app/database"
+	"todo-app/handlers"
+	"todo-app/jobs"
+	"todo-app/keyring"
+	"todo-app/mail"
+	"todo-app/middleware"
+	"todo-app/models"
+	"todo-app/notify"
+	"todo-app/passwords"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// serve runs the web application until it fails.
+func serve(cfg *config.Config) {
+	if cfg.IsProduction() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Initialize database
+	if err := database.InitDB(cfg.Database); err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+	database.SetPasswordHasher(passwords.NewHasher(cfg.Password.Hash))
+	database.SetTodosConfig(cfg.Todos)
+	if _, err := database.PromoteAdmins(cfg.Auth.AdminUsers); err != nil {
+		log.Fatal("Failed to promote admin users:", err)
+	}
+	handlers.Init(cfg)
+	if _, err := handlers.SealTOTPSecrets(); err != nil {
+		log.Fatal("Failed to encrypt TOTP secrets:", err)
+	}
+
+	ring, err := keyring.New(cfg.Auth)
+	if err != nil {
+		log.Fatal("Failed to load signing keys:", err)
+	}
+	handlers.SetKeyRing(ring)
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal("Failed to configure mailer:", err)
+	}
+	handlers.SetMailer(mailer)
+
+	policy, err := passwords.NewPolicy(cfg.Password)
+	if err != nil {
+		log.Fatal("Failed to load password policy:", err)
+	}
+	handlers.SetPasswordPolicy(policy)
+
+	// Start background jobs
+	jobs.StartAccountPurger(context.Background(), cfg.Account.PurgeInterval.Std())
+	if cfg.Account.AuditRetention > 0 {
+		jobs.StartAuditPurger(context.Background(), cfg.Account.PurgeInterval.Std(), cfg.Account.AuditRetention.Std())
+	}
+	jobs.StartKeyRotation(context.Background(), ring, time.Minute)
+	if cfg.Todos.ReminderInterval > 0 {
+		notifier, err := notify.New(cfg, mailer)
+		if err != nil {
+			log.Fatal("Failed to configure reminders:", err)
+		}
+		jobs.StartReminderScheduler(context.Background(), cfg.Todos.ReminderInterval.Std(), notifier)
+	}
+
+	// Initialize Gin router
+	r := gin.Default()
+
+	// Configure CORS
+	r.Use(cors.New(cors.Config{
+		AllowOrigins:     cfg.Server.AllowedOrigins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.CSRFHeader},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: true,
+		MaxAge:           12 * 60 * 60, // 12 hours
+	}))
+
+	// Serve static files
+	r.Static("/static", "./static")
+	r.LoadHTMLGlob("templates/*")
+
+	// Public routes
+	r.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/login")
+	})
+	r.GET("/login", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"title":        "Login - To-Do List",
+			"ssoProviders": handlers.SSOProviders(),
+		})
+	})
+	r.GET("/register", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "register.html", gin.H{
+			"title": "Register - To-Do List",
+		})
+	})
+	r.GET("/forgot-password", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "forgot-password.html", gin.H{
+			"title": "Forgot Password - To-Do List",
+		})
+	})
+	r.GET("/reset-password", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "reset-password.html", gin.H{
+			"title": "Reset Password - To-Do List",
+		})
+	})
+
+	r.GET("/.well-known/jwks.json", handlers.JWKS)
+
+	// Single sign-on through OpenID Connect providers
+	r.GET("/auth/oidc/:provider", handlers.OIDCLogin)
+	r.GET("/auth/oidc/:provider/callback", handlers.OIDCCallback)
+
+	// Public API routes
+	r.POST("/api/register", handlers.Register)
+	r.POST("/api/login", handlers.Login)
+	r.POST("/api/login/2fa", handlers.LoginTwoFactor)
+	r.POST("/api/token/refresh", handlers.RefreshToken)
+	r.POST("/api/password/forgot", handlers.ForgotPassword)
+	r.POST("/api/password/reset", handlers.ResetPassword)
+	r.GET("/api/password/policy", handlers.GetPasswordPolicy)
+	r.GET("/api/verify-email", handlers.VerifyEmail)
+	r.POST("/api/verify-email/resend", handlers.ResendVerification)
+
+	// Protected API routes
+	api := r.Group("/api")
+	api.Use(middleware.AuthMiddleware(cfg, ring), middleware.CSRF(cfg))
+
+	// Account management needs a real login; personal access tokens are
+	// turned away
+	account := api.Group("")
+	account.Use(middleware.RequireSession())
+	{
+		account.POST("/logout", handlers.Logout)
+		account.GET("/sessions", handlers.GetSessions)
+		account.DELETE("/sessions", handlers.DeleteOtherSessions)
+		account.DELETE("/sessions/:id", handlers.DeleteSession)
+		account.GET("/profile", handlers.GetProfile)
+		account.DELETE("/profile", handlers.DeleteAccount)
+		account.GET("/profile/export", handlers.ExportAccount)
+		account.PUT("/profile/password", handlers.ChangePassword)
+		account.GET("/profile/security-log", handlers.GetSecurityLog)
+		account.GET("/2fa", handlers.GetTwoFactorStatus)
+		account.POST("/2fa/setup", handlers.SetupTwoFactor)
+		account.POST("/2fa/enable", handlers.EnableTwoFactor)
+		account.POST("/2fa/disable", handlers.DisableTwoFactor)
+		account.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+		account.GET("/tokens", handlers.GetAccessTokens)
+		account.POST("/tokens", handlers.CreateAccessToken)
+		account.DELETE("/tokens/:id", handlers.DeleteAccessToken)
+	}
+
+	// Administration needs a real login by an admin
+	admin := api.Group("/admin")
+	admin.Use(middleware.RequireSession(), middleware.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/users", handlers.AdminListUsers)
+		admin.POST("/users/:id/disable", handlers.AdminDisableUser)
+		admin.POST("/users/:id/enable", handlers.AdminEnableUser)
+		admin.POST("/users/:id/password-reset", handlers.AdminForcePasswordReset)
+		admin.PUT("/users/:id/role", handlers.AdminSetUserRole)
+		admin.GET("/stats", handlers.AdminGetStats)
+		admin.GET("/audit-events", handlers.AdminListAuditEvents)
+	}
+
+	// Todo, tag and list routes are open to access tokens with the matching scope
+	todosRead := api.Group("/todos")
+	todosRead.Use(middleware.RequireScope(models.ScopeTodosRead))
+	{
+		todosRead.GET("", handlers.GetTodos)
+		todosRead.GET("/:id", handlers.GetTodo)
+	}
+	todosWrite := api.Group("/todos")
+	todosWrite.Use(middleware.RequireScope(models.ScopeTodosWrite))
+	{
+		todosWrite.POST("", handlers.CreateTodo)
+		todosWrite.PUT("/:id", handlers.UpdateTodo)
+		todosWrite.PUT("/:id/toggle", handlers.ToggleTodo)
+		todosWrite.PUT("/:id/move", handlers.MoveTodo)
+		todosWrite.DELETE("/:id", handlers.DeleteTodo)
+	}
+	tagsRead := api.Group("/tags")
+	tagsRead.Use(middleware.RequireScope(models.ScopeTodosRead))
+	{
+		tagsRead.GET("", handlers.GetTags)
+	}
+	tagsWrite := api.Group("/tags")
+	tagsWrite.Use(middleware.RequireScope(models.ScopeTodosWrite))
+	{
+		tagsWrite.POST("", handlers.CreateTag)
+		tagsWrite.PUT("/:id", handlers.UpdateTag)
+		tagsWrite.DELETE("/:id", handlers.DeleteTag)
+	}
+	listsRead := api.Group("/lists")
+	listsRead.Use(middleware.RequireScope(models.ScopeTodosRead))
+	{
+		listsRead.GET("", handlers.GetLists)
+	}
+	listsWrite := api.Group("/lists")
+	listsWrite.Use(middleware.RequireScope(models.ScopeTodosWrite))
+	{
+		listsWrite.POST("", handlers.CreateList)
+		listsWrite.PUT("/:id", handlers.UpdateList)
+		listsWrite.DELETE("/:id", handlers.DeleteList)
+	}
+
+	// Protected pages
+	protected := r.Group("")
+	protected.Use(middleware.AuthMiddleware(cfg, ring), middleware.RequireSession())
+	{
+		protected.GET("/profile", func(c *gin.Context) {
+			c.HTML(http.StatusOK, "profile.html", gin.H{
+				"title":     "Profile - To-Do List",
+				"csrfToken": middleware.CSRFToken(cfg, c.GetString("session_id")),
+			})
+		})
+		protected.GET("/todos", func(c *gin.Context) {
+			c.HTML(http.StatusOK, "index.html", gin.H{
+				"title":     "My Todos",
+				"csrfToken": middleware.CSRFToken(cfg, c.GetString("session_id")),
+			})
+		})
+	}
+
+	// Start server
+	if err := r.Run(cfg.Server.Addr); err != nil {
+		log.Fatal("Failed to start server:", err)
+	}
+}
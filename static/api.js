@@ -0,0 +1,77 @@
+// Shared helpers for talking to the API from authenticated pages.
+//
+// Access tokens are short-lived. When a request comes back 401 the refresh
+// token cookie is exchanged for a new access token once and the request is
+// retried; if that fails too the user is sent back to the login page.
+//
+// Requests that change data carry the page's CSRF token, which the server
+// requires whenever the session cookie authenticates the request.
+
+let refreshPromise = null;
+
+async function refreshSession() {
+    // Collapse concurrent refreshes into one request: refresh tokens are
+    // single-use, so a second parallel refresh would revoke the session.
+    if (!refreshPromise) {
+        refreshPromise = (async () => {
+            console.log('API: Refreshing access token');
+            const response = await fetch('/api/token/refresh', {
+                method: 'POST',
+                credentials: 'include'
+            });
+            if (!response.ok) {
+                console.log('API: Refresh failed, status:', response.status);
+                return false;
+            }
+            const data = await response.json();
+            localStorage.setItem('token', data.token);
+            return true;
+        })().finally(() => {
+            refreshPromise = null;
+        });
+    }
+    return refreshPromise;
+}
+
+function redirectToLogin() {
+    localStorage.removeItem('token');
+    window.location.href = '/login';
+}
+
+async function apiFetch(url, options = {}) {
+    const send = () => {
+        const headers = Object.assign({}, options.headers);
+        const token = localStorage.getItem('token');
+        if (token) {
+            headers['Authorization'] = `Bearer ${token}`;
+        }
+        const method = (options.method || 'GET').toUpperCase();
+        const csrfToken = document.querySelector('meta[name="csrf-token"]')?.content;
+        if (csrfToken && method !== 'GET' && method !== 'HEAD') {
+            headers['X-CSRF-Token'] = csrfToken;
+        }
+        return fetch(url, Object.assign({}, options, { headers, credentials: 'include' }));
+    };
+
+    let response = await send();
+    if (response.status === 401) {
+        if (await refreshSession()) {
+            response = await send();
+        }
+        if (response.status === 401) {
+            console.log('API: Still unauthorized after refresh, redirecting to login');
+            redirectToLogin();
+        }
+    }
+    return response;
+}
+
+async function logout() {
+    console.log('API: Logging out');
+    try {
+        await apiFetch('/api/logout', { method: 'POST' });
+    } catch (error) {
+        console.error('API: Logout request failed:', error);
+    }
+    redirectToLogin();
+}
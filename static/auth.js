@@ -36,6 +36,12 @@ document.addEventListener('DOMContentLoaded', () => {
         }, 5000);
     }
 
+    function showTooManyAttempts(response) {
+        const seconds = parseInt(response.headers.get('Retry-After'), 10) || 60;
+        const minutes = Math.ceil(seconds / 60);
+        showError(i18n.t('auth.tooManyAttempts', { count: minutes }));
+    }
+
     function setLoading(isLoading) {
         if (loginButton) {
             const spinner = loginButton.querySelector('.spinner');
@@ -72,6 +78,18 @@ document.addEventListener('DOMContentLoaded', () => {
                 throw new Error(data.error || 'Authentication failed');
             }
 
+            // Accounts that must verify their email first get no token yet
+            if (data.verification_required) {
+                console.log('Auth.js: Email verification required before login');
+                return data;
+            }
+
+            // Accounts with two-factor authentication still need a code
+            if (data.mfa_required) {
+                console.log('Auth.js: Second factor required');
+                return data;
+            }
+
             // Check for token in response body
             if (data.token) {
                 console.log('Auth.js: Token found in response body');
@@ -112,6 +130,11 @@ document.addEventListener('DOMContentLoaded', () => {
 
             console.log('Auth.js: Registration attempt:', { username, email });
 
+            if (username.includes('@')) {
+                showError(i18n.t("auth.usernameNoAt"));
+                return;
+            }
+
             if (password !== confirmPassword) {
                 showError(i18n.t("auth.passwordMismatch"));
                 return;
@@ -129,9 +152,21 @@ document.addEventListener('DOMContentLoaded', () => {
                 });
 
                 console.log('Auth.js: Registration response received');
-                await handleAuthResponse(response);
+                if (response.status === 409) {
+                    showError(i18n.t("auth.accountExists"));
+                    return;
+                }
+                if (response.status === 400) {
+                    const data = await response.json();
+                    if (data.code === 'weak_password') {
+                        showError(i18n.passwordViolations(data.violations));
+                        return;
+                    }
+                    throw new Error(data.error || 'Registration failed');
+                }
+                const data = await handleAuthResponse(response);
                 console.log('Auth.js: Registration successful, redirecting');
-                window.location.href = '/login';
+                window.location.href = data.verification_required ? '/login?registered=verify' : '/login';
             } catch (error) {
                 console.error('Auth.js: Registration error:', error);
                 showError(i18n.t("auth.registerError"));
@@ -143,26 +178,148 @@ document.addEventListener('DOMContentLoaded', () => {
 
     if (loginForm) {
         console.log('Auth.js: Login form found');
+
+        const verificationSection = document.getElementById('verification-section');
+        const showVerificationSection = () => {
+            if (verificationSection) {
+                verificationSection.classList.remove('hidden');
+            }
+        };
+
+        // Messages handed over by the registration and verification redirects
+        const params = new URLSearchParams(window.location.search);
+        if (params.get('verified') === '1') {
+            showError(i18n.t('auth.verify.success'));
+        } else if (params.get('verified') === '0') {
+            showError(i18n.t('auth.verify.invalidLink'));
+            showVerificationSection();
+        } else if (params.get('registered') === 'verify') {
+            showError(i18n.t('auth.verify.checkInbox'));
+            showVerificationSection();
+        } else if (params.get('sso_error')) {
+            const reason = params.get('sso_error');
+            const known = ['unavailable', 'expired', 'denied', 'email_unverified', 'account_unverified', 'no_account', 'account_disabled'];
+            showError(i18n.t(`auth.sso.errors.${known.includes(reason) ? reason : 'failed'}`));
+        }
+
+        const resendForm = document.getElementById('resend-verification-form');
+        if (resendForm) {
+            resendForm.addEventListener('submit', async (e) => {
+                e.preventDefault();
+                const email = document.getElementById('verification-email').value.trim();
+                try {
+                    await fetch('/api/verify-email/resend', {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json',
+                        },
+                        body: JSON.stringify({ email })
+                    });
+                    showError(i18n.t('auth.verify.resent'));
+                } catch (error) {
+                    console.error('Auth.js: Resend verification error:', error);
+                    showError(i18n.t('auth.networkError'));
+                }
+            });
+        }
+
+        // Resume a still-valid session instead of asking for the password again
+        fetch('/api/token/refresh', { method: 'POST', credentials: 'include' })
+            .then(response => response.ok ? response.json() : null)
+            .then(data => {
+                if (data && data.token) {
+                    console.log('Auth.js: Existing session resumed, redirecting');
+                    localStorage.setItem('token', data.token);
+                    window.location.href = '/todos';
+                }
+            })
+            .catch(error => console.log('Auth.js: No session to resume:', error));
+
+        // Second login step for accounts with two-factor authentication
+        const mfaForm = document.getElementById('mfa-form');
+        let mfaToken = null;
+        const showMFAForm = (token) => {
+            mfaToken = token;
+            loginForm.classList.add('hidden');
+            document.getElementById('sso-section')?.classList.add('hidden');
+            mfaForm.classList.remove('hidden');
+            document.getElementById('mfa-code').focus();
+        };
+
+        if (mfaForm) {
+            mfaForm.addEventListener('submit', async (e) => {
+                e.preventDefault();
+                const code = document.getElementById('mfa-code').value.trim();
+                try {
+                    const response = await fetch('/api/login/2fa', {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json',
+                        },
+                        body: JSON.stringify({ mfa_token: mfaToken, code }),
+                        credentials: 'include'
+                    });
+                    if (response.status === 429) {
+                        showTooManyAttempts(response);
+                        return;
+                    }
+                    if (response.status === 403) {
+                        mfaForm.classList.add('hidden');
+                        loginForm.classList.remove('hidden');
+                        document.getElementById('sso-section')?.classList.remove('hidden');
+                        showError(i18n.t('auth.accountDisabled'));
+                        return;
+                    }
+                    if (response.status === 401) {
+                        const data = await response.json();
+                        if (data.error !== 'Invalid verification code') {
+                            // The pending login expired or ran out of attempts
+                            mfaForm.classList.add('hidden');
+                            loginForm.classList.remove('hidden');
+                            document.getElementById('sso-section')?.classList.remove('hidden');
+                            showError(i18n.t('auth.mfa.expired'));
+                            return;
+                        }
+                        showError(i18n.t('auth.mfa.invalidCode'));
+                        return;
+                    }
+                    await handleAuthResponse(response);
+                    console.log('Auth.js: Two-factor login successful, redirecting');
+                    window.location.href = '/todos';
+                } catch (error) {
+                    console.error('Auth.js: Two-factor login error:', error);
+                    showError(i18n.t('auth.networkError'));
+                }
+            });
+        }
+
+        // Single sign-on hands over a pending login in the URL fragment,
+        // which never reaches server logs
+        const hashParams = new URLSearchParams(window.location.hash.slice(1));
+        if (hashParams.get('mfa_token') && mfaForm) {
+            history.replaceState(null, '', window.location.pathname);
+            showMFAForm(hashParams.get('mfa_token'));
+        }
+
         loginForm.addEventListener('submit', async (e) => {
             e.preventDefault();
             console.log('Auth.js: Login form submitted');
             
-            const username = document.getElementById('username').value.trim();
+            const identifier = document.getElementById('identifier').value.trim();
             const password = document.getElementById('password').value;
 
-            // Validate username
-            if (username.length < 3) {
+            // Validate username or email
+            if (identifier.length < 3) {
                 showError(i18n.t("auth.usernameTooShort"));
                 return;
             }
 
-            // Validate password length
-            if (password.length < 6) {
-                showError(i18n.t("auth.passwordTooShort"));
+            if (!password) {
+                showError(i18n.t("auth.passwordRequired"));
                 return;
             }
 
-            console.log('Auth.js: Login attempt:', { username });
+            console.log('Auth.js: Login attempt:', { identifier });
 
             try {
                 console.log('Auth.js: Sending login request');
@@ -180,14 +337,34 @@ document.addEventListener('DOMContentLoaded', () => {
                     method: 'POST',
                     headers,
                     body: JSON.stringify({ 
-                        username, 
+                        identifier, 
                         password
                     }),
                     credentials: 'include' // Include cookies in the request
                 });
 
                 console.log('Auth.js: Login response received');
-                await handleAuthResponse(response);
+                if (response.status === 429) {
+                    showTooManyAttempts(response);
+                    return;
+                }
+                if (response.status === 403) {
+                    const data = await response.json();
+                    if (data.code === 'email_not_verified') {
+                        showError(i18n.t('auth.verify.required'));
+                        showVerificationSection();
+                        return;
+                    }
+                    if (data.code === 'account_disabled') {
+                        showError(i18n.t('auth.accountDisabled'));
+                        return;
+                    }
+                }
+                const data = await handleAuthResponse(response);
+                if (data.mfa_required) {
+                    showMFAForm(data.mfa_token);
+                    return;
+                }
                 console.log('Auth.js: Login successful, redirecting');
                 window.location.href = '/todos';
             } catch (error) {
@@ -84,9 +84,25 @@ async function initializeI18n() {
       return container;
     }
 
+    // Rules of the password policy, loaded for pages with a password hint
+    let passwordRequirements = null;
+
+    function describePasswordRequirements() {
+      const parts = [i18next.t('auth.passwordPolicy.too_short', { min: passwordRequirements.min_length })];
+      if (passwordRequirements.min_classes > 0) {
+        parts.push(i18next.t('auth.passwordPolicy.too_few_classes', { min: passwordRequirements.min_classes }));
+      }
+      return parts.join(' ');
+    }
+
     // Update all translatable content
     function updateContent() {
       console.log('i18n: Updating content');
+      if (passwordRequirements) {
+        document.querySelectorAll('[data-password-requirements]').forEach(element => {
+          element.textContent = describePasswordRequirements();
+        });
+      }
       document.querySelectorAll('[data-i18n]').forEach(element => {
         const key = element.getAttribute('data-i18n');
         element.textContent = i18next.t(key);
@@ -110,9 +126,28 @@ async function initializeI18n() {
     }
     updateContent();
 
+    if (document.querySelector('[data-password-requirements]')) {
+      fetch('/api/password/policy')
+        .then(response => response.ok ? response.json() : Promise.reject(response.status))
+        .then(requirements => {
+          passwordRequirements = requirements;
+          updateContent();
+        })
+        .catch(error => console.warn('i18n: Failed to load password policy:', error));
+    }
+
+    // Describe the rules a rejected password breaks, from the violations
+    // of a weak_password error
+    function passwordViolations(violations) {
+      return (violations || [])
+        .map(v => i18next.t(`auth.passwordPolicy.${v.code}`, v.params || {}))
+        .join(' ');
+    }
+
     // Export functions for use in other files
     window.i18n = {
-      t: (key) => i18next.t(key),
+      t: (key, options) => i18next.t(key, options),
+      passwordViolations,
       updateContent
     };
   } catch (error) {
@@ -120,6 +155,7 @@ async function initializeI18n() {
     // Provide a fallback i18n object that returns the key
     window.i18n = {
       t: (key) => key,
+      passwordViolations: (violations) => (violations || []).map(v => v.code).join(' '),
       updateContent: () => {}
     };
   }
@@ -0,0 +1,94 @@
+document.addEventListener('DOMContentLoaded', () => {
+    console.log('Password.js: DOM Content Loaded');
+    const forgotForm = document.getElementById('forgot-password-form');
+    const resetForm = document.getElementById('reset-password-form');
+    const errorMessage = document.getElementById('error-message');
+
+    function showMessage(message, isSuccess) {
+        if (!errorMessage) {
+            console.error('Error message element not found');
+            return;
+        }
+        errorMessage.textContent = message;
+        errorMessage.classList.toggle('success-message', !!isSuccess);
+        errorMessage.classList.remove('hidden');
+    }
+
+    if (forgotForm) {
+        forgotForm.addEventListener('submit', async (e) => {
+            e.preventDefault();
+            const email = document.getElementById('email').value.trim();
+
+            try {
+                const response = await fetch('/api/password/forgot', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({ email })
+                });
+                if (response.status === 429) {
+                    const seconds = parseInt(response.headers.get('Retry-After'), 10) || 60;
+                    showMessage(i18n.t('auth.forgot.tooManyRequests', { count: Math.ceil(seconds / 60) }), false);
+                    return;
+                }
+                if (!response.ok) {
+                    throw new Error('Request failed');
+                }
+                forgotForm.reset();
+                showMessage(i18n.t('auth.forgot.sent'), true);
+            } catch (error) {
+                console.error('Password.js: Forgot password error:', error);
+                showMessage(i18n.t('auth.networkError'), false);
+            }
+        });
+    }
+
+    if (resetForm) {
+        const token = new URLSearchParams(window.location.search).get('token');
+        if (!token) {
+            showMessage(i18n.t('auth.reset.invalidLink'), false);
+        }
+
+        resetForm.addEventListener('submit', async (e) => {
+            e.preventDefault();
+            const password = document.getElementById('password').value;
+            const confirmPassword = document.getElementById('confirm-password').value;
+
+            if (password !== confirmPassword) {
+                showMessage(i18n.t('auth.passwordMismatch'), false);
+                return;
+            }
+
+            try {
+                const response = await fetch('/api/password/reset', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({ token, password })
+                });
+                if (!response.ok) {
+                    const data = await response.json().catch(() => ({}));
+                    // A weak password leaves the link usable for another try
+                    let message = i18n.t('auth.reset.invalidLink');
+                    if (data.code === 'weak_password') {
+                        message = i18n.passwordViolations(data.violations);
+                    } else if (data.code === 'directory_account') {
+                        message = i18n.t('profile.password.directoryManaged');
+                    }
+                    showMessage(message, false);
+                    return;
+                }
+                resetForm.reset();
+                showMessage(i18n.t('auth.reset.success'), true);
+                setTimeout(() => {
+                    window.location.href = '/login';
+                }, 2000);
+            } catch (error) {
+                console.error('Password.js: Reset password error:', error);
+                showMessage(i18n.t('auth.networkError'), false);
+            }
+        });
+    }
+});
@@ -9,49 +9,72 @@ document.addEventListener('DOMContentLoaded', () => {
 
     // Load profile data
     loadProfile();
+    loadSessions();
+    loadTwoFactorStatus();
+    loadAccessTokens();
+    loadSecurityLog();
 
-    // Handle logout
-    const logoutBtn = document.querySelector('.logout-btn');
-    if (logoutBtn) {
-        logoutBtn.addEventListener('click', () => {
-            console.log('Profile.js: Logging out');
-            localStorage.removeItem('token');
-            window.location.href = '/login';
-        });
+    // Handle personal access tokens
+    const createTokenForm = document.getElementById('create-token-form');
+    if (createTokenForm) {
+        createTokenForm.addEventListener('submit', createAccessToken);
+    }
+
+    // Handle two-factor authentication
+    const twoFactorSetupBtn = document.getElementById('two-factor-setup-btn');
+    if (twoFactorSetupBtn) {
+        twoFactorSetupBtn.addEventListener('click', setupTwoFactor);
+        document.getElementById('two-factor-enable-form').addEventListener('submit', enableTwoFactor);
+        document.getElementById('two-factor-manage-form').addEventListener('submit', disableTwoFactor);
+        document.getElementById('regenerate-recovery-codes-btn').addEventListener('click', regenerateRecoveryCodes);
+    }
+
+    // Handle signing out other sessions
+    const revokeOthersBtn = document.getElementById('revoke-other-sessions-btn');
+    if (revokeOthersBtn) {
+        revokeOthersBtn.addEventListener('click', revokeOtherSessions);
     }
 
     // Handle change password
     const changePasswordBtn = document.getElementById('change-password-btn');
-    if (changePasswordBtn) {
+    const changePasswordSection = document.getElementById('change-password-section');
+    const changePasswordForm = document.getElementById('change-password-form');
+    if (changePasswordBtn && changePasswordSection) {
         changePasswordBtn.addEventListener('click', () => {
             console.log('Profile.js: Change password clicked');
-            // TODO: Implement change password functionality
-            alert('Change password functionality coming soon!');
+            changePasswordSection.classList.remove('hidden');
+            document.getElementById('current-password').focus();
+        });
+        document.getElementById('cancel-password-btn').addEventListener('click', () => {
+            changePasswordForm.reset();
+            changePasswordSection.classList.add('hidden');
         });
+        changePasswordForm.addEventListener('submit', changePassword);
     }
 
     // Handle delete account
     const deleteAccountBtn = document.getElementById('delete-account-btn');
-    if (deleteAccountBtn) {
+    const deleteAccountSection = document.getElementById('delete-account-section');
+    const deleteAccountForm = document.getElementById('delete-account-form');
+    if (deleteAccountBtn && deleteAccountSection) {
         deleteAccountBtn.addEventListener('click', () => {
             console.log('Profile.js: Delete account clicked');
-            if (confirm('Are you sure you want to delete your account? This action cannot be undone.')) {
-                // TODO: Implement delete account functionality
-                alert('Delete account functionality coming soon!');
-            }
+            deleteAccountSection.classList.remove('hidden');
+            document.getElementById('delete-account-password').focus();
+        });
+        document.getElementById('cancel-delete-account-btn').addEventListener('click', () => {
+            deleteAccountForm.reset();
+            deleteAccountSection.classList.add('hidden');
         });
+        document.getElementById('export-account-btn').addEventListener('click', exportAccount);
+        deleteAccountForm.addEventListener('submit', deleteAccount);
     }
 });
 
 async function loadProfile() {
     console.log('Profile.js: Loading profile data');
     try {
-        const response = await fetch('/api/profile', {
-            headers: {
-                'Authorization': `Bearer ${localStorage.getItem('token')}`,
-            },
-            credentials: 'include'
-        });
+        const response = await apiFetch('/api/profile');
 
         if (!response.ok) {
             console.error('Profile.js: Failed to load profile, status:', response.status);
@@ -79,6 +102,10 @@ async function loadProfile() {
             console.error('Profile.js: Email element not found');
         }
 
+        if (!user.email_verified_at) {
+            showVerificationNotice(user.email);
+        }
+
         // Load todo statistics
         await loadTodoStats();
     } catch (error) {
@@ -93,12 +120,7 @@ async function loadProfile() {
 async function loadTodoStats() {
     console.log('Profile.js: Loading todo statistics');
     try {
-        const response = await fetch('/api/todos', {
-            headers: {
-                'Authorization': `Bearer ${localStorage.getItem('token')}`,
-            },
-            credentials: 'include'
-        });
+        const response = await apiFetch('/api/todos');
 
         if (!response.ok) {
             console.error('Profile.js: Failed to load todos, status:', response.status);
@@ -189,12 +211,8 @@ async function createTodoElement(todo) {
 // Add todo management functions
 async function toggleTodo(id) {
     try {
-        const token = localStorage.getItem('token');
-        const response = await fetch(`/api/todos/${id}/toggle`, {
-            method: 'PUT',
-            headers: {
-                'Authorization': `Bearer ${token}`
-            }
+        const response = await apiFetch(`/api/todos/${id}/toggle`, {
+            method: 'PUT'
         });
 
         if (!response.ok) {
@@ -212,12 +230,8 @@ async function deleteTodo(id) {
     if (!confirm('Are you sure you want to delete this todo?')) return;
 
     try {
-        const token = localStorage.getItem('token');
-        const response = await fetch(`/api/todos/${id}`, {
-            method: 'DELETE',
-            headers: {
-                'Authorization': `Bearer ${token}`
-            }
+        const response = await apiFetch(`/api/todos/${id}`, {
+            method: 'DELETE'
         });
 
         if (!response.ok) {
@@ -229,4 +243,532 @@ async function deleteTodo(id) {
     } catch (error) {
         console.error('Profile.js: Error deleting todo:', error);
     }
-} 
\ No newline at end of file
+}
+
+async function loadSessions() {
+    console.log('Profile.js: Loading sessions');
+    const sessionsList = document.getElementById('sessions-list');
+    if (!sessionsList) {
+        console.error('Profile.js: sessions-list element not found');
+        return;
+    }
+
+    try {
+        const response = await apiFetch('/api/sessions');
+        if (!response.ok) {
+            throw new Error('Failed to load sessions');
+        }
+        const sessions = await response.json();
+        console.log('Profile.js: Sessions received:', sessions);
+
+        // Wait for i18n to be ready
+        while (!window.i18n || !window.i18n.t) {
+            await new Promise(resolve => setTimeout(resolve, 100));
+        }
+
+        sessionsList.innerHTML = '';
+        for (const session of sessions) {
+            sessionsList.appendChild(createSessionElement(session));
+        }
+    } catch (error) {
+        console.error('Profile.js: Error loading sessions:', error);
+    }
+}
+
+function createSessionElement(session) {
+    const item = document.createElement('div');
+    item.className = 'session-item';
+
+    const info = document.createElement('div');
+    const device = document.createElement('div');
+    device.className = 'session-device';
+    device.textContent = session.device;
+    if (session.current) {
+        const badge = document.createElement('span');
+        badge.className = 'session-badge';
+        badge.textContent = window.i18n.t('profile.sessions.current');
+        device.appendChild(badge);
+    }
+
+    const meta = document.createElement('div');
+    meta.className = 'session-meta';
+    const lastSeen = new Date(session.last_seen_at).toLocaleString();
+    meta.textContent = `${session.ip_address || '-'} · ${window.i18n.t('profile.sessions.lastSeen')} ${lastSeen}`;
+    meta.title = session.user_agent;
+
+    info.appendChild(device);
+    info.appendChild(meta);
+    item.appendChild(info);
+
+    const revokeBtn = document.createElement('button');
+    revokeBtn.className = 'profile-button small danger';
+    revokeBtn.textContent = window.i18n.t(session.current ? 'nav.logout' : 'profile.sessions.revoke');
+    revokeBtn.addEventListener('click', () => revokeSession(session));
+    item.appendChild(revokeBtn);
+
+    return item;
+}
+
+async function revokeSession(session) {
+    if (session.current) {
+        await logout();
+        return;
+    }
+
+    try {
+        const response = await apiFetch(`/api/sessions/${encodeURIComponent(session.id)}`, {
+            method: 'DELETE'
+        });
+        if (!response.ok) {
+            throw new Error('Failed to revoke session');
+        }
+        await loadSessions();
+    } catch (error) {
+        console.error('Profile.js: Error revoking session:', error);
+    }
+}
+
+async function revokeOtherSessions() {
+    try {
+        const response = await apiFetch('/api/sessions', { method: 'DELETE' });
+        if (!response.ok) {
+            throw new Error('Failed to revoke sessions');
+        }
+        await loadSessions();
+    } catch (error) {
+        console.error('Profile.js: Error revoking other sessions:', error);
+    }
+}
+
+async function loadSecurityLog() {
+    const securityLogList = document.getElementById('security-log-list');
+    if (!securityLogList) return;
+
+    try {
+        const response = await apiFetch('/api/profile/security-log?limit=20');
+        if (!response.ok) {
+            throw new Error('Failed to load security log');
+        }
+        const data = await response.json();
+
+        // Wait for i18n to be ready
+        while (!window.i18n || !window.i18n.t) {
+            await new Promise(resolve => setTimeout(resolve, 100));
+        }
+
+        securityLogList.innerHTML = '';
+        if (data.events.length === 0) {
+            const empty = document.createElement('p');
+            empty.className = 'session-meta';
+            empty.textContent = window.i18n.t('profile.securityLog.empty');
+            securityLogList.appendChild(empty);
+            return;
+        }
+        for (const event of data.events) {
+            securityLogList.appendChild(createSecurityEventElement(event));
+        }
+    } catch (error) {
+        console.error('Profile.js: Error loading security log:', error);
+    }
+}
+
+function createSecurityEventElement(event) {
+    const item = document.createElement('div');
+    item.className = 'session-item';
+
+    const info = document.createElement('div');
+    const title = document.createElement('div');
+    title.className = 'session-device';
+    title.textContent = window.i18n.t(`profile.securityLog.events.${event.event}`, { defaultValue: event.event });
+
+    const meta = document.createElement('div');
+    meta.className = 'session-meta';
+    const when = new Date(event.created_at).toLocaleString();
+    meta.textContent = `${event.ip_address || '-'} · ${when}`;
+    meta.title = event.user_agent;
+
+    info.appendChild(title);
+    info.appendChild(meta);
+    item.appendChild(info);
+    return item;
+}
+
+function showPasswordMessage(message, isSuccess) {
+    const element = document.getElementById('password-message');
+    if (!element) return;
+    element.textContent = message;
+    element.classList.toggle('success-message', isSuccess);
+    element.classList.remove('hidden');
+}
+
+async function changePassword(e) {
+    e.preventDefault();
+    const form = e.target;
+    const currentPassword = document.getElementById('current-password').value;
+    const newPassword = document.getElementById('new-password').value;
+    const confirmPassword = document.getElementById('confirm-new-password').value;
+
+    if (newPassword !== confirmPassword) {
+        showPasswordMessage(window.i18n.t('auth.passwordMismatch'), false);
+        return;
+    }
+
+    try {
+        const response = await apiFetch('/api/profile/password', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({
+                current_password: currentPassword,
+                new_password: newPassword
+            })
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            console.error('Profile.js: Change password failed:', data);
+            let message = window.i18n.t('profile.password.error');
+            if (data.code === 'weak_password') {
+                message = window.i18n.passwordViolations(data.violations);
+            } else if (data.code === 'directory_account') {
+                message = window.i18n.t('profile.password.directoryManaged');
+            }
+            showPasswordMessage(message, false);
+            return;
+        }
+
+        form.reset();
+        showPasswordMessage(window.i18n.t('profile.password.success'), true);
+        // Every other session was signed out by the server
+        await loadSessions();
+    } catch (error) {
+        console.error('Profile.js: Error changing password:', error);
+        showPasswordMessage(window.i18n.t('auth.networkError'), false);
+    }
+}
+
+async function loadAccessTokens() {
+    const tokensList = document.getElementById('tokens-list');
+    if (!tokensList) return;
+
+    try {
+        const response = await apiFetch('/api/tokens');
+        if (!response.ok) {
+            throw new Error('Failed to load tokens');
+        }
+        const accessTokens = await response.json();
+        console.log('Profile.js: Access tokens received:', accessTokens);
+
+        // Wait for i18n to be ready
+        while (!window.i18n || !window.i18n.t) {
+            await new Promise(resolve => setTimeout(resolve, 100));
+        }
+
+        tokensList.innerHTML = '';
+        for (const accessToken of accessTokens) {
+            tokensList.appendChild(createAccessTokenElement(accessToken));
+        }
+    } catch (error) {
+        console.error('Profile.js: Error loading access tokens:', error);
+    }
+}
+
+function createAccessTokenElement(accessToken) {
+    const item = document.createElement('div');
+    item.className = 'session-item';
+
+    const info = document.createElement('div');
+    const name = document.createElement('div');
+    name.className = 'session-device';
+    name.textContent = accessToken.name;
+
+    const meta = document.createElement('div');
+    meta.className = 'session-meta';
+    const expires = accessToken.expires_at
+        ? new Date(accessToken.expires_at).toLocaleDateString()
+        : window.i18n.t('profile.tokens.never');
+    const lastUsed = accessToken.last_used_at
+        ? new Date(accessToken.last_used_at).toLocaleString()
+        : window.i18n.t('profile.tokens.neverUsed');
+    meta.textContent = `${accessToken.prefix}… · ${accessToken.scopes.join(', ')} · ${window.i18n.t('profile.tokens.expiry')}: ${expires} · ${window.i18n.t('profile.tokens.lastUsed')}: ${lastUsed}`;
+
+    info.appendChild(name);
+    info.appendChild(meta);
+    item.appendChild(info);
+
+    const revokeBtn = document.createElement('button');
+    revokeBtn.className = 'profile-button small danger';
+    revokeBtn.textContent = window.i18n.t('profile.sessions.revoke');
+    revokeBtn.addEventListener('click', () => revokeAccessToken(accessToken.id));
+    item.appendChild(revokeBtn);
+
+    return item;
+}
+
+async function createAccessToken(e) {
+    e.preventDefault();
+    const form = e.target;
+    const name = document.getElementById('token-name').value.trim();
+    const scopes = [...form.querySelectorAll('input[name="token-scope"]:checked')].map(input => input.value);
+    const expiresInDays = parseInt(document.getElementById('token-expiry').value, 10);
+    if (!name || scopes.length === 0) {
+        return;
+    }
+
+    try {
+        const response = await apiFetch('/api/tokens', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ name, scopes, expires_in_days: expiresInDays })
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            console.error('Profile.js: Creating access token failed:', data);
+            return;
+        }
+
+        form.reset();
+        document.getElementById('new-token-value').textContent = data.token;
+        document.getElementById('new-token').classList.remove('hidden');
+        await loadAccessTokens();
+    } catch (error) {
+        console.error('Profile.js: Error creating access token:', error);
+    }
+}
+
+async function revokeAccessToken(id) {
+    try {
+        const response = await apiFetch(`/api/tokens/${id}`, { method: 'DELETE' });
+        if (!response.ok) {
+            throw new Error('Failed to revoke token');
+        }
+        await loadAccessTokens();
+    } catch (error) {
+        console.error('Profile.js: Error revoking access token:', error);
+    }
+}
+
+function showTwoFactorMessage(message, isSuccess) {
+    const element = document.getElementById('two-factor-message');
+    if (!element) return;
+    element.textContent = message;
+    element.classList.toggle('success-message', isSuccess);
+    element.classList.remove('hidden');
+}
+
+async function loadTwoFactorStatus() {
+    try {
+        const response = await apiFetch('/api/2fa');
+        if (!response.ok) {
+            throw new Error('Failed to load two-factor status');
+        }
+        const status = await response.json();
+        console.log('Profile.js: Two-factor status:', status);
+
+        const statusElement = document.getElementById('two-factor-status');
+        statusElement.textContent = status.enabled
+            ? window.i18n.t('profile.twoFactor.enabledStatus', { count: status.recovery_codes_remaining })
+            : window.i18n.t('profile.twoFactor.disabledStatus');
+        document.getElementById('two-factor-setup-btn').classList.toggle('hidden', status.enabled);
+        document.getElementById('two-factor-manage-form').classList.toggle('hidden', !status.enabled);
+    } catch (error) {
+        console.error('Profile.js: Error loading two-factor status:', error);
+    }
+}
+
+async function setupTwoFactor() {
+    try {
+        const response = await apiFetch('/api/2fa/setup', { method: 'POST' });
+        const data = await response.json();
+        if (!response.ok) {
+            console.error('Profile.js: Two-factor setup failed:', data);
+            showTwoFactorMessage(window.i18n.t('profile.twoFactor.error'), false);
+            return;
+        }
+
+        document.getElementById('two-factor-qr').src = data.qr_code;
+        document.getElementById('two-factor-secret').textContent = data.secret;
+        document.getElementById('two-factor-setup').classList.remove('hidden');
+        document.getElementById('two-factor-code').focus();
+    } catch (error) {
+        console.error('Profile.js: Error setting up two-factor:', error);
+    }
+}
+
+async function enableTwoFactor(e) {
+    e.preventDefault();
+    const code = document.getElementById('two-factor-code').value.trim();
+    try {
+        const response = await apiFetch('/api/2fa/enable', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ code })
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            console.error('Profile.js: Enabling two-factor failed:', data);
+            showTwoFactorMessage(window.i18n.t('auth.mfa.invalidCode'), false);
+            return;
+        }
+
+        e.target.reset();
+        document.getElementById('two-factor-setup').classList.add('hidden');
+        showRecoveryCodes(data.recovery_codes);
+        showTwoFactorMessage(window.i18n.t('profile.twoFactor.enabled'), true);
+        await loadTwoFactorStatus();
+    } catch (error) {
+        console.error('Profile.js: Error enabling two-factor:', error);
+    }
+}
+
+async function disableTwoFactor(e) {
+    e.preventDefault();
+    const code = document.getElementById('two-factor-manage-code').value.trim();
+    const password = document.getElementById('two-factor-manage-password').value;
+    try {
+        const response = await apiFetch('/api/2fa/disable', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ code, password })
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            console.error('Profile.js: Disabling two-factor failed:', data);
+            showTwoFactorMessage(window.i18n.t('profile.twoFactor.disableError'), false);
+            return;
+        }
+
+        e.target.reset();
+        document.getElementById('recovery-codes').classList.add('hidden');
+        showTwoFactorMessage(window.i18n.t('profile.twoFactor.disabled'), true);
+        await loadTwoFactorStatus();
+    } catch (error) {
+        console.error('Profile.js: Error disabling two-factor:', error);
+    }
+}
+
+async function regenerateRecoveryCodes() {
+    const codeInput = document.getElementById('two-factor-manage-code');
+    const code = codeInput.value.trim();
+    if (!code) {
+        codeInput.focus();
+        return;
+    }
+    try {
+        const response = await apiFetch('/api/2fa/recovery-codes', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ code })
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            console.error('Profile.js: Regenerating recovery codes failed:', data);
+            showTwoFactorMessage(window.i18n.t('auth.mfa.invalidCode'), false);
+            return;
+        }
+
+        codeInput.value = '';
+        showRecoveryCodes(data.recovery_codes);
+        await loadTwoFactorStatus();
+    } catch (error) {
+        console.error('Profile.js: Error regenerating recovery codes:', error);
+    }
+}
+
+function showRecoveryCodes(codes) {
+    const list = document.getElementById('recovery-codes-list');
+    list.innerHTML = '';
+    codes.forEach(code => {
+        const item = document.createElement('li');
+        item.textContent = code;
+        list.appendChild(item);
+    });
+    document.getElementById('recovery-codes').classList.remove('hidden');
+}
+
+async function exportAccount() {
+    console.log('Profile.js: Exporting account data');
+    try {
+        const response = await apiFetch('/api/profile/export');
+        if (!response.ok) {
+            throw new Error('Failed to export account');
+        }
+
+        const disposition = response.headers.get('Content-Disposition') || '';
+        const match = disposition.match(/filename="([^"]+)"/);
+        const blob = await response.blob();
+        const url = URL.createObjectURL(blob);
+        const link = document.createElement('a');
+        link.href = url;
+        link.download = match ? match[1] : 'todo-export.json';
+        document.body.appendChild(link);
+        link.click();
+        link.remove();
+        URL.revokeObjectURL(url);
+    } catch (error) {
+        console.error('Profile.js: Error exporting account:', error);
+    }
+}
+
+async function deleteAccount(e) {
+    e.preventDefault();
+    const messageElement = document.getElementById('delete-account-message');
+    const password = document.getElementById('delete-account-password').value;
+
+    if (!confirm(window.i18n.t('profile.deleteAccount.confirmPrompt'))) {
+        return;
+    }
+
+    try {
+        const response = await apiFetch('/api/profile', {
+            method: 'DELETE',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ password })
+        });
+        if (!response.ok) {
+            const data = await response.json();
+            console.error('Profile.js: Delete account failed:', data);
+            messageElement.textContent = window.i18n.t('profile.deleteAccount.error');
+            messageElement.classList.remove('hidden');
+            return;
+        }
+
+        console.log('Profile.js: Account scheduled for deletion');
+        redirectToLogin();
+    } catch (error) {
+        console.error('Profile.js: Error deleting account:', error);
+    }
+}
+
+function showVerificationNotice(email) {
+    const notice = document.getElementById('verification-notice');
+    const resendBtn = document.getElementById('resend-verification-btn');
+    if (!notice || !resendBtn) return;
+
+    notice.classList.remove('hidden');
+    resendBtn.addEventListener('click', async () => {
+        try {
+            await fetch('/api/verify-email/resend', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({ email })
+            });
+            resendBtn.disabled = true;
+            notice.querySelector('span').textContent = window.i18n.t('auth.verify.resent');
+        } catch (error) {
+            console.error('Profile.js: Error resending verification email:', error);
+        }
+    });
+}
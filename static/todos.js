@@ -30,11 +30,14 @@ async function loadTodos() {
     
     try {
         console.log('Todos: Sending fetch request to /api/todos');
-        const response = await fetch('/api/todos', {
-            headers: {
-                'Authorization': `Bearer ${token}`
-            }
-        });
+        const params = new URLSearchParams({ sort: todoSort ? todoSort.value : 'created' });
+        if (activeListId) {
+            params.set('list_id', activeListId);
+        }
+        for (const tag of activeTags) {
+            params.append('tag', tag);
+        }
+        const response = await apiFetch(`/api/todos?${params}`);
         
         console.log('Todos: Response status:', response.status);
         if (!response.ok) {
@@ -57,6 +60,8 @@ async function loadTodos() {
             throw new Error('Invalid response format from server');
         }
         
+        // Refresh the sidebar counts along with the todos
+        await loadLists();
         await displayTodos(todos);
     } catch (error) {
         console.error('Todos: Error loading todos:', error);
@@ -82,14 +87,20 @@ async function displayTodos(todos) {
     }
     
     todosList.innerHTML = '';
+    renderTagFilter();
     
     // if (!Array.isArray(todos) || todos.length === 0) {
     //     todosList.innerHTML = `<div class="text-gray-500 text-center py-4">${window.i18n.t('todos.noTodos')}</div>`;
     //     return;
     // }
     
-    for (const todo of todos) {
-        const todoElement = await createTodoElement(todo);
+    // The manual order can only be changed while it is shown
+    const movable = todoSort && todoSort.value === 'position';
+    for (let i = 0; i < todos.length; i++) {
+        const todoElement = await createTodoElement(todos[i], movable ? {
+            previous: todos[i - 1],
+            next: todos[i + 1],
+        } : null);
         todosList.appendChild(todoElement);
     }
 }
@@ -98,6 +109,22 @@ async function displayTodos(todos) {
 let todoForm;
 let todoInput;
 let todoDescription;
+let todoDue;
+let todoRemind;
+let todoPriority;
+let todoSort;
+let todoTags;
+let tagFilter;
+// Tags the list is filtered by; todos must carry all of them
+let activeTags = [];
+let listsNav;
+let newListForm;
+let newListName;
+// The user's lists and the one shown; 0 shows the todos of all lists
+let lists = [];
+let activeListId = 0;
+// Todos whose subtasks are shown
+const expandedTodos = new Set();
 let todosList;
 let errorMessage;
 
@@ -109,6 +136,15 @@ async function initialize() {
     todoForm = document.getElementById('new-todo-form');
     todoInput = document.getElementById('new-todo');
     todoDescription = document.getElementById('new-todo-description');
+    todoDue = document.getElementById('new-todo-due');
+    todoRemind = document.getElementById('new-todo-remind');
+    todoPriority = document.getElementById('new-todo-priority');
+    todoSort = document.getElementById('todo-sort');
+    todoTags = document.getElementById('new-todo-tags');
+    tagFilter = document.getElementById('tag-filter');
+    listsNav = document.getElementById('lists-nav');
+    newListForm = document.getElementById('new-list-form');
+    newListName = document.getElementById('new-list-name');
     todosList = document.getElementById('todos-list');
     errorMessage = document.getElementById('error-message');
     
@@ -150,6 +186,19 @@ async function initialize() {
         console.error('Todos: todo form not found');
     }
     
+    if (todoSort) {
+        todoSort.value = localStorage.getItem('todoSort') || 'created';
+        todoSort.addEventListener('change', () => {
+            localStorage.setItem('todoSort', todoSort.value);
+            loadTodos();
+        });
+    }
+
+    if (newListForm) {
+        newListForm.addEventListener('submit', addList);
+    }
+    activeListId = Number(localStorage.getItem('todoList')) || 0;
+
     // Load initial todos
     console.log('Todos: Loading initial todos');
     await loadTodos();
@@ -181,8 +230,9 @@ function showError(message) {
     }, 5000);
 }
 
-// Create todo item HTML
-async function createTodoElement(todo) {
+// Create todo item HTML. neighbors holds the todos shown above and below
+// when the todo can be moved.
+async function createTodoElement(todo, neighbors) {
     // Wait for i18n to be ready
     while (!window.i18n || !window.i18n.t) {
         console.log('Todos: Waiting for i18n in createTodoElement...');
@@ -198,11 +248,34 @@ async function createTodoElement(todo) {
     const completed = todo.completed;
     const completeText = window.i18n.t(completed ? 'todos.undo' : 'todos.complete');
     const deleteText = window.i18n.t('todos.delete');
+    const priorityBadge = todo.priority && todo.priority !== 'none'
+        ? `<span class="priority-badge priority-${todo.priority}">${window.i18n.t(`todos.priorities.${todo.priority}`)}</span>`
+        : '';
+    const moveButtons = neighbors ? `
+                <button class="move-btn" onclick="moveTodo(${todo.id}, { before_id: ${neighbors.previous ? neighbors.previous.id : 0} })" title="${window.i18n.t('todos.moveUp')}" ${neighbors.previous ? '' : 'disabled'}>
+                    <i class="fas fa-arrow-up"></i>
+                </button>
+                <button class="move-btn" onclick="moveTodo(${todo.id}, { after_id: ${neighbors.next ? neighbors.next.id : 0} })" title="${window.i18n.t('todos.moveDown')}" ${neighbors.next ? '' : 'disabled'}>
+                    <i class="fas fa-arrow-down"></i>
+                </button>` : '';
+    const progress = todo.progress && todo.progress.total > 0
+        ? `<span class="subtask-progress">${todo.progress.done}/${todo.progress.total}</span>`
+        : '';
+    const progressTitle = todo.progress && todo.progress.total > 0
+        ? window.i18n.t('todos.subtasks.progress', { done: todo.progress.done, total: todo.progress.total })
+        : window.i18n.t('todos.subtasks.title');
+    const overdue = todo.due_at && !completed && new Date(todo.due_at) < new Date();
+    const dueText = todo.due_at
+        ? window.i18n.t(overdue ? 'todos.overdue' : 'todos.due', { date: new Date(todo.due_at).toLocaleString() })
+        : '';
     
     todoElement.innerHTML = `
         <div class="todo-header">
-            <h3 class="todo-title ${completed ? 'completed-text' : ''}">${title}</h3>
-            <div class="todo-actions">
+            <h3 class="todo-title ${completed ? 'completed-text' : ''}">${title}${priorityBadge}</h3>
+            <div class="todo-actions">${moveButtons}
+                <button class="subtasks-btn" onclick="toggleSubtasks(${todo.id})" title="${progressTitle}">
+                    <i class="fas fa-list-check"></i>${progress}
+                </button>
                 <button class="complete-btn" onclick="toggleTodo(${todo.id})" title="${completeText}">
                     <i class="fas ${completed ? 'fa-undo' : 'fa-check'}"></i>
                 </button>
@@ -212,11 +285,361 @@ async function createTodoElement(todo) {
             </div>
         </div>
         ${description && !completed ? `<p class="todo-description">${description}</p>` : ''}
+        ${dueText ? `<p class="todo-due ${overdue ? 'overdue' : ''}"><i class="fas fa-clock"></i>${dueText}</p>` : ''}
     `;
 
+    if (lists.length > 1) {
+        todoElement.appendChild(createListSelect(todo));
+    }
+
+    if (todo.tags && todo.tags.length > 0) {
+        const tagsElement = document.createElement('div');
+        tagsElement.className = 'todo-tags';
+        for (const tag of todo.tags) {
+            tagsElement.appendChild(createTagChip(tag, () => filterByTag(tag.name)));
+        }
+        todoElement.appendChild(tagsElement);
+    }
+
+    if (expandedTodos.has(todo.id)) {
+        todoElement.appendChild(await createSubtasksElement(todo.id));
+    }
+
     return todoElement;
 }
 
+function toggleSubtasks(id) {
+    if (expandedTodos.has(id)) {
+        expandedTodos.delete(id);
+    } else {
+        expandedTodos.add(id);
+    }
+    loadTodos();
+}
+
+// Create the checklist of a todo's subtasks, nested as deep as they go,
+// with a form to add one
+async function createSubtasksElement(id) {
+    const container = document.createElement('div');
+    container.className = 'subtasks';
+
+    try {
+        const response = await apiFetch(`/api/todos/${id}`);
+        if (!response.ok) {
+            throw new Error(window.i18n.t('todos.subtasks.fetchError'));
+        }
+        const todo = await response.json();
+        appendSubtasks(container, todo.subtasks || [], 0);
+    } catch (error) {
+        console.error('Todos: Error loading subtasks:', error);
+        showError(error.message);
+    }
+
+    const form = document.createElement('form');
+    form.className = 'subtask-form';
+    const input = document.createElement('input');
+    input.type = 'text';
+    input.required = true;
+    input.className = 'todo-input';
+    input.placeholder = window.i18n.t('todos.subtasks.placeholder');
+    const button = document.createElement('button');
+    button.type = 'submit';
+    button.className = 'add-subtask-btn';
+    button.title = window.i18n.t('todos.subtasks.add');
+    button.innerHTML = '<i class="fas fa-plus"></i>';
+    form.append(input, button);
+    form.addEventListener('submit', e => {
+        e.preventDefault();
+        addSubtask(id, input.value.trim());
+    });
+    container.appendChild(form);
+    return container;
+}
+
+function appendSubtasks(container, subtasks, depth) {
+    for (const subtask of subtasks) {
+        const row = document.createElement('div');
+        row.className = `subtask-row ${subtask.completed ? 'completed' : ''}`;
+        row.style.paddingLeft = `${depth * 1.25}rem`;
+
+        const checkbox = document.createElement('input');
+        checkbox.type = 'checkbox';
+        checkbox.checked = subtask.completed;
+        checkbox.addEventListener('change', () => toggleTodo(subtask.id));
+
+        const title = document.createElement('span');
+        title.className = `subtask-title ${subtask.completed ? 'completed-text' : ''}`;
+        title.textContent = subtask.title;
+
+        const deleteButton = document.createElement('button');
+        deleteButton.type = 'button';
+        deleteButton.className = 'subtask-delete-btn';
+        deleteButton.title = window.i18n.t('todos.delete');
+        deleteButton.innerHTML = '<i class="fas fa-trash"></i>';
+        deleteButton.addEventListener('click', () => deleteTodo(subtask.id));
+
+        row.append(checkbox, title, deleteButton);
+        container.appendChild(row);
+        appendSubtasks(container, subtask.subtasks || [], depth + 1);
+    }
+}
+
+async function addSubtask(parentId, title) {
+    if (!checkAuth() || !title) return;
+
+    try {
+        const response = await apiFetch('/api/todos', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ title, parent_id: parentId }),
+        });
+
+        if (!response.ok) {
+            if (response.status === 401) {
+                localStorage.removeItem('token');
+                window.location.href = '/login';
+                return;
+            }
+            throw new Error(window.i18n.t('todos.subtasks.addError'));
+        }
+
+        await loadTodos();
+    } catch (error) {
+        console.error('Todos: Error adding subtask:', error);
+        showError(error.message);
+    }
+}
+
+// Create a colored tag button; names are set as text, never as HTML
+function createTagChip(tag, onClick) {
+    const chip = document.createElement('button');
+    chip.type = 'button';
+    chip.className = 'tag-chip';
+    chip.style.backgroundColor = tag.color;
+    chip.textContent = tag.name;
+    chip.addEventListener('click', onClick);
+    return chip;
+}
+
+function filterByTag(name) {
+    if (!activeTags.includes(name)) {
+        activeTags.push(name);
+        loadTodos();
+    }
+}
+
+// Show the tags the list is filtered by, each removable with a click
+function renderTagFilter() {
+    if (!tagFilter) return;
+    tagFilter.innerHTML = '';
+    tagFilter.classList.toggle('hidden', activeTags.length === 0);
+    if (activeTags.length === 0) return;
+
+    const label = document.createElement('span');
+    label.textContent = window.i18n.t('todos.filteredBy');
+    tagFilter.appendChild(label);
+    for (const name of activeTags) {
+        const chip = createTagChip({ name: `${name} ×`, color: 'var(--primary-color)' }, () => {
+            activeTags = activeTags.filter(tag => tag !== name);
+            loadTodos();
+        });
+        chip.title = window.i18n.t('todos.removeFilter');
+        tagFilter.appendChild(chip);
+    }
+}
+
+function listName(list) {
+    return list.inbox ? window.i18n.t('lists.inbox') : list.name;
+}
+
+// Load the lists with their counts into the sidebar
+async function loadLists() {
+    try {
+        const response = await apiFetch('/api/lists');
+        if (!response.ok) {
+            throw new Error(window.i18n.t('lists.fetchError'));
+        }
+        lists = await response.json();
+    } catch (error) {
+        console.error('Todos: Error loading lists:', error);
+        showError(error.message);
+        return;
+    }
+    // The shown list may have been deleted or archived elsewhere
+    if (activeListId && !lists.some(list => list.id === activeListId)) {
+        selectList(0);
+        return;
+    }
+    renderLists();
+}
+
+// Show the lists in the sidebar; names are set as text, never as HTML
+function renderLists() {
+    if (!listsNav) return;
+    listsNav.innerHTML = '';
+
+    const openCount = lists.reduce((sum, list) => sum + list.open_count, 0);
+    const overdueCount = lists.reduce((sum, list) => sum + list.overdue_count, 0);
+    listsNav.appendChild(createListItem(
+        { id: 0, name: window.i18n.t('lists.all'), icon: 'layer-group', color: 'var(--text-secondary)' },
+        openCount, overdueCount));
+    for (const list of lists) {
+        listsNav.appendChild(createListItem(list, list.open_count, list.overdue_count));
+    }
+}
+
+function createListItem(list, openCount, overdueCount) {
+    const item = document.createElement('li');
+    item.className = 'list-item';
+
+    const link = document.createElement('button');
+    link.type = 'button';
+    link.className = `list-link ${list.id === activeListId ? 'active' : ''}`;
+    link.addEventListener('click', () => selectList(list.id));
+
+    const icon = document.createElement('i');
+    icon.className = `fas fa-${list.icon}`;
+    icon.style.color = list.color;
+    link.appendChild(icon);
+
+    const name = document.createElement('span');
+    name.className = 'list-name';
+    name.textContent = list.id ? listName(list) : list.name;
+    link.appendChild(name);
+
+    const count = document.createElement('span');
+    count.className = `list-count ${overdueCount > 0 ? 'overdue' : ''}`;
+    count.textContent = openCount;
+    if (overdueCount > 0) {
+        count.title = window.i18n.t('lists.overdueCount', { count: overdueCount });
+    }
+    link.appendChild(count);
+    item.appendChild(link);
+
+    if (list.id && !list.inbox) {
+        const deleteButton = document.createElement('button');
+        deleteButton.type = 'button';
+        deleteButton.className = 'list-delete-btn';
+        deleteButton.title = window.i18n.t('lists.delete');
+        deleteButton.innerHTML = '<i class="fas fa-trash"></i>';
+        deleteButton.addEventListener('click', () => deleteList(list));
+        item.appendChild(deleteButton);
+    }
+    return item;
+}
+
+function selectList(id) {
+    activeListId = id;
+    localStorage.setItem('todoList', id);
+    loadTodos();
+}
+
+// Create the select that moves a todo to another list
+function createListSelect(todo) {
+    const select = document.createElement('select');
+    select.className = 'todo-list-select';
+    select.title = window.i18n.t('lists.moveTo');
+    for (const list of lists) {
+        const option = document.createElement('option');
+        option.value = list.id;
+        option.textContent = listName(list);
+        option.selected = list.id === todo.list_id;
+        select.appendChild(option);
+    }
+    select.addEventListener('change', () => moveTodoToList(todo.id, Number(select.value)));
+    return select;
+}
+
+async function addList(e) {
+    e.preventDefault();
+    if (!checkAuth()) return;
+
+    const name = newListName.value.trim();
+    if (!name) return;
+
+    try {
+        const response = await apiFetch('/api/lists', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ name }),
+        });
+
+        if (!response.ok) {
+            if (response.status === 401) {
+                localStorage.removeItem('token');
+                window.location.href = '/login';
+                return;
+            }
+            throw new Error(window.i18n.t('lists.addError'));
+        }
+
+        const list = await response.json();
+        newListName.value = '';
+        selectList(list.id);
+    } catch (error) {
+        console.error('Todos: Error adding list:', error);
+        showError(error.message);
+    }
+}
+
+// Delete a list; the server moves its todos to the Inbox
+async function deleteList(list) {
+    if (!checkAuth()) return;
+    if (!confirm(window.i18n.t('lists.deleteConfirm', { name: list.name }))) return;
+
+    try {
+        const response = await apiFetch(`/api/lists/${list.id}`, {
+            method: 'DELETE'
+        });
+
+        if (!response.ok) {
+            if (response.status === 401) {
+                localStorage.removeItem('token');
+                window.location.href = '/login';
+                return;
+            }
+            throw new Error(window.i18n.t('lists.deleteError'));
+        }
+
+        await loadTodos();
+    } catch (error) {
+        console.error('Todos: Error deleting list:', error);
+        showError(error.message);
+    }
+}
+
+async function moveTodoToList(id, listId) {
+    if (!checkAuth()) return;
+
+    try {
+        const response = await apiFetch(`/api/todos/${id}`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ list_id: listId }),
+        });
+
+        if (!response.ok) {
+            if (response.status === 401) {
+                localStorage.removeItem('token');
+                window.location.href = '/login';
+                return;
+            }
+            throw new Error(window.i18n.t('lists.moveError'));
+        }
+
+        await loadTodos();
+    } catch (error) {
+        console.error('Todos: Error moving todo to list:', error);
+        showError(error.message);
+    }
+}
+
 // Add new todo
 async function addTodo(e) {
     e.preventDefault();
@@ -224,6 +647,13 @@ async function addTodo(e) {
 
     const title = todoInput.value.trim();
     const description = todoDescription.value.trim();
+    // datetime-local values are in the browser's zone; send them as instants
+    const due_at = todoDue && todoDue.value ? new Date(todoDue.value).toISOString() : null;
+    const remind_at = todoRemind && todoRemind.value ? new Date(todoRemind.value).toISOString() : null;
+    const priority = todoPriority ? todoPriority.value : 'none';
+    const tags = todoTags
+        ? todoTags.value.split(',').map(tag => tag.trim()).filter(tag => tag)
+        : [];
 
     // Wait for i18n to be ready
     while (!window.i18n || !window.i18n.t) {
@@ -237,14 +667,13 @@ async function addTodo(e) {
     }
 
     try {
-        const token = localStorage.getItem('token');
-        const response = await fetch('/api/todos', {
+        const response = await apiFetch('/api/todos', {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json',
-                'Authorization': `Bearer ${token}`
+                'Content-Type': 'application/json'
             },
-            body: JSON.stringify({ title, description }),
+            // New todos go to the list shown, or to the Inbox
+            body: JSON.stringify({ title, description, priority, tags, due_at, remind_at, list_id: activeListId }),
         });
 
         if (!response.ok) {
@@ -262,6 +691,10 @@ async function addTodo(e) {
         // Clear form
         todoInput.value = '';
         todoDescription.value = '';
+        if (todoDue) todoDue.value = '';
+        if (todoRemind) todoRemind.value = '';
+        if (todoPriority) todoPriority.value = 'none';
+        if (todoTags) todoTags.value = '';
         todoInput.focus();
         
         // Reload todos to ensure consistent state
@@ -283,12 +716,8 @@ async function toggleTodo(id) {
             await new Promise(resolve => setTimeout(resolve, 100));
         }
 
-        const token = localStorage.getItem('token');
-        const response = await fetch(`/api/todos/${id}/toggle`, {
-            method: 'PUT',
-            headers: {
-                'Authorization': `Bearer ${token}`
-            }
+        const response = await apiFetch(`/api/todos/${id}/toggle`, {
+            method: 'PUT'
         });
 
         if (!response.ok) {
@@ -297,6 +726,10 @@ async function toggleTodo(id) {
                 window.location.href = '/login';
                 return;
             }
+            // Open subtasks can keep a todo from being completed
+            if (response.status === 409) {
+                throw new Error(window.i18n.t('todos.subtasks.openSubtasks'));
+            }
             throw new Error(window.i18n.t('todos.toggleError'));
         }
 
@@ -308,6 +741,35 @@ async function toggleTodo(id) {
     }
 }
 
+// Move todo in the manual order
+async function moveTodo(id, placement) {
+    if (!checkAuth()) return;
+
+    try {
+        const response = await apiFetch(`/api/todos/${id}/move`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(placement),
+        });
+
+        if (!response.ok) {
+            if (response.status === 401) {
+                localStorage.removeItem('token');
+                window.location.href = '/login';
+                return;
+            }
+            throw new Error(window.i18n.t('todos.moveError'));
+        }
+
+        await loadTodos();
+    } catch (error) {
+        console.error('Todos: Error moving todo:', error);
+        showError(error.message);
+    }
+}
+
 // Delete todo
 async function deleteTodo(id) {
     if (!checkAuth()) return;
@@ -319,12 +781,8 @@ async function deleteTodo(id) {
             await new Promise(resolve => setTimeout(resolve, 100));
         }
 
-        const token = localStorage.getItem('token');
-        const response = await fetch(`/api/todos/${id}`, {
-            method: 'DELETE',
-            headers: {
-                'Authorization': `Bearer ${token}`
-            }
+        const response = await apiFetch(`/api/todos/${id}`, {
+            method: 'DELETE'
         });
 
         if (!response.ok) {
@@ -343,9 +801,3 @@ async function deleteTodo(id) {
         showError(error.message);
     }
 }
-
-function logout() {
-    console.log('Todos: Logging out');
-    localStorage.removeItem('token');
-    window.location.href = '/login';
-} 
\ No newline at end of file
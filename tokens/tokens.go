@@ -0,0 +1,43 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Generate returns a URL-safe random string carrying n bytes of entropy.
+func Generate(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash returns the hex-encoded SHA-256 of a token. Tokens are stored only
+// in this form so a leaked database cannot be replayed against the API.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told
+// apart from JWTs in an Authorization header, and found by secret scanners.
+const PersonalAccessTokenPrefix = "todo_pat_"
+
+// displayPrefixLength is how many characters of a personal access token are
+// kept in the clear to identify it.
+const displayPrefixLength = len(PersonalAccessTokenPrefix) + 6
+
+// GeneratePersonalAccessToken returns a new personal access token and the
+// prefix that may be stored and shown alongside it.
+func GeneratePersonalAccessToken() (token, prefix string, err error) {
+	secret, err := Generate(32)
+	if err != nil {
+		return "", "", err
+	}
+	token = PersonalAccessTokenPrefix + secret
+	return token, token[:displayPrefixLength], nil
+}